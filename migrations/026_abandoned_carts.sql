@@ -0,0 +1,30 @@
+-- Carts, their products and the abandoned-cart reminders sent for them.
+CREATE TABLE Carts (
+    ID                 INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    email              VARCHAR(255) NOT NULL,
+    timestamp          INT NOT NULL,
+    abandonedTimestamp INT NULL
+);
+
+CREATE TABLE CartProducts (
+    cartID    INT NOT NULL,
+    productID INT NOT NULL,
+    quantity  INT NOT NULL,
+    INDEX (cartID),
+    INDEX (productID)
+);
+
+CREATE TABLE AbandonedCartEvents (
+    ID        INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    cartID    INT NOT NULL,
+    email     VARCHAR(255) NOT NULL,
+    notified  BOOLEAN NOT NULL,
+    timestamp INT NOT NULL,
+    INDEX (cartID)
+);
+
+CREATE TABLE NotificationPreferences (
+    email  VARCHAR(255) NOT NULL PRIMARY KEY,
+    optOut BOOLEAN NOT NULL DEFAULT FALSE,
+    token  VARCHAR(64) NULL
+);
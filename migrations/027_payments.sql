@@ -0,0 +1,25 @@
+-- Every call made to a payment provider for an order.
+CREATE TABLE Payments (
+    ID            INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    orderID       INT NOT NULL,
+    provider      VARCHAR(64) NOT NULL,
+    operation     VARCHAR(32) NOT NULL,
+    transactionID VARCHAR(255) NOT NULL,
+    status        VARCHAR(32) NOT NULL,
+    amount        DECIMAL(10, 2) NOT NULL,
+    timestamp     INT NOT NULL,
+    INDEX (orderID)
+);
+
+-- Orders already marked as paid were settled outside the providers; record
+-- that as a captured payment of their value so they are invoiced and can be
+-- refunded like the orders paid from now on.
+INSERT INTO Payments(orderID, provider, operation, transactionID, status, amount, timestamp)
+SELECT o.ID, o.paymentMethod, 'capture', CONCAT('migrated-', o.ID), 'captured',
+    SUM(p.price * po.quantity) * 100 / (100 + COALESCE(v.discountPercentage, 0)), o.timestamp
+FROM Orders o
+    JOIN ProductOrders po ON po.orderID = o.ID
+    JOIN Products p ON po.productID = p.ID
+    LEFT JOIN Vouchers v ON o.voucherCode = v.code
+WHERE o.status = 'platita'
+GROUP BY o.ID, o.paymentMethod, o.timestamp, v.discountPercentage;
@@ -0,0 +1,24 @@
+-- Refunds, the lines they refund, and the stock they may put back.
+CREATE TABLE Refunds (
+    ID        INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    orderID   INT NOT NULL,
+    type      VARCHAR(16) NOT NULL,
+    amount    DECIMAL(10, 2) NOT NULL,
+    reason    VARCHAR(255) NOT NULL,
+    operator  VARCHAR(255) NOT NULL,
+    restock   BOOLEAN NOT NULL DEFAULT FALSE,
+    timestamp INT NOT NULL,
+    INDEX (orderID)
+);
+
+CREATE TABLE RefundedProducts (
+    refundID  INT NOT NULL,
+    productID INT NOT NULL,
+    quantity  INT NOT NULL,
+    amount    DECIMAL(10, 2) NOT NULL,
+    INDEX (refundID)
+);
+
+-- Stock was not tracked before; existing products start with none and
+-- have to be restocked through the catalog import or the admin endpoints.
+ALTER TABLE Products ADD COLUMN stock INT NOT NULL DEFAULT 0;
@@ -0,0 +1,5 @@
+-- Orders are archived instead of deleted; every existing order stays active.
+ALTER TABLE Orders
+    ADD COLUMN archivedBy VARCHAR(255) NULL,
+    ADD COLUMN archivedTimestamp INT NULL,
+    ADD INDEX (archivedTimestamp);
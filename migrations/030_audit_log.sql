@@ -0,0 +1,12 @@
+-- Who changed what and when; changes holds the JSON list of field changes.
+CREATE TABLE AuditLog (
+    ID        INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    actor     VARCHAR(255) NOT NULL,
+    entity    VARCHAR(32) NOT NULL,
+    entityID  INT NOT NULL,
+    operation VARCHAR(16) NOT NULL,
+    changes   TEXT NOT NULL,
+    timestamp INT NOT NULL,
+    INDEX (entity, entityID),
+    INDEX (timestamp)
+);
@@ -0,0 +1,5 @@
+-- Row versions behind the ETag / If-Match checks; existing rows start at 0.
+ALTER TABLE Orders ADD COLUMN version INT NOT NULL DEFAULT 0;
+ALTER TABLE Products ADD COLUMN version INT NOT NULL DEFAULT 0;
+ALTER TABLE Categories ADD COLUMN version INT NOT NULL DEFAULT 0;
+ALTER TABLE Departments ADD COLUMN version INT NOT NULL DEFAULT 0;
@@ -0,0 +1,7 @@
+-- Whether an order gave the quantities it took out of stock back, which it
+-- does once, when it is cancelled, archived or purged.
+ALTER TABLE Orders ADD COLUMN stockReleased BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Orders placed before stock was tracked never took anything out of it, so
+-- they have nothing to give back.
+UPDATE Orders SET stockReleased = TRUE;
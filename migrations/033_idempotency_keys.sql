@@ -0,0 +1,10 @@
+-- Responses replayed for repeated Idempotency-Key requests.
+CREATE TABLE IdempotencyKeys (
+    idempotencyKey VARCHAR(255) NOT NULL PRIMARY KEY,
+    requestHash    VARCHAR(64) NOT NULL,
+    completed      BOOLEAN NOT NULL DEFAULT FALSE,
+    status         INT NOT NULL DEFAULT 0,
+    body           MEDIUMBLOB NOT NULL,
+    etag           VARCHAR(64) NOT NULL,
+    timestamp      INT NOT NULL
+);
@@ -0,0 +1,40 @@
+-- Saved shipping addresses, delivery zones and the structured address and
+-- shipping cost of each order.
+CREATE TABLE Addresses (
+    ID           INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    email        VARCHAR(255) NOT NULL,
+    street       VARCHAR(255) NOT NULL,
+    streetNumber VARCHAR(32) NOT NULL,
+    details      VARCHAR(255) NOT NULL,
+    postalCode   VARCHAR(16) NOT NULL,
+    city         VARCHAR(255) NOT NULL,
+    county       VARCHAR(255) NOT NULL,
+    country      VARCHAR(255) NOT NULL,
+    INDEX (email)
+);
+
+CREATE TABLE DeliveryZones (
+    ID                    INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    name                  VARCHAR(255) NOT NULL,
+    shippingFee           DECIMAL(10, 2) NULL,
+    freeShippingThreshold DECIMAL(10, 2) NULL
+);
+
+CREATE TABLE DeliveryZoneAreas (
+    zoneID           INT NOT NULL,
+    county           VARCHAR(255) NULL,
+    postalCodePrefix VARCHAR(16) NULL,
+    INDEX (zoneID)
+);
+
+ALTER TABLE Orders
+    ADD COLUMN street VARCHAR(255) NULL,
+    ADD COLUMN streetNumber VARCHAR(32) NULL,
+    ADD COLUMN postalCode VARCHAR(16) NULL,
+    ADD COLUMN county VARCHAR(255) NULL,
+    ADD COLUMN country VARCHAR(255) NULL,
+    ADD COLUMN deliveryZoneID INT NULL,
+    ADD COLUMN shippingCost DECIMAL(10, 2) NULL;
+
+-- Shipping was never charged before delivery zones.
+UPDATE Orders SET shippingCost = 0 WHERE shippingCost IS NULL;
@@ -0,0 +1,24 @@
+-- Weekly delivery slots and the reservations held against them.
+CREATE TABLE DeliverySlots (
+    ID        INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    zoneID    INT NOT NULL,
+    weekday   INT NOT NULL,
+    startTime VARCHAR(5) NOT NULL,
+    endTime   VARCHAR(5) NOT NULL,
+    capacity  INT NOT NULL
+);
+
+CREATE TABLE SlotReservations (
+    ID               INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    slotID           INT NOT NULL,
+    deliveryDate     VARCHAR(10) NOT NULL,
+    email            VARCHAR(255) NOT NULL,
+    expiresTimestamp INT NOT NULL,
+    orderID          INT NULL,
+    INDEX (slotID, deliveryDate),
+    INDEX (orderID)
+);
+
+ALTER TABLE Orders
+    ADD COLUMN deliverySlotID INT NULL,
+    ADD COLUMN deliveryDate VARCHAR(10) NULL;
@@ -0,0 +1,31 @@
+-- Click-and-collect locations, their opening hours and pickup slots.
+CREATE TABLE PickupLocations (
+    ID           INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    name         VARCHAR(255) NOT NULL,
+    street       VARCHAR(255) NOT NULL,
+    streetNumber VARCHAR(32) NOT NULL,
+    postalCode   VARCHAR(16) NOT NULL,
+    city         VARCHAR(255) NOT NULL,
+    county       VARCHAR(255) NOT NULL
+);
+
+CREATE TABLE PickupLocationHours (
+    locationID INT NOT NULL,
+    weekday    INT NOT NULL,
+    opens      VARCHAR(5) NOT NULL,
+    closes     VARCHAR(5) NOT NULL,
+    INDEX (locationID)
+);
+
+-- A slot belongs either to a delivery zone or to a pickup location.
+ALTER TABLE DeliverySlots
+    MODIFY COLUMN zoneID INT NULL,
+    ADD COLUMN pickupLocationID INT NULL;
+
+ALTER TABLE Orders
+    ADD COLUMN fulfilmentType VARCHAR(16) NULL,
+    ADD COLUMN pickupLocationID INT NULL,
+    ADD COLUMN fulfilmentStatus VARCHAR(32) NULL;
+
+-- Every order placed so far was delivered.
+UPDATE Orders SET fulfilmentType = 'delivery' WHERE fulfilmentType IS NULL;
@@ -0,0 +1,24 @@
+-- VAT rates by tax class, assigned to products and categories, and the
+-- rates frozen on each order.
+CREATE TABLE TaxClasses (
+    ID        INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    name      VARCHAR(255) NOT NULL,
+    rate      DECIMAL(5, 2) NOT NULL,
+    isDefault BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+ALTER TABLE Products ADD COLUMN taxClassID INT NULL;
+ALTER TABLE Categories ADD COLUMN taxClassID INT NULL;
+
+ALTER TABLE ProductOrders ADD COLUMN vatRate DECIMAL(5, 2) NULL;
+ALTER TABLE Orders ADD COLUMN shippingVATRate DECIMAL(5, 2) NULL;
+
+-- Existing lines and shipping are taxed at the default rate, if one has
+-- been set up by the time this runs, and untaxed otherwise.
+UPDATE ProductOrders
+SET vatRate = COALESCE((SELECT rate FROM TaxClasses WHERE isDefault = 1 LIMIT 1), 0)
+WHERE vatRate IS NULL;
+
+UPDATE Orders
+SET shippingVATRate = COALESCE((SELECT rate FROM TaxClasses WHERE isDefault = 1 LIMIT 1), 0)
+WHERE shippingVATRate IS NULL;
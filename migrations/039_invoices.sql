@@ -0,0 +1,18 @@
+-- Issued invoices and credit notes, numbered per series without gaps.
+CREATE TABLE Invoices (
+    ID              INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    kind            VARCHAR(16) NOT NULL,
+    series          VARCHAR(16) NOT NULL,
+    number          INT NOT NULL,
+    orderID         INT NOT NULL,
+    refundID        INT NULL,
+    issuedTimestamp INT NOT NULL,
+    document        MEDIUMBLOB NOT NULL,
+    UNIQUE (series, number),
+    INDEX (orderID)
+);
+
+CREATE TABLE InvoiceSeries (
+    series     VARCHAR(16) NOT NULL PRIMARY KEY,
+    nextNumber INT NOT NULL
+);
@@ -0,0 +1,5 @@
+-- SKUs identify products in catalog imports; existing products have none
+-- until an import or an admin assigns one.
+ALTER TABLE Products
+    ADD COLUMN sku VARCHAR(64) NULL,
+    ADD UNIQUE (sku);
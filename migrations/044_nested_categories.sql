@@ -0,0 +1,8 @@
+-- Categories nest under a parent category and inherit its tax class.
+ALTER TABLE Categories
+    ADD COLUMN parentID INT NULL,
+    ADD COLUMN effectiveTaxClassID INT NULL,
+    ADD INDEX (parentID);
+
+-- Every existing category is a top-level one, so it inherits nothing.
+UPDATE Categories SET effectiveTaxClassID = taxClassID;
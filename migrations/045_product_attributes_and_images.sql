@@ -0,0 +1,17 @@
+-- Typed product attributes and the ordered image gallery of each product.
+CREATE TABLE ProductAttributes (
+    productID INT NOT NULL,
+    name      VARCHAR(255) NOT NULL,
+    type      VARCHAR(16) NOT NULL,
+    value     TEXT NOT NULL,
+    unit      VARCHAR(32) NOT NULL,
+    INDEX (productID)
+);
+
+CREATE TABLE ProductImages (
+    productID INT NOT NULL,
+    url       VARCHAR(1024) NOT NULL,
+    altText   VARCHAR(255) NOT NULL,
+    position  INT NOT NULL,
+    INDEX (productID)
+);
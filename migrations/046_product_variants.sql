@@ -0,0 +1,17 @@
+-- Variants of a product with their own SKU, price and stock; lines without
+-- a variant are for the product itself.
+CREATE TABLE ProductVariants (
+    ID        INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    productID INT NOT NULL,
+    sku       VARCHAR(64) NOT NULL,
+    barcode   VARCHAR(64) NULL,
+    options   TEXT NOT NULL,
+    price     DECIMAL(10, 2) NOT NULL,
+    stock     INT NOT NULL DEFAULT 0,
+    UNIQUE (sku),
+    INDEX (productID)
+);
+
+ALTER TABLE CartProducts ADD COLUMN variantID INT NULL;
+ALTER TABLE ProductOrders ADD COLUMN variantID INT NULL;
+ALTER TABLE RefundedProducts ADD COLUMN variantID INT NULL;
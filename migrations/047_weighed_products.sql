@@ -0,0 +1,15 @@
+-- Products sold by weight or volume: fractional quantities and stock, the
+-- unit and step a product is sold in, and the weighed quantity of a line.
+ALTER TABLE Products
+    ADD COLUMN unit VARCHAR(8) NOT NULL DEFAULT 'piece',
+    ADD COLUMN quantityStep DECIMAL(10, 3) NOT NULL DEFAULT 1,
+    ADD COLUMN minQuantity DECIMAL(10, 3) NOT NULL DEFAULT 1,
+    MODIFY COLUMN stock DECIMAL(10, 3) NOT NULL DEFAULT 0;
+
+ALTER TABLE ProductVariants MODIFY COLUMN stock DECIMAL(10, 3) NOT NULL DEFAULT 0;
+ALTER TABLE CartProducts MODIFY COLUMN quantity DECIMAL(10, 3) NOT NULL;
+ALTER TABLE RefundedProducts MODIFY COLUMN quantity DECIMAL(10, 3) NOT NULL;
+
+ALTER TABLE ProductOrders
+    MODIFY COLUMN quantity DECIMAL(10, 3) NOT NULL,
+    ADD COLUMN actualQuantity DECIMAL(10, 3) NULL;
@@ -0,0 +1,36 @@
+-- Price changes, the ones scheduled ahead, and the unit price each order
+-- line was sold at.
+CREATE TABLE PriceHistory (
+    ID               INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    productID        INT NOT NULL,
+    variantID        INT NULL,
+    previousPrice    DECIMAL(10, 2) NOT NULL,
+    price            DECIMAL(10, 2) NOT NULL,
+    source           VARCHAR(16) NOT NULL,
+    scheduledPriceID INT NULL,
+    timestamp        INT NOT NULL,
+    INDEX (productID, timestamp)
+);
+
+CREATE TABLE ScheduledPrices (
+    ID             INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    productID      INT NOT NULL,
+    variantID      INT NULL,
+    price          DECIMAL(10, 2) NOT NULL,
+    previousPrice  DECIMAL(10, 2) NULL,
+    startTimestamp INT NOT NULL,
+    endTimestamp   INT NULL,
+    status         VARCHAR(16) NOT NULL,
+    INDEX (status, startTimestamp),
+    INDEX (productID)
+);
+
+ALTER TABLE ProductOrders ADD COLUMN unitPrice DECIMAL(10, 2) NULL;
+
+-- The price a line was sold at was never kept; the current price is the
+-- closest record there is.
+UPDATE ProductOrders po
+    JOIN Products p ON po.productID = p.ID
+    LEFT JOIN ProductVariants pv ON po.variantID = pv.ID
+SET po.unitPrice = COALESCE(pv.price, p.price)
+WHERE po.unitPrice IS NULL;
@@ -0,0 +1,17 @@
+-- Automatic promotions and the discount they gave each order line.
+CREATE TABLE Promotions (
+    ID             INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    name           VARCHAR(255) NOT NULL,
+    type           VARCHAR(32) NOT NULL,
+    priority       INT NOT NULL DEFAULT 0,
+    stackable      BOOLEAN NOT NULL DEFAULT FALSE,
+    active         BOOLEAN NOT NULL DEFAULT TRUE,
+    startTimestamp INT NULL,
+    endTimestamp   INT NULL,
+    rules          TEXT NOT NULL
+);
+
+-- Lines placed before promotions carry no discount.
+ALTER TABLE ProductOrders
+    ADD COLUMN promotionDiscount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    ADD COLUMN promotions TEXT NULL;
@@ -0,0 +1,65 @@
+package audit
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+// Diff compares the JSON representations of before and after, so the field
+// names in the audit log match the ones clients see. Either side may be nil.
+func Diff(before interface{}, after interface{}) ([]repositories.FieldChange, error) {
+	beforeFields, err := toFields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := toFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields []string
+	for field := range beforeFields {
+		fields = append(fields, field)
+	}
+	for field := range afterFields {
+		if _, ok := beforeFields[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	var changes []repositories.FieldChange
+	for _, field := range fields {
+		if !reflect.DeepEqual(beforeFields[field], afterFields[field]) {
+			changes = append(changes, repositories.FieldChange{
+				Field:  field,
+				Before: beforeFields[field],
+				After:  afterFields[field],
+			})
+		}
+	}
+
+	return changes, nil
+}
+
+func toFields(entity interface{}) (map[string]interface{}, error) {
+	fields := make(map[string]interface{})
+	if entity == nil {
+		return fields, nil
+	}
+
+	encoded, err := json.Marshal(entity)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(encoded, &fields)
+	if err != nil {
+		return nil, err
+	}
+
+	return fields, nil
+}
@@ -0,0 +1,252 @@
+package catalog
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/mariacalinoiu/smartket/src/audit"
+	"github.com/mariacalinoiu/smartket/src/datasources"
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+const (
+	CSVFormat  = "csv"
+	JSONFormat = "json"
+)
+
+var (
+	requiredColumns = []string{"sku", "department", "category", "name", "price"}
+	optionalColumns = []string{"description", "imageURL", "stock"}
+)
+
+// FormatOf guesses the format of a catalog file from its name or content type.
+func FormatOf(nameOrContentType string) string {
+	value := strings.ToLower(nameOrContentType)
+	if strings.Contains(value, "json") || filepath.Ext(value) == ".json" {
+		return JSONFormat
+	}
+
+	return CSVFormat
+}
+
+// Parse reads the catalog rows; an error is returned only when the file as a
+// whole can not be read, problems with single rows are reported per row.
+func Parse(reader io.Reader, format string) ([]repositories.CatalogRow, []repositories.ImportError, error) {
+	if format == JSONFormat {
+		return parseJSON(reader)
+	}
+
+	return parseCSV(reader)
+}
+
+func parseJSON(reader io.Reader) ([]repositories.CatalogRow, []repositories.ImportError, error) {
+	var rows []repositories.CatalogRow
+
+	err := json.NewDecoder(reader).Decode(&rows)
+	if err != nil {
+		return nil, nil, fmt.Errorf("the catalog is not a JSON list of products: %s", err.Error())
+	}
+	for i := range rows {
+		rows[i].Row = i + 1
+	}
+
+	return rows, nil, nil
+}
+
+func parseCSV(reader io.Reader) ([]repositories.CatalogRow, []repositories.ImportError, error) {
+	var rows []repositories.CatalogRow
+	var errs []repositories.ImportError
+
+	csvReader := csv.NewReader(reader)
+	csvReader.TrimLeadingSpace = true
+
+	header, err := csvReader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read the catalog header: %s", err.Error())
+	}
+
+	columns := make(map[string]int)
+	known := append(append([]string{}, requiredColumns...), optionalColumns...)
+	for i, name := range header {
+		column := ""
+		for _, candidate := range known {
+			if strings.EqualFold(strings.TrimSpace(name), candidate) {
+				column = candidate
+			}
+		}
+		if len(column) == 0 {
+			return nil, nil, fmt.Errorf("unknown catalog column '%s'", name)
+		}
+		columns[column] = i
+	}
+	for _, column := range requiredColumns {
+		if _, ok := columns[column]; !ok {
+			return nil, nil, fmt.Errorf("mandatory catalog column '%s' not found", column)
+		}
+	}
+
+	// the header is line 1, so data rows start at 2
+	for line := 2; ; line++ {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if _, ok := err.(*csv.ParseError); !ok {
+				return nil, nil, err
+			}
+			errs = append(errs, repositories.ImportError{Row: line, Message: err.Error()})
+			continue
+		}
+
+		value := func(column string) string {
+			i, ok := columns[column]
+			if !ok || i >= len(record) {
+				return ""
+			}
+
+			return strings.TrimSpace(record[i])
+		}
+
+		// optional columns left out of the file keep what the product has
+		optional := func(column string) *string {
+			if _, ok := columns[column]; !ok {
+				return nil
+			}
+			text := value(column)
+
+			return &text
+		}
+
+		row := repositories.CatalogRow{
+			Row:         line,
+			SKU:         value("sku"),
+			Department:  value("department"),
+			Category:    value("category"),
+			Name:        value("name"),
+			Description: optional("description"),
+			ImageURL:    optional("imageURL"),
+		}
+
+		price, err := strconv.ParseFloat(value("price"), 32)
+		if err != nil {
+			errs = append(errs, repositories.ImportError{Row: line, Field: "price", Message: "the price must be a number"})
+			continue
+		}
+		row.Price = float32(price)
+
+		if len(value("stock")) > 0 {
+			parsed, err := strconv.ParseFloat(value("stock"), 32)
+			if err != nil || parsed < 0 {
+				errs = append(errs, repositories.ImportError{Row: line, Field: "stock", Message: "the stock must be a positive number"})
+				continue
+			}
+			stock := float32(parsed)
+			row.Stock = &stock
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, errs, nil
+}
+
+func Validate(rows []repositories.CatalogRow) []repositories.ImportError {
+	var errs []repositories.ImportError
+
+	seen := make(map[string]int)
+	for _, row := range rows {
+		rowError := func(field string, message string) {
+			errs = append(errs, repositories.ImportError{Row: row.Row, Field: field, Message: message})
+		}
+
+		mandatory := []struct{ field, value string }{
+			{"sku", row.SKU},
+			{"department", row.Department},
+			{"category", row.Category},
+			{"name", row.Name},
+		}
+		for _, column := range mandatory {
+			if len(column.value) == 0 {
+				rowError(column.field, "the field is mandatory")
+			} else if len(column.value) > 255 {
+				rowError(column.field, "the field must have at most 255 characters")
+			}
+		}
+		for _, name := range strings.Split(row.Category, repositories.CategoryPathSeparator) {
+			if len(row.Category) > 0 && len(strings.TrimSpace(name)) == 0 {
+				rowError("category", "every level of the category path must have a name")
+				break
+			}
+		}
+		if firstRow, ok := seen[row.SKU]; ok && len(row.SKU) > 0 {
+			rowError("sku", fmt.Sprintf("the SKU is already used on row %d", firstRow))
+		}
+		seen[row.SKU] = row.Row
+
+		if row.Price <= 0 {
+			rowError("price", "the price must be positive")
+		}
+		if row.Stock != nil && *row.Stock < 0 {
+			rowError("stock", "the stock can not be negative")
+		}
+		if row.ImageURL != nil && len(*row.ImageURL) > 0 {
+			imageURL, err := url.Parse(*row.ImageURL)
+			if err != nil || (imageURL.Scheme != "http" && imageURL.Scheme != "https") || len(imageURL.Host) == 0 {
+				rowError("imageURL", "the image URL must be an absolute http(s) URL")
+			}
+		}
+	}
+
+	return errs
+}
+
+// Import applies the rows unless any of them is invalid, in which case the
+// report only lists the errors and nothing is written.
+func Import(db datasources.DBClient, rows []repositories.CatalogRow, parseErrs []repositories.ImportError, dryRun bool, actor string, logger *log.Logger) (repositories.ImportReport, error) {
+	report := repositories.ImportReport{
+		DryRun: dryRun,
+		Rows:   len(rows) + len(parseErrs),
+		Errors: append(parseErrs, Validate(rows)...),
+	}
+	if len(report.Errors) > 0 || len(rows) == 0 {
+		return report, nil
+	}
+
+	changes, err := db.ImportCatalog(rows, dryRun)
+	if err != nil {
+		return report, err
+	}
+	report.Changes = changes
+
+	if !dryRun {
+		for _, change := range changes {
+			recordChange(db, change, actor, logger)
+		}
+	}
+
+	return report, nil
+}
+
+func recordChange(db datasources.DBClient, change repositories.ImportChange, actor string, logger *log.Logger) {
+	changes, err := audit.Diff(nil, change)
+	if err == nil {
+		err = db.InsertAuditEntry(repositories.AuditEntry{
+			Actor:     actor,
+			Entity:    change.Entity,
+			EntityID:  change.EntityID,
+			Operation: change.Operation,
+			Changes:   changes,
+		})
+	}
+	if err != nil {
+		logger.Printf("Audit error: %s; Entity: %s %d", err.Error(), change.Entity, change.EntityID)
+	}
+}
@@ -0,0 +1,200 @@
+package datasources
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+// SetProductAttributes replaces all the attributes of the product; values are
+// stored as JSON, whatever their type.
+func (client DBClient) SetProductAttributes(productID int, attributes []repositories.ProductAttribute) error {
+	tx, err := client.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM ProductAttributes WHERE productID = ?", productID)
+	if err != nil {
+		return err
+	}
+
+	for _, attribute := range attributes {
+		value, err := json.Marshal(attribute.Value)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(
+			"INSERT INTO ProductAttributes(productID, name, type, value, unit) VALUES(?, ?, ?, ?, ?)",
+			productID,
+			attribute.Name,
+			attribute.Type,
+			string(value),
+			nullableString(attribute.Unit),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec("UPDATE Products SET version = version + 1 WHERE ID = ?", productID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SetProductImages replaces the gallery of the product; the first image also
+// becomes its imageURL.
+func (client DBClient) SetProductImages(productID int, images []repositories.ProductImage) error {
+	tx, err := client.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM ProductImages WHERE productID = ?", productID)
+	if err != nil {
+		return err
+	}
+
+	for position, image := range images {
+		_, err = tx.Exec(
+			"INSERT INTO ProductImages(productID, url, altText, position) VALUES(?, ?, ?, ?)",
+			productID,
+			image.URL,
+			nullableString(image.AltText),
+			position,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(images) > 0 {
+		_, err = tx.Exec("UPDATE Products SET imageURL = ?, version = version + 1 WHERE ID = ?", images[0].URL, productID)
+	} else {
+		_, err = tx.Exec("UPDATE Products SET version = version + 1 WHERE ID = ?", productID)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// withDetails loads the attributes, the images, the variants and the active
+// promotions of the products, in one query each.
+func (client DBClient) withDetails(products []repositories.Product) ([]repositories.Product, error) {
+	if len(products) == 0 {
+		return products, nil
+	}
+
+	positions := make(map[int]int, len(products))
+	args := make([]interface{}, len(products))
+	for i, product := range products {
+		positions[product.ID] = i
+		args[i] = product.ID
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(products)), ", ")
+
+	err := client.getAttributes(products, positions, placeholders, args)
+	if err != nil {
+		return products, err
+	}
+
+	err = client.getImages(products, positions, placeholders, args)
+	if err != nil {
+		return products, err
+	}
+
+	err = client.withVariants(products, positions, placeholders, args)
+	if err != nil {
+		return products, err
+	}
+
+	err = client.withPromotions(products, positions, placeholders, args)
+	if err != nil {
+		return products, err
+	}
+
+	return products, nil
+}
+
+func (client DBClient) getAttributes(products []repositories.Product, positions map[int]int, placeholders string, args []interface{}) error {
+	var (
+		productID     int
+		name          string
+		attributeType string
+		value         string
+		unit          *string
+	)
+
+	rows, err := client.db.Query(
+		"SELECT productID, name, type, value, unit FROM ProductAttributes WHERE productID IN ("+placeholders+") ORDER BY productID, name",
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		err := rows.Scan(&productID, &name, &attributeType, &value, &unit)
+		if err != nil {
+			return err
+		}
+
+		attribute := repositories.ProductAttribute{Name: name, Type: attributeType}
+		if unit != nil {
+			attribute.Unit = *unit
+		}
+		err = json.Unmarshal([]byte(value), &attribute.Value)
+		if err != nil {
+			return err
+		}
+
+		i := positions[productID]
+		products[i].Attributes = append(products[i].Attributes, attribute)
+	}
+
+	return rows.Err()
+}
+
+func (client DBClient) getImages(products []repositories.Product, positions map[int]int, placeholders string, args []interface{}) error {
+	var (
+		productID int
+		url       string
+		altText   *string
+		position  int
+	)
+
+	rows, err := client.db.Query(
+		"SELECT productID, url, altText, position FROM ProductImages WHERE productID IN ("+placeholders+") ORDER BY productID, position",
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		err := rows.Scan(&productID, &url, &altText, &position)
+		if err != nil {
+			return err
+		}
+
+		i := positions[productID]
+		image := repositories.ProductImage{URL: url, Position: position}
+		if altText != nil {
+			image.AltText = *altText
+		}
+		products[i].Images = append(products[i].Images, image)
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,136 @@
+package datasources
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/mariacalinoiu/smartket/src/audit"
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+func (client DBClient) InsertAuditEntry(entry repositories.AuditEntry) error {
+	return insertAuditEntry(client.db, entry)
+}
+
+// recordSystemChange audits, in the caller's transaction, a change made by
+// the server itself rather than on behalf of a request.
+func recordSystemChange(db execer, entity string, entityID int, operation string, before interface{}, after interface{}) error {
+	changes, err := audit.Diff(before, after)
+	if err != nil {
+		return err
+	}
+
+	return insertAuditEntry(db, repositories.AuditEntry{
+		Actor:     repositories.SystemActor,
+		Entity:    entity,
+		EntityID:  entityID,
+		Operation: operation,
+		Changes:   changes,
+	})
+}
+
+func insertAuditEntry(db execer, entry repositories.AuditEntry) error {
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(
+		"INSERT INTO AuditLog(actor, entity, entityID, operation, changes, timestamp) VALUES(?, ?, ?, ?, ?, ?)",
+		entry.Actor,
+		entry.Entity,
+		entry.EntityID,
+		entry.Operation,
+		string(changes),
+		int(time.Now().UnixNano()/1000000000),
+	)
+
+	return err
+}
+
+func (client DBClient) GetAuditEntries(filter repositories.AuditFilter) (repositories.AuditEntriesJSON, error) {
+	var (
+		entries   []repositories.AuditEntry
+		id        int
+		actor     string
+		entity    string
+		entityID  int
+		operation string
+		changes   string
+		timestamp int
+
+		conditions []string
+		args       []interface{}
+	)
+
+	if len(filter.Actor) > 0 {
+		conditions = append(conditions, "actor = ?")
+		args = append(args, filter.Actor)
+	}
+	if len(filter.Entity) > 0 {
+		conditions = append(conditions, "entity = ?")
+		args = append(args, filter.Entity)
+	}
+	if filter.EntityID > 0 {
+		conditions = append(conditions, "entityID = ?")
+		args = append(args, filter.EntityID)
+	}
+	if len(filter.Operation) > 0 {
+		conditions = append(conditions, "operation = ?")
+		args = append(args, filter.Operation)
+	}
+	if filter.From > 0 {
+		conditions = append(conditions, "timestamp >= ?")
+		args = append(args, filter.From)
+	}
+	if filter.To > 0 {
+		conditions = append(conditions, "timestamp <= ?")
+		args = append(args, filter.To)
+	}
+
+	query := "SELECT ID, actor, entity, entityID, operation, changes, timestamp FROM AuditLog"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	rows, err := client.db.Query(query+" ORDER BY ID", args...)
+	if err != nil {
+		return repositories.AuditEntriesJSON{AuditEntries: entries}, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		err := rows.Scan(&id, &actor, &entity, &entityID, &operation, &changes, &timestamp)
+		if err != nil {
+			return repositories.AuditEntriesJSON{AuditEntries: entries}, err
+		}
+
+		var fieldChanges []repositories.FieldChange
+		err = json.Unmarshal([]byte(changes), &fieldChanges)
+		if err != nil {
+			return repositories.AuditEntriesJSON{AuditEntries: entries}, err
+		}
+
+		entries = append(
+			entries,
+			repositories.AuditEntry{
+				ID:        id,
+				Actor:     actor,
+				Entity:    entity,
+				EntityID:  entityID,
+				Operation: operation,
+				Changes:   fieldChanges,
+				Timestamp: timestamp,
+				Date:      ParseTimestamp(timestamp),
+			},
+		)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return repositories.AuditEntriesJSON{AuditEntries: entries}, err
+	}
+
+	return repositories.AuditEntriesJSON{AuditEntries: entries}, nil
+}
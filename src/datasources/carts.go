@@ -0,0 +1,369 @@
+package datasources
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+func (client DBClient) GetCarts(cartIDProvided ...int) (repositories.CartsJSON, error) {
+	var (
+		cartRows *sql.Rows
+		err      error
+
+		carts     []repositories.Cart
+		cartID    int
+		email     string
+		timestamp int
+	)
+
+	query := "SELECT ID, email, timestamp FROM Carts"
+
+	if len(cartIDProvided) == 1 {
+		cartRows, err = client.db.Query(query+" WHERE ID = ?", cartIDProvided[0])
+	} else {
+		cartRows, err = client.db.Query(query)
+	}
+	if err != nil {
+		return repositories.CartsJSON{Carts: carts}, err
+	}
+
+	defer cartRows.Close()
+	for cartRows.Next() {
+		err := cartRows.Scan(&cartID, &email, &timestamp)
+		if err != nil {
+			return repositories.CartsJSON{Carts: carts}, err
+		}
+
+		carts = append(
+			carts,
+			repositories.Cart{
+				ID:        cartID,
+				Email:     email,
+				Timestamp: timestamp,
+				Date:      ParseTimestamp(timestamp),
+			},
+		)
+	}
+
+	err = cartRows.Err()
+	if err != nil {
+		return repositories.CartsJSON{Carts: carts}, err
+	}
+
+	for i := range carts {
+		carts[i].ProductsInCart, err = client.getCartProducts(carts[i].ID)
+		if err != nil {
+			return repositories.CartsJSON{Carts: carts}, err
+		}
+	}
+
+	return repositories.CartsJSON{Carts: carts}, nil
+}
+
+func (client DBClient) InsertCart(cart repositories.Cart) (repositories.CartIDResponse, error) {
+	stmt, err := client.db.Prepare("INSERT INTO Carts(email, timestamp) VALUES(?, ?)")
+	if err != nil {
+		return repositories.CartIDResponse{CartID: 0}, err
+	}
+
+	res, err := stmt.Exec(
+		cart.Email,
+		int(time.Now().UnixNano()/1000000000),
+	)
+	if err != nil {
+		return repositories.CartIDResponse{CartID: 0}, err
+	}
+
+	cartID, err := res.LastInsertId()
+	if err != nil {
+		return repositories.CartIDResponse{CartID: 0}, err
+	}
+
+	err = client.insertCartProducts(int(cartID), cart.ProductsInCart)
+	if err != nil {
+		return repositories.CartIDResponse{CartID: 0}, err
+	}
+
+	return repositories.CartIDResponse{CartID: int(cartID)}, nil
+}
+
+func (client DBClient) EditCart(cart repositories.Cart) error {
+	res, err := client.db.Exec(
+		"UPDATE Carts SET email = ?, timestamp = ? WHERE ID = ?",
+		cart.Email,
+		int(time.Now().UnixNano()/1000000000),
+		cart.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errors.New("the cart provided does not exist")
+	}
+
+	_, err = client.db.Exec(
+		"DELETE FROM CartProducts WHERE cartID = ?",
+		cart.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return client.insertCartProducts(cart.ID, cart.ProductsInCart)
+}
+
+func (client DBClient) DeleteCart(cartID int) error {
+	_, err := client.db.Exec(
+		"DELETE FROM CartProducts WHERE cartID = ?",
+		cartID,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.db.Exec(
+		"DELETE FROM Carts WHERE ID = ?",
+		cartID,
+	)
+
+	return err
+}
+
+func (client DBClient) GetIdleCarts(idleSince int) (repositories.CartsJSON, error) {
+	var (
+		carts     []repositories.Cart
+		cartID    int
+		email     string
+		timestamp int
+	)
+
+	rows, err := client.db.Query(`
+			SELECT ID, email, timestamp
+			FROM Carts
+			WHERE timestamp <= ? AND (abandonedTimestamp IS NULL OR abandonedTimestamp < timestamp)
+		`,
+		idleSince,
+	)
+	if err != nil {
+		return repositories.CartsJSON{Carts: carts}, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		err := rows.Scan(&cartID, &email, &timestamp)
+		if err != nil {
+			return repositories.CartsJSON{Carts: carts}, err
+		}
+
+		carts = append(
+			carts,
+			repositories.Cart{
+				ID:        cartID,
+				Email:     email,
+				Timestamp: timestamp,
+				Date:      ParseTimestamp(timestamp),
+			},
+		)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return repositories.CartsJSON{Carts: carts}, err
+	}
+
+	for i := range carts {
+		carts[i].ProductsInCart, err = client.getCartProducts(carts[i].ID)
+		if err != nil {
+			return repositories.CartsJSON{Carts: carts}, err
+		}
+	}
+
+	return repositories.CartsJSON{Carts: carts}, nil
+}
+
+func (client DBClient) InsertAbandonedCartEvent(event repositories.AbandonedCartEvent) error {
+	timestamp := int(time.Now().UnixNano() / 1000000000)
+
+	_, err := client.db.Exec(
+		"INSERT INTO AbandonedCartEvents(cartID, email, notified, timestamp) VALUES(?, ?, ?, ?)",
+		event.CartID,
+		event.Email,
+		event.Notified,
+		timestamp,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.db.Exec(
+		"UPDATE Carts SET abandonedTimestamp = ? WHERE ID = ?",
+		timestamp,
+		event.CartID,
+	)
+
+	return err
+}
+
+func (client DBClient) GetNotificationPreference(email string) (repositories.NotificationPreference, error) {
+	var (
+		optOut bool
+		token  *string
+	)
+
+	err := client.db.QueryRow(
+		"SELECT optOut, token FROM NotificationPreferences WHERE email = ?",
+		email,
+	).Scan(&optOut, &token)
+	if err == sql.ErrNoRows {
+		return repositories.NotificationPreference{Email: email, OptOut: false}, nil
+	}
+	if err != nil {
+		return repositories.NotificationPreference{Email: email}, err
+	}
+
+	preference := repositories.NotificationPreference{Email: email, OptOut: optOut}
+	if token != nil {
+		preference.Token = *token
+	}
+
+	return preference, nil
+}
+
+// NotificationToken returns the token the customer changes their notification
+// preference with, creating it the first time they are sent a reminder.
+func (client DBClient) NotificationToken(email string) (string, error) {
+	token, err := newNotificationToken()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = client.db.Exec(
+		"INSERT INTO NotificationPreferences(email, optOut, token) VALUES(?, FALSE, ?) ON DUPLICATE KEY UPDATE token = COALESCE(token, VALUES(token))",
+		email,
+		token,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	preference, err := client.GetNotificationPreference(email)
+
+	return preference.Token, err
+}
+
+func (client DBClient) SetNotificationPreference(preference repositories.NotificationPreference) error {
+	_, err := client.db.Exec(
+		"INSERT INTO NotificationPreferences(email, optOut) VALUES(?, ?) ON DUPLICATE KEY UPDATE optOut = VALUES(optOut)",
+		preference.Email,
+		preference.OptOut,
+	)
+
+	return err
+}
+
+func (client DBClient) insertCartProducts(cartID int, products []repositories.CartProduct) error {
+	stmt, err := client.db.Prepare("INSERT INTO CartProducts(cartID, productID, variantID, quantity) VALUES(?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+
+	for _, product := range products {
+		_, err = stmt.Exec(
+			cartID,
+			product.ProductID,
+			nullableInt(product.VariantID),
+			product.Quantity,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (client DBClient) getCartProducts(cartID int) ([]repositories.CartProduct, error) {
+	var (
+		products    []repositories.CartProduct
+		productID   int
+		variantID   *int
+		quantity    float32
+		name        string
+		imageURL    string
+		description string
+		price       float32
+		unit        string
+		categoryID  int
+	)
+
+	rows, err := client.db.Query(`
+			SELECT cp.productID, cp.variantID, cp.quantity, p.name, p.imageURL, p.description, p.price, p.unit, p.categoryID
+			FROM CartProducts cp, Products p
+			WHERE cp.productID = p.ID AND cp.cartID = ?
+		`,
+		cartID,
+	)
+	if err != nil {
+		return products, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		err := rows.Scan(&productID, &variantID, &quantity, &name, &imageURL, &description, &price, &unit, &categoryID)
+		if err != nil {
+			return products, err
+		}
+
+		product := repositories.CartProduct{
+			ProductID: productID,
+			CartID:    cartID,
+			Quantity:  quantity,
+			Product: repositories.Product{
+				ID:          productID,
+				Name:        name,
+				ImageURL:    imageURL,
+				Description: description,
+				Price:       price,
+				Unit:        unit,
+				CategoryID:  categoryID,
+			},
+		}
+		if variantID != nil {
+			product.VariantID = *variantID
+		}
+
+		products = append(products, product)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return products, err
+	}
+
+	err = client.withCartVariants(products)
+	if err != nil {
+		return products, err
+	}
+
+	return products, nil
+}
+
+func newNotificationToken() (string, error) {
+	token := make([]byte, 16)
+	_, err := rand.Read(token)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(token), nil
+}
@@ -0,0 +1,216 @@
+package datasources
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+// ImportCatalog upserts the rows in a single transaction: departments and
+// categories by name, products by SKU. On a dry run the transaction is rolled
+// back, so the changes only report what the import would do.
+func (client DBClient) ImportCatalog(rows []repositories.CatalogRow, dryRun bool) ([]repositories.ImportChange, error) {
+	var changes []repositories.ImportChange
+
+	tx, err := client.db.Begin()
+	if err != nil {
+		return changes, err
+	}
+	defer tx.Rollback()
+
+	departments := make(map[string]int)
+	categories := make(map[string]int)
+	for _, row := range rows {
+		departmentID, ok := departments[row.Department]
+		if !ok {
+			var created bool
+			departmentID, created, err = upsertByName(tx, "SELECT ID FROM Departments WHERE name = ?", "INSERT INTO Departments(name) VALUES(?)", row.Department)
+			if err != nil {
+				return changes, err
+			}
+			if created {
+				changes = append(changes, importChange(row, repositories.DepartmentEntity, departmentID, row.Department, dryRun))
+			}
+			departments[row.Department] = departmentID
+		}
+
+		// a category written as "Parent > Child" is created under its parent
+		categoryID := 0
+		categoryKey := row.Department
+		for _, name := range strings.Split(row.Category, repositories.CategoryPathSeparator) {
+			name = strings.TrimSpace(name)
+			categoryKey += "/" + name
+
+			parentID := categoryID
+			var ok bool
+			categoryID, ok = categories[categoryKey]
+			if ok {
+				continue
+			}
+
+			var created bool
+			categoryID, created, err = upsertByName(
+				tx,
+				"SELECT ID FROM Categories WHERE name = ? AND departmentID = ? AND parentID <=> ?",
+				"INSERT INTO Categories(name, departmentID, parentID) VALUES(?, ?, ?)",
+				name, departmentID, nullableInt(parentID),
+			)
+			if err != nil {
+				return changes, err
+			}
+			if created {
+				changes = append(changes, importChange(row, repositories.CategoryEntity, categoryID, categoryKey, dryRun))
+			}
+			categories[categoryKey] = categoryID
+		}
+
+		change, err := upsertProduct(tx, row, categoryID)
+		if err != nil {
+			return changes, err
+		}
+		if dryRun {
+			change.EntityID = 0
+		}
+		changes = append(changes, change)
+	}
+
+	if dryRun {
+		return changes, nil
+	}
+
+	err = refreshEffectiveTaxClasses(tx)
+	if err != nil {
+		return changes, err
+	}
+
+	return changes, tx.Commit()
+}
+
+// upsertByName returns the ID of the row found by selectQuery, inserting it
+// first when it does not exist yet.
+func upsertByName(tx transaction, selectQuery string, insertQuery string, args ...interface{}) (int, bool, error) {
+	var id int
+
+	err := tx.QueryRow(selectQuery+" FOR UPDATE", args...).Scan(&id)
+	if err == nil {
+		return id, false, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, false, err
+	}
+
+	res, err := tx.Exec(insertQuery, args...)
+	if err != nil {
+		return 0, false, err
+	}
+
+	insertedID, err := res.LastInsertId()
+	if err != nil {
+		return 0, false, err
+	}
+
+	return int(insertedID), true, nil
+}
+
+func upsertProduct(tx transaction, row repositories.CatalogRow, categoryID int) (repositories.ImportChange, error) {
+	var (
+		productID     int
+		previousPrice float32
+	)
+
+	change := repositories.ImportChange{Row: row.Row, Entity: repositories.ProductEntity, Key: row.SKU}
+
+	err := tx.QueryRow("SELECT ID, price FROM Products WHERE sku = ? FOR UPDATE", row.SKU).Scan(&productID, &previousPrice)
+	if err == sql.ErrNoRows {
+		stock := float32(0)
+		if row.Stock != nil {
+			stock = *row.Stock
+		}
+		imageURL, description := "", ""
+		if row.ImageURL != nil {
+			imageURL = *row.ImageURL
+		}
+		if row.Description != nil {
+			description = *row.Description
+		}
+
+		res, err := tx.Exec(
+			"INSERT INTO Products(sku, name, imageURL, description, price, stock, categoryID) VALUES(?, ?, ?, ?, ?, ?, ?)",
+			row.SKU,
+			row.Name,
+			imageURL,
+			description,
+			row.Price,
+			stock,
+			categoryID,
+		)
+		if err != nil {
+			return change, err
+		}
+
+		insertedID, err := res.LastInsertId()
+		if err != nil {
+			return change, err
+		}
+
+		change.EntityID = int(insertedID)
+		change.Operation = repositories.CreateOperation
+
+		return change, nil
+	}
+	if err != nil {
+		return change, err
+	}
+
+	// the optional fields left out of the import keep their current values
+	var stock, imageURL, description interface{}
+	if row.Stock != nil {
+		stock = *row.Stock
+	}
+	if row.ImageURL != nil {
+		imageURL = *row.ImageURL
+	}
+	if row.Description != nil {
+		description = *row.Description
+	}
+
+	_, err = tx.Exec(
+		"UPDATE Products SET name = ?, imageURL = COALESCE(?, imageURL), description = COALESCE(?, description), price = ?, stock = COALESCE(?, stock), categoryID = ?, version = version + 1 WHERE ID = ?",
+		row.Name,
+		imageURL,
+		description,
+		row.Price,
+		stock,
+		categoryID,
+		productID,
+	)
+	if err != nil {
+		return change, err
+	}
+
+	err = recordPriceChange(tx, productID, 0, previousPrice, row.Price, repositories.ImportPriceSource, 0, int(time.Now().UnixNano()/1000000000))
+	if err != nil {
+		return change, err
+	}
+
+	change.EntityID = productID
+	change.Operation = repositories.UpdateOperation
+
+	return change, nil
+}
+
+func importChange(row repositories.CatalogRow, entity string, entityID int, key string, dryRun bool) repositories.ImportChange {
+	if dryRun {
+		entityID = 0
+	}
+
+	return repositories.ImportChange{
+		Row:       row.Row,
+		Entity:    entity,
+		EntityID:  entityID,
+		Operation: repositories.CreateOperation,
+		Key:       key,
+	}
+}
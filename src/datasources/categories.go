@@ -0,0 +1,390 @@
+package datasources
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+var ErrCategoryCycle = errors.New("a category can not be moved under itself or one of its descendants")
+
+// categoryTree indexes the categories by ID and by parent; top level
+// categories are the children of 0.
+type categoryTree struct {
+	categories map[int]repositories.Category
+	children   map[int][]int
+}
+
+func (client DBClient) GetCategories(categoryIDProvided ...int) (repositories.CategoriesJSON, error) {
+	if len(categoryIDProvided) == 1 {
+		return client.getCategories("WHERE ID = ?", categoryIDProvided[0])
+	}
+
+	return client.getCategories("")
+}
+
+func (client DBClient) GetCatalogTree() (repositories.CatalogTreeJSON, error) {
+	departments, err := client.GetDepartments()
+	if err != nil {
+		return repositories.CatalogTreeJSON{}, err
+	}
+
+	tree, err := client.getCategoryTree()
+	if err != nil {
+		return repositories.CatalogTreeJSON{}, err
+	}
+
+	byDepartment := make(map[int][]repositories.CategoryNode)
+	for _, categoryID := range tree.children[0] {
+		category := tree.categories[categoryID]
+		byDepartment[category.DepartmentId] = append(byDepartment[category.DepartmentId], tree.node(categoryID))
+	}
+
+	nodes := []repositories.DepartmentNode{}
+	for _, department := range departments.Departments {
+		categories := byDepartment[department.ID]
+		if categories == nil {
+			categories = []repositories.CategoryNode{}
+		}
+		nodes = append(nodes, repositories.DepartmentNode{Department: department, Categories: categories})
+	}
+
+	return repositories.CatalogTreeJSON{Departments: nodes}, nil
+}
+
+// GetProductsInCategoryTree returns the products in the category and in all
+// of its descendants.
+func (client DBClient) GetProductsInCategoryTree(categoryID int) (repositories.ProductsJSON, error) {
+	tree, err := client.getCategoryTree()
+	if err != nil {
+		return repositories.ProductsJSON{}, err
+	}
+
+	categoryIDs := tree.descendants(categoryID)
+	args := make([]interface{}, len(categoryIDs))
+	for i, id := range categoryIDs {
+		args[i] = id
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(categoryIDs)), ", ")
+
+	return client.getProducts("WHERE p.categoryID IN ("+placeholders+")", args...)
+}
+
+func (client DBClient) InsertCategory(category repositories.Category) (repositories.CategoryIDResponse, error) {
+	tx, err := client.db.Begin()
+	if err != nil {
+		return repositories.CategoryIDResponse{CategoryID: 0}, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		"INSERT INTO Categories(name, departmentID, parentID) VALUES(?, ?, ?)",
+		category.Name,
+		category.DepartmentId,
+		nullableInt(category.ParentID),
+	)
+	if err != nil {
+		return repositories.CategoryIDResponse{CategoryID: 0}, err
+	}
+
+	categoryID, err := res.LastInsertId()
+	if err != nil {
+		return repositories.CategoryIDResponse{CategoryID: 0}, err
+	}
+
+	err = refreshEffectiveTaxClasses(tx)
+	if err != nil {
+		return repositories.CategoryIDResponse{CategoryID: 0}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return repositories.CategoryIDResponse{CategoryID: 0}, err
+	}
+
+	return repositories.CategoryIDResponse{CategoryID: int(categoryID)}, nil
+}
+
+// EditCategory renames or moves the category when it is still at
+// category.Version; its descendants follow it to the department of its new
+// parent. The categories are locked while the move is checked, so two moves
+// can not build a cycle together.
+func (client DBClient) EditCategory(category repositories.Category) error {
+	tx, err := client.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	tree, versions, err := lockCategoryTree(tx)
+	if err != nil {
+		return err
+	}
+	if version, ok := versions[category.ID]; !ok || version != category.Version {
+		return ErrVersionConflict
+	}
+
+	descendants := tree.descendants(category.ID)
+	for _, descendantID := range descendants {
+		if descendantID == category.ParentID {
+			return ErrCategoryCycle
+		}
+	}
+
+	_, err = tx.Exec(
+		"UPDATE Categories SET name = ?, departmentID = ?, parentID = ?, version = version + 1 WHERE ID = ?",
+		category.Name,
+		category.DepartmentId,
+		nullableInt(category.ParentID),
+		category.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, descendantID := range descendants[1:] {
+		_, err = tx.Exec(
+			"UPDATE Categories SET departmentID = ?, version = version + 1 WHERE ID = ? AND departmentID <> ?",
+			category.DepartmentId,
+			descendantID,
+			category.DepartmentId,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = refreshEffectiveTaxClasses(tx)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// lockCategoryTree reads the parent links of all the categories, locking them
+// until tx ends, along with their versions.
+func lockCategoryTree(tx transaction) (categoryTree, map[int]int, error) {
+	var (
+		id       int
+		parentID *int
+		version  int
+	)
+
+	tree := categoryTree{
+		categories: make(map[int]repositories.Category),
+		children:   make(map[int][]int),
+	}
+	versions := make(map[int]int)
+
+	rows, err := tx.Query("SELECT ID, parentID, version FROM Categories FOR UPDATE")
+	if err != nil {
+		return tree, versions, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		err := rows.Scan(&id, &parentID, &version)
+		if err != nil {
+			return tree, versions, err
+		}
+
+		category := repositories.Category{ID: id, Version: version}
+		if parentID != nil {
+			category.ParentID = *parentID
+		}
+		tree.categories[id] = category
+		versions[id] = version
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return tree, versions, err
+	}
+
+	for _, category := range tree.categories {
+		tree.children[category.ParentID] = append(tree.children[category.ParentID], category.ID)
+	}
+
+	return tree, versions, nil
+}
+
+// refreshEffectiveTaxClasses saves on every category the tax class its
+// products fall back to: its own, or else the nearest one up its parents.
+// It runs whenever categories are added or moved or their tax classes change.
+func refreshEffectiveTaxClasses(tx transaction) error {
+	type taxLinks struct {
+		parentID   int
+		taxClassID *int
+		effective  *int
+	}
+
+	var (
+		id         int
+		parentID   *int
+		taxClassID *int
+		effective  *int
+	)
+
+	categories := make(map[int]taxLinks)
+	rows, err := tx.Query("SELECT ID, parentID, taxClassID, effectiveTaxClassID FROM Categories")
+	if err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		err := rows.Scan(&id, &parentID, &taxClassID, &effective)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+
+		links := taxLinks{taxClassID: taxClassID, effective: effective}
+		if parentID != nil {
+			links.parentID = *parentID
+		}
+		categories[id] = links
+	}
+	rows.Close()
+
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+
+	for categoryID, links := range categories {
+		var inherited *int
+		visited := make(map[int]bool)
+		ancestorID, ancestor, ok := categoryID, links, true
+		for ok && !visited[ancestorID] {
+			if ancestor.taxClassID != nil {
+				inherited = ancestor.taxClassID
+				break
+			}
+			visited[ancestorID] = true
+			ancestorID = ancestor.parentID
+			ancestor, ok = categories[ancestorID]
+		}
+
+		if sameTaxClass(inherited, links.effective) {
+			continue
+		}
+		_, err = tx.Exec(
+			"UPDATE Categories SET effectiveTaxClassID = ? WHERE ID = ?",
+			inherited,
+			categoryID,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (client DBClient) getCategoryTree() (categoryTree, error) {
+	tree := categoryTree{
+		categories: make(map[int]repositories.Category),
+		children:   make(map[int][]int),
+	}
+
+	categories, err := client.GetCategories()
+	if err != nil {
+		return tree, err
+	}
+
+	for _, category := range categories.Categories {
+		tree.categories[category.ID] = category
+	}
+	for _, category := range categories.Categories {
+		parentID := category.ParentID
+		if _, ok := tree.categories[parentID]; !ok {
+			parentID = 0
+		}
+		tree.children[parentID] = append(tree.children[parentID], category.ID)
+	}
+
+	return tree, nil
+}
+
+// withBreadcrumbs sets on every product the path from its department down to
+// its category.
+func (client DBClient) withBreadcrumbs(products []repositories.Product) ([]repositories.Product, error) {
+	if len(products) == 0 {
+		return products, nil
+	}
+
+	tree, err := client.getCategoryTree()
+	if err != nil {
+		return products, err
+	}
+
+	departments, err := client.GetDepartments()
+	if err != nil {
+		return products, err
+	}
+
+	departmentNames := make(map[int]string)
+	for _, department := range departments.Departments {
+		departmentNames[department.ID] = department.Name
+	}
+
+	for i := range products {
+		products[i].Breadcrumbs = tree.breadcrumbs(products[i].CategoryID, departmentNames)
+	}
+
+	return products, nil
+}
+
+func (tree categoryTree) node(categoryID int) repositories.CategoryNode {
+	node := repositories.CategoryNode{Category: tree.categories[categoryID], Children: []repositories.CategoryNode{}}
+	for _, childID := range tree.children[categoryID] {
+		node.Children = append(node.Children, tree.node(childID))
+	}
+
+	return node
+}
+
+// descendants returns the category followed by all the categories under it.
+func (tree categoryTree) descendants(categoryID int) []int {
+	categoryIDs := []int{categoryID}
+	seen := map[int]bool{categoryID: true}
+	for i := 0; i < len(categoryIDs); i++ {
+		for _, childID := range tree.children[categoryIDs[i]] {
+			if !seen[childID] {
+				seen[childID] = true
+				categoryIDs = append(categoryIDs, childID)
+			}
+		}
+	}
+
+	return categoryIDs
+}
+
+func (tree categoryTree) breadcrumbs(categoryID int, departmentNames map[int]string) []repositories.Breadcrumb {
+	var path []repositories.Breadcrumb
+	visited := make(map[int]bool)
+
+	category, ok := tree.categories[categoryID]
+	for ok && !visited[category.ID] {
+		visited[category.ID] = true
+		path = append([]repositories.Breadcrumb{{ID: category.ID, Name: category.Name, Kind: repositories.CategoryBreadcrumb}}, path...)
+		category, ok = tree.categories[category.ParentID]
+	}
+
+	if category, ok := tree.categories[categoryID]; ok {
+		department := repositories.Breadcrumb{ID: category.DepartmentId, Name: departmentNames[category.DepartmentId], Kind: repositories.DepartmentBreadcrumb}
+		path = append([]repositories.Breadcrumb{department}, path...)
+	}
+
+	return path
+}
+
+func sameTaxClass(a *int, b *int) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	return *a == *b
+}
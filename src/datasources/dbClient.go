@@ -2,16 +2,23 @@ package datasources
 
 import (
 	"database/sql"
-	"database/sql/driver"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/mariacalinoiu/smartket/src/payments"
 	"github.com/mariacalinoiu/smartket/src/repositories"
 )
 
+var (
+	ErrVersionConflict = errors.New("the entity was modified since the provided version")
+	ErrProductNotFound = errors.New("the product provided does not exist")
+)
+
 type DBClient struct {
-	db *sql.DB
+	db conn
 }
 
 func GetClient(user string, password string, dbName string) DBClient {
@@ -27,10 +34,67 @@ func GetClient(user string, password string, dbName string) DBClient {
 	db.SetMaxOpenConns(100)
 	db.SetMaxIdleConns(100)
 
-	return DBClient{db: db}
+	return DBClient{db: database{db}}
 }
 
 func (client DBClient) GetProductsByCategoryID(categoryID int) (repositories.ProductsJSON, error) {
+	return client.getProducts("WHERE p.categoryID = ?", categoryID)
+}
+
+// GetProductsByIDs returns the products in the order of the IDs provided,
+// skipping the IDs that no longer exist.
+func (client DBClient) GetProductsByIDs(productIDs ...int) (repositories.ProductsJSON, error) {
+	if len(productIDs) == 0 {
+		return repositories.ProductsJSON{}, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(productIDs)), ", ")
+	args := make([]interface{}, len(productIDs))
+	for i, productID := range productIDs {
+		args[i] = productID
+	}
+
+	found, err := client.getProducts("WHERE p.ID IN ("+placeholders+")", args...)
+	if err != nil {
+		return found, err
+	}
+
+	byID := make(map[int]repositories.Product, len(found.Products))
+	for _, product := range found.Products {
+		byID[product.ID] = product
+	}
+
+	var products []repositories.Product
+	for _, productID := range productIDs {
+		if product, ok := byID[productID]; ok {
+			products = append(products, product)
+		}
+	}
+
+	return repositories.ProductsJSON{Products: products}, nil
+}
+
+// LockProductVersion locks the product until the transaction ends, provided
+// it is still at expectedVersion, so edits made through its attributes,
+// images, unit and variants can not overwrite one another.
+func (client DBClient) LockProductVersion(productID int, expectedVersion int) error {
+	var version int
+
+	err := client.db.QueryRow("SELECT version FROM Products WHERE ID = ? FOR UPDATE", productID).Scan(&version)
+	if err == sql.ErrNoRows {
+		return ErrProductNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if version != expectedVersion {
+		return ErrVersionConflict
+	}
+
+	return nil
+}
+
+func (client DBClient) getProducts(condition string, args ...interface{}) (repositories.ProductsJSON, error) {
 	var (
 		products    []repositories.Product
 		id          int
@@ -38,11 +102,20 @@ func (client DBClient) GetProductsByCategoryID(categoryID int) (repositories.Pro
 		imageURL    string
 		description string
 		price       float32
+		stock       float32
+		unit        string
+		step        float32
+		minQuantity float32
+		categoryID  int
+		taxClassID  *int
+		vatRate     float32
+		version     int
 	)
 
 	rows, err := client.db.Query(
-		"SELECT ID, name, imageURL, description, price FROM Products WHERE categoryID = ?",
-		categoryID,
+		"SELECT p.ID, p.name, p.imageURL, p.description, p.price, p.stock, p.unit, p.quantityStep, p.minQuantity, p.categoryID, p.taxClassID, "+productVATRate+", p.version FROM Products p "+
+			productTaxJoins+" "+condition,
+		args...,
 	)
 	if err != nil {
 		return repositories.ProductsJSON{Products: products}, err
@@ -50,22 +123,30 @@ func (client DBClient) GetProductsByCategoryID(categoryID int) (repositories.Pro
 
 	defer rows.Close()
 	for rows.Next() {
-		err := rows.Scan(&id, &name, &imageURL, &description, &price)
+		err := rows.Scan(&id, &name, &imageURL, &description, &price, &stock, &unit, &step, &minQuantity, &categoryID, &taxClassID, &vatRate, &version)
 		if err != nil {
 			return repositories.ProductsJSON{Products: products}, err
 		}
 
-		products = append(
-			products,
-			repositories.Product{
-				ID:          id,
-				Name:        name,
-				ImageURL:    imageURL,
-				Description: description,
-				Price:       price,
-				CategoryID:  categoryID,
-			},
-		)
+		product := repositories.Product{
+			ID:           id,
+			Name:         name,
+			ImageURL:     imageURL,
+			Description:  description,
+			Price:        price,
+			Stock:        stock,
+			Unit:         unit,
+			QuantityStep: step,
+			MinQuantity:  minQuantity,
+			CategoryID:   categoryID,
+			VATRate:      vatRate,
+			Version:      version,
+		}
+		if taxClassID != nil {
+			product.TaxClassID = *taxClassID
+		}
+
+		products = append(products, product)
 	}
 
 	err = rows.Err()
@@ -73,19 +154,38 @@ func (client DBClient) GetProductsByCategoryID(categoryID int) (repositories.Pro
 		return repositories.ProductsJSON{Products: products}, err
 	}
 
+	products, err = client.withBreadcrumbs(products)
+	if err != nil {
+		return repositories.ProductsJSON{Products: products}, err
+	}
+
+	products, err = client.withDetails(products)
+	if err != nil {
+		return repositories.ProductsJSON{Products: products}, err
+	}
+
 	return repositories.ProductsJSON{Products: products}, nil
 }
 
 func (client DBClient) GetCategoriesByDepartmentID(departmentID int) (repositories.CategoriesJSON, error) {
+	return client.getCategories("WHERE departmentID = ?", departmentID)
+}
+
+func (client DBClient) getCategories(condition string, args ...interface{}) (repositories.CategoriesJSON, error) {
 	var (
-		categories []repositories.Category
-		id         int
-		name       string
+		categories   []repositories.Category
+		id           int
+		name         string
+		departmentID int
+		parentID     *int
+		taxClassID   *int
+		effective    *int
+		version      int
 	)
 
 	rows, err := client.db.Query(
-		"SELECT ID, name FROM Categories WHERE departmentID = ?",
-		departmentID,
+		"SELECT ID, name, departmentID, parentID, taxClassID, effectiveTaxClassID, version FROM Categories "+condition,
+		args...,
 	)
 	if err != nil {
 		return repositories.CategoriesJSON{Categories: categories}, err
@@ -93,19 +193,28 @@ func (client DBClient) GetCategoriesByDepartmentID(departmentID int) (repositori
 
 	defer rows.Close()
 	for rows.Next() {
-		err := rows.Scan(&id, &name)
+		err := rows.Scan(&id, &name, &departmentID, &parentID, &taxClassID, &effective, &version)
 		if err != nil {
 			return repositories.CategoriesJSON{Categories: categories}, err
 		}
 
-		categories = append(
-			categories,
-			repositories.Category{
-				ID:           id,
-				Name:         name,
-				DepartmentId: departmentID,
-			},
-		)
+		category := repositories.Category{
+			ID:           id,
+			Name:         name,
+			DepartmentId: departmentID,
+			Version:      version,
+		}
+		if parentID != nil {
+			category.ParentID = *parentID
+		}
+		if taxClassID != nil {
+			category.TaxClassID = *taxClassID
+		}
+		if effective != nil {
+			category.EffectiveTaxClassID = *effective
+		}
+
+		categories = append(categories, category)
 	}
 
 	err = rows.Err()
@@ -121,10 +230,11 @@ func (client DBClient) GetDepartments() (repositories.DepartmentsJSON, error) {
 		departments []repositories.Department
 		id          int
 		name        string
+		version     int
 	)
 
 	rows, err := client.db.Query(
-		"SELECT ID, name FROM Departments",
+		"SELECT ID, name, version FROM Departments",
 	)
 	if err != nil {
 		return repositories.DepartmentsJSON{Departments: departments}, err
@@ -132,7 +242,7 @@ func (client DBClient) GetDepartments() (repositories.DepartmentsJSON, error) {
 
 	defer rows.Close()
 	for rows.Next() {
-		err := rows.Scan(&id, &name)
+		err := rows.Scan(&id, &name, &version)
 		if err != nil {
 			return repositories.DepartmentsJSON{Departments: departments}, err
 		}
@@ -140,8 +250,9 @@ func (client DBClient) GetDepartments() (repositories.DepartmentsJSON, error) {
 		departments = append(
 			departments,
 			repositories.Department{
-				ID:   id,
-				Name: name,
+				ID:      id,
+				Name:    name,
+				Version: version,
 			},
 		)
 	}
@@ -154,122 +265,354 @@ func (client DBClient) GetDepartments() (repositories.DepartmentsJSON, error) {
 	return repositories.DepartmentsJSON{Departments: departments}, nil
 }
 
+// InsertOrder takes the ordered quantities out of stock and consumes the
+// slot reservation along with the order, failing with ErrInsufficientStock
+// when a line is not in stock and ErrSlotReservationInvalid when the
+// reservation can no longer be used. New orders always start in
+// DefaultOrderStatus; only payments, refunds and cancellations move them on.
 func (client DBClient) InsertOrder(order repositories.Order) (repositories.OrderIDResponse, error) {
-	var res driver.Result
-	var err error
+	if len(order.VoucherCode) > 0 && !client.isVoucherValid(order.VoucherCode) {
+		return repositories.OrderIDResponse{OrderID: 0}, errors.New("the voucher code provided is invalid")
+	}
 
-	if len(order.VoucherCode) > 0 {
-		if !client.isVoucherValid(order.VoucherCode) {
-			return repositories.OrderIDResponse{OrderID: 0}, errors.New("the voucher code provided is invalid")
-		}
+	address := shippingAddressOf(order)
 
-		stmt, err := client.db.Prepare("INSERT INTO Orders(firstName, lastName, email, phoneNumber, city, address, voucherCode, paymentMethod, status, timestamp) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
-		if err != nil {
-			return repositories.OrderIDResponse{OrderID: 0}, err
-		}
-		res, err = stmt.Exec(
-			order.FirstName,
-			order.LastName,
-			order.Email,
-			order.PhoneNumber,
-			order.City,
-			order.Address,
-			order.VoucherCode,
-			order.PaymentMethod,
-			order.Status,
-			int(time.Now().UnixNano()/1000000000),
-		)
-	} else {
-		stmt, err := client.db.Prepare("INSERT INTO Orders(firstName, lastName, email, phoneNumber, city, address, paymentMethod, status, timestamp) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?)")
-		if err != nil {
-			return repositories.OrderIDResponse{OrderID: 0}, err
-		}
-		res, err = stmt.Exec(
-			order.FirstName,
-			order.LastName,
-			order.Email,
-			order.PhoneNumber,
-			order.City,
-			order.Address,
-			order.PaymentMethod,
-			order.Status,
-			int(time.Now().UnixNano()/1000000000),
-		)
+	slot := repositories.BookedSlot{}
+	if order.DeliverySlot != nil {
+		slot = *order.DeliverySlot
+	}
+
+	tx, err := client.db.Begin()
+	if err != nil {
+		return repositories.OrderIDResponse{OrderID: 0}, err
 	}
+	defer tx.Rollback()
 
+	stmt, err := tx.Prepare("INSERT INTO Orders(firstName, lastName, email, phoneNumber, city, address, street, streetNumber, postalCode, county, country, deliveryZoneID, fulfilmentType, pickupLocationID, deliverySlotID, deliveryDate, voucherCode, paymentMethod, status, timestamp) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return repositories.OrderIDResponse{OrderID: 0}, err
+	}
+	res, err := stmt.Exec(
+		order.FirstName,
+		order.LastName,
+		order.Email,
+		order.PhoneNumber,
+		order.City,
+		order.Address,
+		nullableString(address.Street),
+		nullableString(address.Number),
+		nullableString(address.PostalCode),
+		nullableString(address.County),
+		nullableString(address.Country),
+		nullableInt(order.DeliveryZoneID),
+		fulfilmentOf(order),
+		nullableInt(order.PickupLocationID),
+		nullableInt(slot.SlotID),
+		nullableString(slot.Date),
+		nullableString(order.VoucherCode),
+		order.PaymentMethod,
+		repositories.DefaultOrderStatus,
+		int(time.Now().UnixNano()/1000000000),
+	)
 	if err != nil {
 		return repositories.OrderIDResponse{OrderID: 0}, err
 	}
+
 	orderID, err := res.LastInsertId()
+	if err != nil {
+		return repositories.OrderIDResponse{OrderID: 0}, err
+	}
 
-	stmt, err := client.db.Prepare("INSERT INTO ProductOrders(orderID, productID, quantity) VALUES(?, ?, ?)")
+	stmt, err = tx.Prepare("INSERT INTO ProductOrders(orderID, productID, variantID, quantity, unitPrice, vatRate, promotionDiscount, promotions) VALUES(?, ?, ?, ?, ?, ?, ?, ?)")
 	if err != nil {
 		return repositories.OrderIDResponse{OrderID: 0}, err
 	}
 
 	for _, product := range order.ProductsOrdered {
+		applied, err := appliedPromotionsOf(product)
+		if err != nil {
+			return repositories.OrderIDResponse{OrderID: 0}, err
+		}
+		unitPrice, vatRate, err := linePriceOf(tx, product.ProductID, product.VariantID)
+		if err != nil {
+			return repositories.OrderIDResponse{OrderID: 0}, err
+		}
 		_, err = stmt.Exec(
 			orderID,
 			product.ProductID,
+			nullableInt(product.VariantID),
 			product.Quantity,
+			unitPrice,
+			vatRate,
+			product.PromotionDiscount,
+			applied,
 		)
 		if err != nil {
 			return repositories.OrderIDResponse{OrderID: 0}, err
 		}
+
+		err = takeStock(tx, product.ProductID, product.VariantID, product.Quantity)
+		if err != nil {
+			return repositories.OrderIDResponse{OrderID: 0}, err
+		}
+	}
+
+	err = saveShippingCost(tx, int(orderID))
+	if err != nil {
+		return repositories.OrderIDResponse{OrderID: 0}, err
+	}
+
+	if order.DeliverySlot != nil {
+		err = consumeSlotReservation(tx, order.SlotReservationID, int(orderID))
+		if err != nil {
+			return repositories.OrderIDResponse{OrderID: 0}, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return repositories.OrderIDResponse{OrderID: 0}, err
 	}
 
 	return repositories.OrderIDResponse{OrderID: int(orderID)}, nil
 }
 
+// EditOrder saves the customer's details of an order still at order.Version;
+// its status is left as it is.
 func (client DBClient) EditOrder(order repositories.Order) error {
 	isVoucherValid := len(order.VoucherCode) == 0 || client.isVoucherValid(order.VoucherCode)
 	if !isVoucherValid {
 		return errors.New("the voucher code provided is invalid")
 	}
 
-	stmt, err := client.db.Prepare("UPDATE Orders SET firstName = ?, lastName = ?, email = ?, phoneNumber = ?, city = ?, address = ?, voucherCode = ?, paymentMethod = ?, status = ? WHERE ID = ?")
+	address := shippingAddressOf(order)
+
+	tx, err := client.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare("UPDATE Orders SET firstName = ?, lastName = ?, email = ?, phoneNumber = ?, city = ?, address = ?, street = ?, streetNumber = ?, postalCode = ?, county = ?, country = ?, deliveryZoneID = ?, fulfilmentType = ?, pickupLocationID = ?, voucherCode = ?, paymentMethod = ?, version = version + 1 WHERE ID = ? AND version = ?")
 	if err != nil {
 		return err
 	}
 
-	_, err = stmt.Exec(
+	res, err := stmt.Exec(
 		order.FirstName,
 		order.LastName,
 		order.Email,
 		order.PhoneNumber,
 		order.City,
 		order.Address,
-		order.VoucherCode,
+		nullableString(address.Street),
+		nullableString(address.Number),
+		nullableString(address.PostalCode),
+		nullableString(address.County),
+		nullableString(address.Country),
+		nullableInt(order.DeliveryZoneID),
+		fulfilmentOf(order),
+		nullableInt(order.PickupLocationID),
+		nullableString(order.VoucherCode),
 		order.PaymentMethod,
-		order.Status,
 		order.ID,
+		order.Version,
 	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrVersionConflict
+	}
 
-	return err
+	err = saveShippingCost(tx, order.ID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (client DBClient) DeleteOrder(orderID int) error {
-	_, err := client.db.Exec(
-		"DELETE FROM ProductOrders WHERE orderID = ?",
+var (
+	ErrOrderAlreadyArchived = errors.New("the order provided is already archived")
+	ErrOrderNotArchived     = errors.New("the order provided is not archived")
+)
+
+// DeleteOrder archives the order and gives the quantities it holds back to
+// stock.
+func (client DBClient) DeleteOrder(orderID int, operator string) error {
+	tx, err := client.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		"UPDATE Orders SET archivedBy = ?, archivedTimestamp = ?, version = version + 1 WHERE ID = ? AND archivedTimestamp IS NULL",
+		operator,
+		int(time.Now().UnixNano()/1000000000),
 		orderID,
 	)
 	if err != nil {
 		return err
 	}
 
-	_, err = client.db.Exec(
-		"DELETE FROM Orders WHERE ID = ?",
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return client.archiveStateError(orderID, ErrOrderAlreadyArchived)
+	}
+
+	err = releaseOrderStock(tx, orderID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RestoreOrder brings an archived order back and, unless it was cancelled,
+// takes its quantities out of stock again, failing with ErrInsufficientStock
+// when they are no longer in stock.
+func (client DBClient) RestoreOrder(orderID int) error {
+	tx, err := client.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		"UPDATE Orders SET archivedBy = NULL, archivedTimestamp = NULL, version = version + 1 WHERE ID = ? AND archivedTimestamp IS NOT NULL",
 		orderID,
 	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return client.archiveStateError(orderID, ErrOrderNotArchived)
+	}
+
+	err = retakeOrderStock(tx, orderID)
+	if err != nil {
+		return err
+	}
 
-	return err
+	return tx.Commit()
+}
+
+// archiveStateError tells why an order could not be archived or restored:
+// it does not exist, or it is already in the state asked for.
+func (client DBClient) archiveStateError(orderID int, stateErr error) error {
+	var found int
+
+	err := client.db.QueryRow("SELECT COUNT(*) FROM Orders WHERE ID = ?", orderID).Scan(&found)
+	if err != nil {
+		return err
+	}
+	if found == 0 {
+		return ErrOrderNotFound
+	}
+
+	return stateErr
+}
+
+// PurgeArchivedOrders deletes the orders archived before archivedBefore,
+// along with everything linked to them. Invoiced orders are kept, as their
+// invoices must be retained.
+func (client DBClient) PurgeArchivedOrders(archivedBefore int) (int, error) {
+	orders, err := client.getOrders(
+		"WHERE o.archivedTimestamp IS NOT NULL AND o.archivedTimestamp < ? AND NOT EXISTS (SELECT 1 FROM Invoices i WHERE i.orderID = o.ID)",
+		archivedBefore,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, order := range orders.Orders {
+		err = client.purgeOrder(order)
+		if err != nil {
+			return i, err
+		}
+	}
+
+	return len(orders.Orders), nil
+}
+
+// purgeOrder deletes the order with everything recorded against it, keeping
+// only the audit entry of its deletion, made under the system actor. Orders
+// archived before their stock was released give it back here.
+func (client DBClient) purgeOrder(order repositories.Order) error {
+	tx, err := client.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = releaseOrderStock(tx, order.ID)
+	if err != nil {
+		return err
+	}
+
+	queries := []string{
+		"DELETE FROM RefundedProducts WHERE refundID IN (SELECT ID FROM Refunds WHERE orderID = ?)",
+		"DELETE FROM Refunds WHERE orderID = ?",
+		"DELETE FROM Payments WHERE orderID = ?",
+		"DELETE FROM SlotReservations WHERE orderID = ?",
+		"DELETE FROM ProductOrders WHERE orderID = ?",
+		"DELETE FROM Orders WHERE ID = ?",
+	}
+	for _, query := range queries {
+		_, err = tx.Exec(query, order.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = recordSystemChange(tx, repositories.OrderEntity, order.ID, repositories.DeleteOperation, order, nil)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (client DBClient) GetOrders(orderIDProvided ...int) (repositories.OrdersJSON, error) {
-	var (
-		orderRows *sql.Rows
-		err       error
+	if len(orderIDProvided) == 1 {
+		return client.getOrders("WHERE o.ID = ?", orderIDProvided[0])
+	}
 
+	return client.getOrders("WHERE o.archivedTimestamp IS NULL")
+}
+
+func (client DBClient) GetArchivedOrders() (repositories.OrdersJSON, error) {
+	return client.getOrders("WHERE o.archivedTimestamp IS NOT NULL")
+}
+
+// GetUninvoicedOrders returns the orders with a captured payment whose
+// invoice could not be issued yet, whatever happened to them since, e.g. a
+// refund.
+func (client DBClient) GetUninvoicedOrders() (repositories.OrdersJSON, error) {
+	return client.getOrders(
+		"WHERE EXISTS (SELECT 1 FROM Payments pm WHERE pm.orderID = o.ID AND pm.status = ?) AND NOT EXISTS (SELECT 1 FROM Invoices i WHERE i.orderID = o.ID AND i.kind = ?)",
+		payments.StatusCaptured,
+		repositories.InvoiceDocument,
+	)
+}
+
+func (client DBClient) getOrders(condition string, args ...interface{}) (repositories.OrdersJSON, error) {
+	var (
 		orders             []repositories.Order
 		orderID            int
 		firstName          string
@@ -283,31 +626,56 @@ func (client DBClient) GetOrders(orderIDProvided ...int) (repositories.OrdersJSO
 		status             string
 		timestamp          int
 		discountPercentage *int
+		archivedBy         *string
+		archivedTimestamp  *int
+		version            int
+		street             *string
+		streetNumber       *string
+		postalCode         *string
+		county             *string
+		country            *string
+		deliveryZoneID     *int
+		fulfilmentType     *string
+		pickupLocationID   *int
+		fulfilmentStatus   *string
+		pickupName         *string
+		pickupStreet       *string
+		pickupNumber       *string
+		pickupPostalCode   *string
+		pickupCity         *string
+		shippingCost       *float32
+		shippingVATRate    *float32
+		deliverySlotID     *int
+		deliveryDate       *string
+		slotStartTime      *string
+		slotEndTime        *string
 	)
 
 	query := `
-		SELECT o.ID, o.firstName, o.lastName, o.email, o.phoneNumber, o.city, o.address, o.voucherCode, o.paymentMethod, o.status, o.timestamp, v.discountPercentage 
+		SELECT o.ID, o.firstName, o.lastName, o.email, o.phoneNumber, o.city, o.address, o.voucherCode, o.paymentMethod, o.status, o.timestamp, v.discountPercentage, o.archivedBy, o.archivedTimestamp, o.version, 
+			o.street, o.streetNumber, o.postalCode, o.county, o.country, o.deliveryZoneID, o.shippingCost, o.shippingVATRate, 
+			o.fulfilmentType, o.pickupLocationID, o.fulfilmentStatus, pl.name, pl.street, pl.streetNumber, pl.postalCode, pl.city, 
+			o.deliverySlotID, o.deliveryDate, s.startTime, s.endTime 
 		FROM Orders o 
 		LEFT JOIN Vouchers v 
 		ON o.voucherCode = v.code 
+		LEFT JOIN DeliverySlots s 
+		ON o.deliverySlotID = s.ID 
+		LEFT JOIN PickupLocations pl 
+		ON o.pickupLocationID = pl.ID 
 	`
 
-	if len(orderIDProvided) == 1 {
-		orderRows, err = client.db.Query(query+" WHERE ID = ?", orderIDProvided[0])
-	} else {
-		orderRows, err = client.db.Query(query)
-	}
+	orderRows, err := client.db.Query(query+condition, args...)
 	if err != nil {
 		return repositories.OrdersJSON{Orders: orders}, err
 	}
 
 	defer orderRows.Close()
 	for orderRows.Next() {
-		err := orderRows.Scan(&orderID, &firstName, &lastName, &email, &phoneNumber, &city, &address, &voucherCode, &paymentMethod, &status, &timestamp, &discountPercentage)
-		if err != nil {
-			return repositories.OrdersJSON{Orders: orders}, err
-		}
-		products, totalValue, err := client.getOrderedProducts(orderID)
+		err := orderRows.Scan(&orderID, &firstName, &lastName, &email, &phoneNumber, &city, &address, &voucherCode, &paymentMethod, &status, &timestamp, &discountPercentage, &archivedBy, &archivedTimestamp, &version,
+			&street, &streetNumber, &postalCode, &county, &country, &deliveryZoneID, &shippingCost, &shippingVATRate,
+			&fulfilmentType, &pickupLocationID, &fulfilmentStatus, &pickupName, &pickupStreet, &pickupNumber, &pickupPostalCode, &pickupCity,
+			&deliverySlotID, &deliveryDate, &slotStartTime, &slotEndTime)
 		if err != nil {
 			return repositories.OrdersJSON{Orders: orders}, err
 		}
@@ -319,6 +687,64 @@ func (client DBClient) GetOrders(orderIDProvided ...int) (repositories.OrdersJSO
 			discount = *discountPercentage
 		}
 
+		archivedByOperator := ""
+		archivedAt := 0
+		if archivedTimestamp != nil {
+			archivedByOperator = *archivedBy
+			archivedAt = *archivedTimestamp
+		}
+
+		var shippingAddress *repositories.Address
+		zoneID := 0
+		if street != nil {
+			shippingAddress = &repositories.Address{
+				Email:      email,
+				Street:     *street,
+				Number:     *streetNumber,
+				PostalCode: *postalCode,
+				City:       city,
+				County:     *county,
+				Country:    *country,
+			}
+		}
+		if deliveryZoneID != nil {
+			zoneID = *deliveryZoneID
+		}
+		shipping, shippingRate := float32(0), float32(0)
+		if shippingCost != nil {
+			shipping = *shippingCost
+		}
+		if shippingVATRate != nil {
+			shippingRate = *shippingVATRate
+		}
+
+		fulfilment := repositories.DeliveryFulfilment
+		locationID := 0
+		if fulfilmentType != nil {
+			fulfilment = *fulfilmentType
+		}
+		if pickupLocationID != nil {
+			locationID = *pickupLocationID
+		}
+		pickupAddress := ""
+		if pickupName != nil {
+			pickupAddress = fmt.Sprintf("%s (%s %s, %s), %s", *pickupName, *pickupStreet, *pickupNumber, *pickupPostalCode, *pickupCity)
+		}
+		fulfilmentState := ""
+		if fulfilmentStatus != nil {
+			fulfilmentState = *fulfilmentStatus
+		}
+
+		var bookedSlot *repositories.BookedSlot
+		if deliverySlotID != nil && slotStartTime != nil {
+			bookedSlot = &repositories.BookedSlot{
+				SlotID:    *deliverySlotID,
+				Date:      *deliveryDate,
+				StartTime: *slotStartTime,
+				EndTime:   *slotEndTime,
+			}
+		}
+
 		orders = append(
 			orders,
 			repositories.Order{
@@ -329,14 +755,24 @@ func (client DBClient) GetOrders(orderIDProvided ...int) (repositories.OrdersJSO
 				PhoneNumber:        phoneNumber,
 				City:               city,
 				Address:            address,
+				FulfilmentType:     fulfilment,
+				PickupLocationID:   locationID,
+				PickupAddress:      pickupAddress,
+				FulfilmentStatus:   fulfilmentState,
+				ShippingAddress:    shippingAddress,
+				DeliveryZoneID:     zoneID,
+				ShippingCost:       shipping,
+				ShippingVATRate:    shippingRate,
+				DeliverySlot:       bookedSlot,
 				VoucherCode:        code,
 				DiscountPercentage: discount,
 				PaymentMethod:      paymentMethod,
 				Status:             status,
 				Timestamp:          timestamp,
 				Date:               ParseTimestamp(timestamp),
-				Value:              totalValue * 100 / (100 + float32(discount)),
-				ProductsOrdered:    products,
+				ArchivedBy:         archivedByOperator,
+				ArchivedTimestamp:  archivedAt,
+				Version:            version,
 			},
 		)
 	}
@@ -346,6 +782,34 @@ func (client DBClient) GetOrders(orderIDProvided ...int) (repositories.OrdersJSO
 		return repositories.OrdersJSON{Orders: orders}, err
 	}
 
+	// The lines, payments and refunds are only read once all the orders were,
+	// as a transaction can not run other queries while rows are open.
+	for i := range orders {
+		order := &orders[i]
+
+		products, totalValue, err := client.getOrderedProducts(order.ID)
+		if err != nil {
+			return repositories.OrdersJSON{Orders: orders}, err
+		}
+		payments, err := client.GetPaymentsByOrderID(order.ID)
+		if err != nil {
+			return repositories.OrdersJSON{Orders: orders}, err
+		}
+		refunds, refundedValue, err := client.GetRefundsByOrderID(order.ID)
+		if err != nil {
+			return repositories.OrdersJSON{Orders: orders}, err
+		}
+
+		order.Value = totalValue * 100 / (100 + float32(order.DiscountPercentage))
+		order.VATBreakdown, order.VATTotal = vatBreakdown(products, order.DiscountPercentage, order.ShippingCost, order.ShippingVATRate)
+		order.Total = order.Value + order.ShippingCost
+		order.PromotionDiscount = promotionDiscountOf(products)
+		order.RefundedValue = refundedValue
+		order.ProductsOrdered = products
+		order.Payments = payments.Payments
+		order.Refunds = refunds.Refunds
+	}
+
 	return repositories.OrdersJSON{Orders: orders}, nil
 }
 
@@ -353,19 +817,28 @@ func (client DBClient) getOrderedProducts(orderID int) ([]repositories.OrderedPr
 	var (
 		products    []repositories.OrderedProduct
 		productID   int
-		quantity    int
+		variantID   *int
+		quantity    float32
+		actual      *float32
+		discount    float32
+		applied     *string
 		name        string
 		imageURL    string
 		description string
 		price       float32
+		unit        string
 		categoryID  int
+		vatRate     float32
 	)
 
 	totalValue := float32(0)
 	productOrderRows, err := client.db.Query(`
-			SELECT po.productID, po.quantity, p.name, p.imageURL, p.description, p.price, p.categoryID 
-			FROM ProductOrders po, Products p
-			WHERE po.productID = p.ID AND orderID = ?
+			SELECT po.productID, po.variantID, po.quantity, po.actualQuantity, po.promotionDiscount, po.promotions, p.name, p.imageURL, p.description, `+orderedPrice+`, p.unit, p.categoryID, `+orderedVATRate+`
+			FROM ProductOrders po
+			JOIN Products p
+			ON po.productID = p.ID
+			`+variantJoin+`
+			WHERE po.orderID = ?
 		`,
 		orderID,
 	)
@@ -374,30 +847,46 @@ func (client DBClient) getOrderedProducts(orderID int) ([]repositories.OrderedPr
 	}
 
 	for productOrderRows.Next() {
-		err := productOrderRows.Scan(&productID, &quantity, &name, &imageURL, &description, &price, &categoryID)
+		err := productOrderRows.Scan(&productID, &variantID, &quantity, &actual, &discount, &applied, &name, &imageURL, &description, &price, &unit, &categoryID, &vatRate)
 		if err != nil {
 			fmt.Println(err.Error())
 			return products, totalValue, err
 		}
 
-		totalValue += price
-
-		products = append(
-			products,
-			repositories.OrderedProduct{
-				ProductID: productID,
-				OrderID:   orderID,
-				Quantity:  quantity,
-				Product: repositories.Product{
-					ID:          productID,
-					Name:        name,
-					ImageURL:    imageURL,
-					Description: description,
-					Price:       price,
-					CategoryID:  categoryID,
-				},
+		product := repositories.OrderedProduct{
+			ProductID:         productID,
+			OrderID:           orderID,
+			Quantity:          quantity,
+			PromotionDiscount: discount,
+			Product: repositories.Product{
+				ID:          productID,
+				Name:        name,
+				ImageURL:    imageURL,
+				Description: description,
+				Price:       price,
+				Unit:        unit,
+				CategoryID:  categoryID,
+				VATRate:     vatRate,
 			},
-		)
+		}
+		if variantID != nil {
+			product.VariantID = *variantID
+		}
+		if actual != nil {
+			ordered := quantity
+			product.OrderedQuantity = &ordered
+			product.Quantity = *actual
+		}
+		if applied != nil {
+			err = json.Unmarshal([]byte(*applied), &product.Promotions)
+			if err != nil {
+				return products, totalValue, err
+			}
+		}
+
+		totalValue += price*product.Quantity - product.PromotionDiscount
+
+		products = append(products, product)
 	}
 
 	productOrderRows.Close()
@@ -407,6 +896,11 @@ func (client DBClient) getOrderedProducts(orderID int) ([]repositories.OrderedPr
 		return products, totalValue, err
 	}
 
+	err = client.withOrderedVariants(products)
+	if err != nil {
+		return products, totalValue, err
+	}
+
 	return products, totalValue, nil
 }
 
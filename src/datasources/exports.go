@@ -0,0 +1,75 @@
+package datasources
+
+import (
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+// StreamOrderLines hands the lines of the orders matching filter to write one
+// at a time, as they are read, so exports never hold all orders in memory.
+func (client DBClient) StreamOrderLines(filter repositories.ExportFilter, write func(repositories.ExportLine) error) error {
+	var (
+		line               repositories.ExportLine
+		voucherCode        *string
+		discountPercentage *int
+		fulfilmentType     *string
+		sku                *string
+	)
+
+	query := `
+		SELECT o.ID, o.timestamp, o.status, o.email, o.firstName, o.lastName, o.city, o.fulfilmentType, o.paymentMethod,
+			o.voucherCode, v.discountPercentage, po.productID, ` + orderedSKU + `, p.name, ` + billedQuantity + `, ` + orderedPrice + `, po.promotionDiscount, ` + orderedVATRate + `
+		FROM Orders o
+		JOIN ProductOrders po
+		ON po.orderID = o.ID
+		JOIN Products p
+		ON po.productID = p.ID
+		` + variantJoin + `
+		LEFT JOIN Vouchers v
+		ON o.voucherCode = v.code
+		WHERE o.archivedTimestamp IS NULL AND o.timestamp >= ? AND o.timestamp < ?
+	`
+	args := []interface{}{filter.From, filter.To}
+	if len(filter.Status) > 0 {
+		query += " AND o.status = ?"
+		args = append(args, filter.Status)
+	}
+
+	rows, err := client.db.Query(query+" ORDER BY o.ID, po.productID, po.variantID", args...)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		err := rows.Scan(&line.OrderID, &line.Timestamp, &line.Status, &line.Email, &line.FirstName, &line.LastName, &line.City,
+			&fulfilmentType, &line.PaymentMethod, &voucherCode, &discountPercentage, &line.ProductID, &sku, &line.ProductName,
+			&line.Quantity, &line.UnitPrice, &line.PromotionDiscount, &line.VATRate)
+		if err != nil {
+			return err
+		}
+
+		line.VoucherCode, line.DiscountPercentage = "", 0
+		if voucherCode != nil && discountPercentage != nil {
+			line.VoucherCode = *voucherCode
+			line.DiscountPercentage = *discountPercentage
+		}
+		line.FulfilmentType = repositories.DeliveryFulfilment
+		if fulfilmentType != nil {
+			line.FulfilmentType = *fulfilmentType
+		}
+		line.SKU = ""
+		if sku != nil {
+			line.SKU = *sku
+		}
+
+		line.Total = roundToCents((line.UnitPrice*float32(line.Quantity) - line.PromotionDiscount) * 100 / (100 + float32(line.DiscountPercentage)))
+		line.VAT = roundToCents(line.Total * line.VATRate / (100 + line.VATRate))
+
+		err = write(line)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
@@ -16,3 +16,35 @@ func ParseTimestamp(timestamp int) string {
 
 	return tm.Format(layout)
 }
+
+func nullableString(value string) interface{} {
+	if len(value) == 0 {
+		return nil
+	}
+
+	return value
+}
+
+func nullableInt(value int) interface{} {
+	if value == 0 {
+		return nil
+	}
+
+	return value
+}
+
+func shippingAddressOf(order repositories.Order) repositories.Address {
+	if order.ShippingAddress == nil {
+		return repositories.Address{}
+	}
+
+	return *order.ShippingAddress
+}
+
+func fulfilmentOf(order repositories.Order) string {
+	if order.FulfilmentType == repositories.PickupFulfilment {
+		return repositories.PickupFulfilment
+	}
+
+	return repositories.DeliveryFulfilment
+}
@@ -0,0 +1,84 @@
+package datasources
+
+import (
+	"time"
+
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+func (client DBClient) ReserveIdempotencyKey(key string, requestHash string, expiredBefore int) (repositories.IdempotentResponse, bool, error) {
+	var (
+		storedHash string
+		completed  bool
+		status     int
+		body       []byte
+		etag       string
+		timestamp  int
+	)
+
+	_, err := client.db.Exec(
+		"DELETE FROM IdempotencyKeys WHERE idempotencyKey = ? AND timestamp < ?",
+		key,
+		expiredBefore,
+	)
+	if err != nil {
+		return repositories.IdempotentResponse{}, false, err
+	}
+
+	res, err := client.db.Exec(
+		"INSERT IGNORE INTO IdempotencyKeys(idempotencyKey, requestHash, completed, status, body, etag, timestamp) VALUES(?, ?, FALSE, 0, '', '', ?)",
+		key,
+		requestHash,
+		int(time.Now().UnixNano()/1000000000),
+	)
+	if err != nil {
+		return repositories.IdempotentResponse{}, false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return repositories.IdempotentResponse{}, false, err
+	}
+	if affected == 1 {
+		return repositories.IdempotentResponse{Key: key, RequestHash: requestHash}, true, nil
+	}
+
+	err = client.db.QueryRow(
+		"SELECT requestHash, completed, status, body, etag, timestamp FROM IdempotencyKeys WHERE idempotencyKey = ?",
+		key,
+	).Scan(&storedHash, &completed, &status, &body, &etag, &timestamp)
+	if err != nil {
+		return repositories.IdempotentResponse{}, false, err
+	}
+
+	return repositories.IdempotentResponse{
+		Key:         key,
+		RequestHash: storedHash,
+		Completed:   completed,
+		Status:      status,
+		Body:        body,
+		ETag:        etag,
+		Timestamp:   timestamp,
+	}, false, nil
+}
+
+func (client DBClient) CompleteIdempotencyKey(response repositories.IdempotentResponse) error {
+	_, err := client.db.Exec(
+		"UPDATE IdempotencyKeys SET completed = TRUE, status = ?, body = ?, etag = ? WHERE idempotencyKey = ?",
+		response.Status,
+		response.Body,
+		response.ETag,
+		response.Key,
+	)
+
+	return err
+}
+
+func (client DBClient) ReleaseIdempotencyKey(key string) error {
+	_, err := client.db.Exec(
+		"DELETE FROM IdempotencyKeys WHERE idempotencyKey = ?",
+		key,
+	)
+
+	return err
+}
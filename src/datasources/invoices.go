@@ -0,0 +1,192 @@
+package datasources
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+var (
+	ErrInvoiceNotFound      = errors.New("the invoice requested does not exist")
+	ErrInvoiceAlreadyIssued = errors.New("the invoice was already issued")
+)
+
+func (client DBClient) GetInvoice(orderID int) (repositories.Invoice, error) {
+	invoices, err := client.getInvoices("WHERE kind = ? AND orderID = ?", repositories.InvoiceDocument, orderID)
+	if err != nil {
+		return repositories.Invoice{}, err
+	}
+	if len(invoices.Invoices) != 1 {
+		return repositories.Invoice{}, ErrInvoiceNotFound
+	}
+
+	return invoices.Invoices[0], nil
+}
+
+func (client DBClient) GetCreditNotes(orderID int) (repositories.InvoicesJSON, error) {
+	return client.getInvoices("WHERE kind = ? AND orderID = ? ORDER BY number", repositories.CreditNoteDocument, orderID)
+}
+
+// GetUncreditedRefundOrders returns the IDs of the invoiced orders that have
+// refunds whose credit note could not be issued yet.
+func (client DBClient) GetUncreditedRefundOrders() ([]int, error) {
+	var (
+		orderIDs []int
+		orderID  int
+	)
+
+	rows, err := client.db.Query(`
+			SELECT DISTINCT r.orderID
+			FROM Refunds r
+			JOIN Invoices i
+			ON i.orderID = r.orderID AND i.kind = ?
+			WHERE NOT EXISTS (SELECT 1 FROM Invoices c WHERE c.kind = ? AND c.refundID = r.ID)
+		`,
+		repositories.InvoiceDocument,
+		repositories.CreditNoteDocument,
+	)
+	if err != nil {
+		return orderIDs, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		err := rows.Scan(&orderID)
+		if err != nil {
+			return orderIDs, err
+		}
+
+		orderIDs = append(orderIDs, orderID)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return orderIDs, err
+	}
+
+	return orderIDs, nil
+}
+
+func (client DBClient) getInvoices(condition string, args ...interface{}) (repositories.InvoicesJSON, error) {
+	var (
+		invoices []repositories.Invoice
+		id       int
+		document []byte
+	)
+
+	rows, err := client.db.Query("SELECT ID, document FROM Invoices "+condition, args...)
+	if err != nil {
+		return repositories.InvoicesJSON{Invoices: invoices}, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		err := rows.Scan(&id, &document)
+		if err != nil {
+			return repositories.InvoicesJSON{Invoices: invoices}, err
+		}
+
+		var invoice repositories.Invoice
+		err = json.Unmarshal(document, &invoice)
+		if err != nil {
+			return repositories.InvoicesJSON{Invoices: invoices}, err
+		}
+		invoice.ID = id
+
+		invoices = append(invoices, invoice)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return repositories.InvoicesJSON{Invoices: invoices}, err
+	}
+
+	return repositories.InvoicesJSON{Invoices: invoices}, nil
+}
+
+// IssueInvoice numbers the invoice with the next number of its series and
+// stores it in the same transaction, so numbers are never skipped or reused.
+func (client DBClient) IssueInvoice(invoice repositories.Invoice) (repositories.Invoice, error) {
+	var (
+		existing int
+		number   int
+	)
+
+	tx, err := client.db.Begin()
+	if err != nil {
+		return invoice, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("INSERT IGNORE INTO InvoiceSeries(series, nextNumber) VALUES(?, 1)", invoice.Series)
+	if err != nil {
+		return invoice, err
+	}
+
+	err = tx.QueryRow(
+		"SELECT nextNumber FROM InvoiceSeries WHERE series = ? FOR UPDATE",
+		invoice.Series,
+	).Scan(&number)
+	if err != nil {
+		return invoice, err
+	}
+
+	err = tx.QueryRow(
+		"SELECT COUNT(*) FROM Invoices WHERE kind = ? AND orderID = ? AND refundID <=> ?",
+		invoice.Kind,
+		invoice.OrderID,
+		nullableInt(invoice.RefundID),
+	).Scan(&existing)
+	if err != nil {
+		return invoice, err
+	}
+	if existing > 0 {
+		return invoice, ErrInvoiceAlreadyIssued
+	}
+
+	invoice.Number = number
+	invoice.FullNumber = fmt.Sprintf("%s-%06d", invoice.Series, number)
+	invoice.IssuedTimestamp = int(time.Now().UnixNano() / 1000000000)
+	invoice.IssuedDate = ParseTimestamp(invoice.IssuedTimestamp)
+
+	document, err := json.Marshal(invoice)
+	if err != nil {
+		return invoice, err
+	}
+
+	res, err := tx.Exec(
+		"INSERT INTO Invoices(kind, series, number, orderID, refundID, issuedTimestamp, document) VALUES(?, ?, ?, ?, ?, ?, ?)",
+		invoice.Kind,
+		invoice.Series,
+		invoice.Number,
+		invoice.OrderID,
+		nullableInt(invoice.RefundID),
+		invoice.IssuedTimestamp,
+		document,
+	)
+	if err != nil {
+		return invoice, err
+	}
+
+	invoiceID, err := res.LastInsertId()
+	if err != nil {
+		return invoice, err
+	}
+
+	_, err = tx.Exec("UPDATE InvoiceSeries SET nextNumber = nextNumber + 1 WHERE series = ?", invoice.Series)
+	if err != nil {
+		return invoice, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return invoice, err
+	}
+
+	invoice.ID = int(invoiceID)
+
+	return invoice, nil
+}
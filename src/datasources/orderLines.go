@@ -0,0 +1,264 @@
+package datasources
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+var (
+	ErrOrderNotFound     = errors.New("the order provided does not exist")
+	ErrOrderNotEditable  = errors.New("the order can no longer be edited")
+	ErrInsufficientStock = errors.New("insufficient stock")
+	ErrInvalidVoucher    = errors.New("the voucher code provided is invalid")
+	ErrEmptyOrder        = errors.New("an order must contain at least one product")
+)
+
+// EditOrderLines changes the lines of an order still at expectedVersion, then
+// evaluates the active promotions and the shipping cost again on its lines.
+func (client DBClient) EditOrderLines(orderID int, expectedVersion int, lines []repositories.OrderedProduct, active []repositories.Promotion) error {
+	var (
+		status      string
+		voucherCode *string
+		version     int
+		lineCount   int
+	)
+
+	tx, err := client.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(
+		"SELECT status, voucherCode, version FROM Orders WHERE ID = ? AND archivedTimestamp IS NULL FOR UPDATE",
+		orderID,
+	).Scan(&status, &voucherCode, &version)
+	if err == sql.ErrNoRows {
+		return ErrOrderNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if status != repositories.DefaultOrderStatus {
+		return ErrOrderNotEditable
+	}
+	if expectedVersion != version {
+		return ErrVersionConflict
+	}
+	if voucherCode != nil && len(*voucherCode) > 0 {
+		err = tx.QueryRow("SELECT COUNT(*) FROM Vouchers WHERE code = ?", *voucherCode).Scan(&lineCount)
+		if err != nil {
+			return err
+		}
+		if lineCount == 0 {
+			return ErrInvalidVoucher
+		}
+	}
+
+	for _, line := range lines {
+		err = editOrderLine(tx, orderID, line)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.QueryRow("SELECT COUNT(*) FROM ProductOrders WHERE orderID = ?", orderID).Scan(&lineCount)
+	if err != nil {
+		return err
+	}
+	if lineCount == 0 {
+		return ErrEmptyOrder
+	}
+
+	err = savePromotions(tx, orderID, active)
+	if err != nil {
+		return err
+	}
+
+	err = saveShippingCost(tx, orderID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE Orders SET version = version + 1 WHERE ID = ?", orderID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func editOrderLine(tx transaction, orderID int, line repositories.OrderedProduct) error {
+	var currentQuantity float32
+
+	err := tx.QueryRow(
+		"SELECT "+billedQuantity+" FROM ProductOrders po WHERE orderID = ? AND productID = ? AND variantID <=> ? FOR UPDATE",
+		orderID,
+		line.ProductID,
+		nullableInt(line.VariantID),
+	).Scan(&currentQuantity)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	err = takeStock(tx, line.ProductID, line.VariantID, line.Quantity-currentQuantity)
+	if err != nil {
+		return err
+	}
+
+	variantID := nullableInt(line.VariantID)
+	switch {
+	case line.Quantity == 0:
+		_, err = tx.Exec("DELETE FROM ProductOrders WHERE orderID = ? AND productID = ? AND variantID <=> ?", orderID, line.ProductID, variantID)
+	case currentQuantity == 0:
+		var unitPrice, vatRate float32
+		unitPrice, vatRate, err = linePriceOf(tx, line.ProductID, line.VariantID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("INSERT INTO ProductOrders(orderID, productID, variantID, quantity, unitPrice, vatRate) VALUES(?, ?, ?, ?, ?, ?)", orderID, line.ProductID, variantID, line.Quantity, unitPrice, vatRate)
+	default:
+		_, err = tx.Exec("UPDATE ProductOrders SET quantity = ?, actualQuantity = NULL WHERE orderID = ? AND productID = ? AND variantID <=> ?", line.Quantity, orderID, line.ProductID, variantID)
+	}
+
+	return err
+}
+
+// takeStock takes delta more of the line's product or variant out of stock,
+// or puts it back when delta is negative.
+func takeStock(tx transaction, productID int, variantID int, delta float32) error {
+	table, stockID := stockOf(productID, variantID)
+	if delta > 0 {
+		res, err := tx.Exec(
+			"UPDATE "+table+" SET stock = stock - ? WHERE ID = ? AND stock >= ?",
+			delta,
+			stockID,
+			delta,
+		)
+		if err != nil {
+			return err
+		}
+
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return fmt.Errorf("%w for product %d", ErrInsufficientStock, productID)
+		}
+	} else if delta < 0 {
+		_, err := tx.Exec(
+			"UPDATE "+table+" SET stock = stock + ? WHERE ID = ?",
+			-delta,
+			stockID,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// releaseOrderStock puts back in stock what an order still holds: the
+// quantities billed on its lines, less what its refunds restocked already.
+// The order is marked as released, so cancelling, archiving and purging it
+// only ever give its quantities back once.
+func releaseOrderStock(tx transaction, orderID int) error {
+	res, err := tx.Exec("UPDATE Orders SET stockReleased = TRUE WHERE ID = ? AND stockReleased = FALSE", orderID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil || affected == 0 {
+		return err
+	}
+
+	lines, err := heldQuantities(tx, orderID)
+	if err != nil {
+		return err
+	}
+	for _, line := range lines {
+		err = takeStock(tx, line.ProductID, line.VariantID, -line.Quantity)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// retakeOrderStock takes the quantities of a restored order out of stock
+// again, unless it was cancelled, failing with ErrInsufficientStock when a
+// line is no longer in stock.
+func retakeOrderStock(tx transaction, orderID int) error {
+	res, err := tx.Exec(
+		"UPDATE Orders SET stockReleased = FALSE WHERE ID = ? AND stockReleased = TRUE AND status <> ?",
+		orderID,
+		repositories.CancelledOrderStatus,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil || affected == 0 {
+		return err
+	}
+
+	lines, err := heldQuantities(tx, orderID)
+	if err != nil {
+		return err
+	}
+	for _, line := range lines {
+		err = takeStock(tx, line.ProductID, line.VariantID, line.Quantity)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func heldQuantities(tx transaction, orderID int) ([]repositories.OrderedProduct, error) {
+	var (
+		lines     []repositories.OrderedProduct
+		line      repositories.OrderedProduct
+		variantID *int
+	)
+
+	rows, err := tx.Query(
+		`SELECT po.productID, po.variantID, `+billedQuantity+` - COALESCE((
+				SELECT SUM(rp.quantity) FROM RefundedProducts rp JOIN Refunds r ON rp.refundID = r.ID
+				WHERE r.orderID = po.orderID AND r.restock = TRUE AND rp.productID = po.productID AND rp.variantID <=> po.variantID
+			), 0)
+		FROM ProductOrders po WHERE po.orderID = ?`,
+		orderID,
+	)
+	if err != nil {
+		return lines, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		err := rows.Scan(&line.ProductID, &variantID, &line.Quantity)
+		if err != nil {
+			return lines, err
+		}
+
+		line.VariantID = 0
+		if variantID != nil {
+			line.VariantID = *variantID
+		}
+		if line.Quantity > 0 {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines, rows.Err()
+}
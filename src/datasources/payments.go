@@ -0,0 +1,109 @@
+package datasources
+
+import (
+	"time"
+
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+func (client DBClient) InsertPayment(payment repositories.Payment) (int, error) {
+	res, err := client.db.Exec(
+		"INSERT INTO Payments(orderID, provider, operation, transactionID, status, amount, timestamp) VALUES(?, ?, ?, ?, ?, ?, ?)",
+		payment.OrderID,
+		payment.Provider,
+		payment.Operation,
+		payment.TransactionID,
+		payment.Status,
+		payment.Amount,
+		int(time.Now().UnixNano()/1000000000),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	paymentID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(paymentID), nil
+}
+
+func (client DBClient) GetPaymentsByOrderID(orderID int) (repositories.PaymentsJSON, error) {
+	var (
+		payments      []repositories.Payment
+		id            int
+		provider      string
+		operation     string
+		transactionID string
+		status        string
+		amount        float32
+		timestamp     int
+	)
+
+	rows, err := client.db.Query(
+		"SELECT ID, provider, operation, transactionID, status, amount, timestamp FROM Payments WHERE orderID = ? ORDER BY ID",
+		orderID,
+	)
+	if err != nil {
+		return repositories.PaymentsJSON{Payments: payments}, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		err := rows.Scan(&id, &provider, &operation, &transactionID, &status, &amount, &timestamp)
+		if err != nil {
+			return repositories.PaymentsJSON{Payments: payments}, err
+		}
+
+		payments = append(
+			payments,
+			repositories.Payment{
+				ID:            id,
+				OrderID:       orderID,
+				Provider:      provider,
+				Operation:     operation,
+				TransactionID: transactionID,
+				Status:        status,
+				Amount:        amount,
+				Timestamp:     timestamp,
+				Date:          ParseTimestamp(timestamp),
+			},
+		)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return repositories.PaymentsJSON{Payments: payments}, err
+	}
+
+	return repositories.PaymentsJSON{Payments: payments}, nil
+}
+
+// UpdateOrderStatus moves the order on as its payments go through; a
+// cancelled order gives its quantities back to stock.
+func (client DBClient) UpdateOrderStatus(orderID int, status string) error {
+	tx, err := client.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		"UPDATE Orders SET status = ?, version = version + 1 WHERE ID = ?",
+		status,
+		orderID,
+	)
+	if err != nil {
+		return err
+	}
+
+	if status == repositories.CancelledOrderStatus {
+		err = releaseOrderStock(tx, orderID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,221 @@
+package datasources
+
+import (
+	"database/sql"
+
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+func (client DBClient) GetPickupLocations(locationIDProvided ...int) (repositories.PickupLocationsJSON, error) {
+	var (
+		locationRows *sql.Rows
+		err          error
+
+		locations  []repositories.PickupLocation
+		id         int
+		name       string
+		street     string
+		number     string
+		postalCode string
+		city       string
+		county     string
+	)
+
+	query := "SELECT ID, name, street, streetNumber, postalCode, city, county FROM PickupLocations"
+
+	if len(locationIDProvided) == 1 {
+		locationRows, err = client.db.Query(query+" WHERE ID = ?", locationIDProvided[0])
+	} else {
+		locationRows, err = client.db.Query(query)
+	}
+	if err != nil {
+		return repositories.PickupLocationsJSON{PickupLocations: locations}, err
+	}
+
+	defer locationRows.Close()
+	for locationRows.Next() {
+		err := locationRows.Scan(&id, &name, &street, &number, &postalCode, &city, &county)
+		if err != nil {
+			return repositories.PickupLocationsJSON{PickupLocations: locations}, err
+		}
+
+		locations = append(
+			locations,
+			repositories.PickupLocation{
+				ID:         id,
+				Name:       name,
+				Street:     street,
+				Number:     number,
+				PostalCode: postalCode,
+				City:       city,
+				County:     county,
+			},
+		)
+	}
+
+	err = locationRows.Err()
+	if err != nil {
+		return repositories.PickupLocationsJSON{PickupLocations: locations}, err
+	}
+
+	for i := range locations {
+		locations[i].OpeningHours, err = client.getOpeningHours(locations[i].ID)
+		if err != nil {
+			return repositories.PickupLocationsJSON{PickupLocations: locations}, err
+		}
+	}
+
+	return repositories.PickupLocationsJSON{PickupLocations: locations}, nil
+}
+
+func (client DBClient) InsertPickupLocation(location repositories.PickupLocation) (repositories.PickupLocationIDResponse, error) {
+	tx, err := client.db.Begin()
+	if err != nil {
+		return repositories.PickupLocationIDResponse{PickupLocationID: 0}, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		"INSERT INTO PickupLocations(name, street, streetNumber, postalCode, city, county) VALUES(?, ?, ?, ?, ?, ?)",
+		location.Name,
+		location.Street,
+		location.Number,
+		location.PostalCode,
+		location.City,
+		location.County,
+	)
+	if err != nil {
+		return repositories.PickupLocationIDResponse{PickupLocationID: 0}, err
+	}
+
+	locationID, err := res.LastInsertId()
+	if err != nil {
+		return repositories.PickupLocationIDResponse{PickupLocationID: 0}, err
+	}
+
+	err = insertOpeningHours(tx, int(locationID), location.OpeningHours)
+	if err != nil {
+		return repositories.PickupLocationIDResponse{PickupLocationID: 0}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return repositories.PickupLocationIDResponse{PickupLocationID: 0}, err
+	}
+
+	return repositories.PickupLocationIDResponse{PickupLocationID: int(locationID)}, nil
+}
+
+func (client DBClient) EditPickupLocation(location repositories.PickupLocation) error {
+	tx, err := client.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		"UPDATE PickupLocations SET name = ?, street = ?, streetNumber = ?, postalCode = ?, city = ?, county = ? WHERE ID = ?",
+		location.Name,
+		location.Street,
+		location.Number,
+		location.PostalCode,
+		location.City,
+		location.County,
+		location.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM PickupLocationHours WHERE locationID = ?", location.ID)
+	if err != nil {
+		return err
+	}
+
+	err = insertOpeningHours(tx, location.ID, location.OpeningHours)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (client DBClient) DeletePickupLocation(locationID int) error {
+	_, err := client.db.Exec(
+		"DELETE FROM PickupLocationHours WHERE locationID = ?",
+		locationID,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.db.Exec(
+		"DELETE FROM PickupLocations WHERE ID = ?",
+		locationID,
+	)
+
+	return err
+}
+
+func insertOpeningHours(tx transaction, locationID int, hours []repositories.OpeningHours) error {
+	for _, interval := range hours {
+		_, err := tx.Exec(
+			"INSERT INTO PickupLocationHours(locationID, weekday, opens, closes) VALUES(?, ?, ?, ?)",
+			locationID,
+			interval.Weekday,
+			interval.Opens,
+			interval.Closes,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (client DBClient) getOpeningHours(locationID int) ([]repositories.OpeningHours, error) {
+	var (
+		hours   []repositories.OpeningHours
+		weekday int
+		opens   string
+		closes  string
+	)
+
+	rows, err := client.db.Query(
+		"SELECT weekday, opens, closes FROM PickupLocationHours WHERE locationID = ? ORDER BY weekday, opens",
+		locationID,
+	)
+	if err != nil {
+		return hours, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		err := rows.Scan(&weekday, &opens, &closes)
+		if err != nil {
+			return hours, err
+		}
+
+		hours = append(hours, repositories.OpeningHours{Weekday: weekday, Opens: opens, Closes: closes})
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return hours, err
+	}
+
+	return hours, nil
+}
+
+// MarkReadyForPickup records that a pickup order can be collected, leaving
+// its status, which follows its payment, as it is.
+func (client DBClient) MarkReadyForPickup(orderID int) error {
+	_, err := client.db.Exec(
+		"UPDATE Orders SET fulfilmentStatus = ?, version = version + 1 WHERE ID = ?",
+		repositories.ReadyForPickupStatus,
+		orderID,
+	)
+
+	return err
+}
@@ -0,0 +1,440 @@
+package datasources
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+var (
+	ErrScheduledPriceNotFound  = errors.New("the scheduled price change provided does not exist")
+	ErrScheduledPriceOverlaps  = errors.New("another promotion is scheduled for this product during the same period")
+	ErrScheduledPriceCompleted = errors.New("the scheduled price change was already applied, ended or cancelled")
+)
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// recordPriceChange adds a price change to the history of a product or of one
+// of its variants; prices set to what they already were are left out.
+func recordPriceChange(db execer, productID int, variantID int, previousPrice float32, price float32, source string, scheduledPriceID int, timestamp int) error {
+	if previousPrice == price {
+		return nil
+	}
+
+	_, err := db.Exec(
+		"INSERT INTO PriceHistory(productID, variantID, previousPrice, price, source, scheduledPriceID, timestamp) VALUES(?, ?, ?, ?, ?, ?, ?)",
+		productID,
+		nullableInt(variantID),
+		previousPrice,
+		price,
+		source,
+		nullableInt(scheduledPriceID),
+		timestamp,
+	)
+
+	return err
+}
+
+// setPrice changes the price of a product, or of one of its variants, and
+// records the change.
+func setPrice(tx transaction, productID int, variantID int, price float32, source string, scheduledPriceID int, timestamp int) (float32, error) {
+	var previousPrice float32
+
+	// the row holding the stock of a line also holds its price
+	table, rowID := stockOf(productID, variantID)
+	err := tx.QueryRow("SELECT price FROM "+table+" WHERE ID = ? FOR UPDATE", rowID).Scan(&previousPrice)
+	if err != nil {
+		return previousPrice, err
+	}
+
+	_, err = tx.Exec("UPDATE "+table+" SET price = ? WHERE ID = ?", price, rowID)
+	if err != nil {
+		return previousPrice, err
+	}
+	_, err = tx.Exec("UPDATE Products SET version = version + 1 WHERE ID = ?", productID)
+	if err != nil {
+		return previousPrice, err
+	}
+
+	return previousPrice, recordPriceChange(tx, productID, variantID, previousPrice, price, source, scheduledPriceID, timestamp)
+}
+
+func (client DBClient) GetPriceHistory(productID int) (repositories.PriceHistoryJSON, error) {
+	var (
+		prices           []repositories.PriceChange
+		change           repositories.PriceChange
+		variantID        *int
+		scheduledPriceID *int
+	)
+
+	rows, err := client.db.Query(
+		"SELECT ID, productID, variantID, previousPrice, price, source, scheduledPriceID, timestamp FROM PriceHistory WHERE productID = ? ORDER BY timestamp DESC, ID DESC",
+		productID,
+	)
+	if err != nil {
+		return repositories.PriceHistoryJSON{Prices: prices}, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		err := rows.Scan(&change.ID, &change.ProductID, &variantID, &change.PreviousPrice, &change.Price, &change.Source, &scheduledPriceID, &change.Timestamp)
+		if err != nil {
+			return repositories.PriceHistoryJSON{Prices: prices}, err
+		}
+
+		change.VariantID = 0
+		if variantID != nil {
+			change.VariantID = *variantID
+		}
+		change.ScheduledPriceID = 0
+		if scheduledPriceID != nil {
+			change.ScheduledPriceID = *scheduledPriceID
+		}
+		change.Date = ParseTimestamp(change.Timestamp)
+
+		prices = append(prices, change)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return repositories.PriceHistoryJSON{Prices: prices}, err
+	}
+
+	return repositories.PriceHistoryJSON{Prices: prices}, nil
+}
+
+func (client DBClient) GetScheduledPrices(productID int, status string) (repositories.ScheduledPricesJSON, error) {
+	condition := "WHERE 1 = 1"
+	var args []interface{}
+	if productID > 0 {
+		condition += " AND productID = ?"
+		args = append(args, productID)
+	}
+	if len(status) > 0 {
+		condition += " AND status = ?"
+		args = append(args, status)
+	}
+
+	return getScheduledPrices(client.db, condition, args...)
+}
+
+func (client DBClient) GetScheduledPrice(scheduledPriceID int) (repositories.ScheduledPrice, error) {
+	scheduled, err := getScheduledPrices(client.db, "WHERE ID = ?", scheduledPriceID)
+	if err != nil {
+		return repositories.ScheduledPrice{}, err
+	}
+	if len(scheduled.ScheduledPrices) != 1 {
+		return repositories.ScheduledPrice{}, ErrScheduledPriceNotFound
+	}
+
+	return scheduled.ScheduledPrices[0], nil
+}
+
+// InsertScheduledPrice refuses promotions overlapping another pending or
+// active promotion of the same product or variant, so that ending one always
+// knows which price to restore. Changes without an end may be scheduled at
+// any time.
+func (client DBClient) InsertScheduledPrice(change repositories.ScheduledPrice) (repositories.ScheduledPriceIDResponse, error) {
+	var overlapping int
+
+	tx, err := client.db.Begin()
+	if err != nil {
+		return repositories.ScheduledPriceIDResponse{ScheduledPriceID: 0}, err
+	}
+	defer tx.Rollback()
+
+	if change.EndTimestamp > 0 {
+		err = tx.QueryRow(`
+				SELECT COUNT(*) FROM ScheduledPrices
+				WHERE productID = ? AND variantID <=> ? AND status IN (?, ?) AND endTimestamp > ? AND startTimestamp < ?
+				FOR UPDATE
+			`,
+			change.ProductID,
+			nullableInt(change.VariantID),
+			repositories.PendingPriceChange,
+			repositories.ActivePriceChange,
+			change.StartTimestamp,
+			change.EndTimestamp,
+		).Scan(&overlapping)
+		if err != nil {
+			return repositories.ScheduledPriceIDResponse{ScheduledPriceID: 0}, err
+		}
+		if overlapping > 0 {
+			return repositories.ScheduledPriceIDResponse{ScheduledPriceID: 0}, ErrScheduledPriceOverlaps
+		}
+	}
+
+	res, err := tx.Exec(
+		"INSERT INTO ScheduledPrices(productID, variantID, price, startTimestamp, endTimestamp, status) VALUES(?, ?, ?, ?, ?, ?)",
+		change.ProductID,
+		nullableInt(change.VariantID),
+		change.Price,
+		change.StartTimestamp,
+		nullableInt(change.EndTimestamp),
+		repositories.PendingPriceChange,
+	)
+	if err != nil {
+		return repositories.ScheduledPriceIDResponse{ScheduledPriceID: 0}, err
+	}
+
+	scheduledPriceID, err := res.LastInsertId()
+	if err != nil {
+		return repositories.ScheduledPriceIDResponse{ScheduledPriceID: 0}, err
+	}
+
+	return repositories.ScheduledPriceIDResponse{ScheduledPriceID: int(scheduledPriceID)}, tx.Commit()
+}
+
+// CancelScheduledPrice drops a pending change. An active one is ended at now
+// instead, restoring its previous price on the next ApplyScheduledPrices.
+func (client DBClient) CancelScheduledPrice(scheduledPriceID int, now int) error {
+	change, err := client.GetScheduledPrice(scheduledPriceID)
+	if err != nil {
+		return err
+	}
+
+	var res sql.Result
+	switch change.Status {
+	case repositories.PendingPriceChange:
+		res, err = client.db.Exec(
+			"UPDATE ScheduledPrices SET status = ? WHERE ID = ? AND status = ?",
+			repositories.CancelledPriceChange,
+			scheduledPriceID,
+			repositories.PendingPriceChange,
+		)
+	case repositories.ActivePriceChange:
+		res, err = client.db.Exec(
+			"UPDATE ScheduledPrices SET endTimestamp = ? WHERE ID = ? AND status = ?",
+			now,
+			scheduledPriceID,
+			repositories.ActivePriceChange,
+		)
+	default:
+		return ErrScheduledPriceCompleted
+	}
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrScheduledPriceCompleted
+	}
+
+	return nil
+}
+
+// ApplyScheduledPrices ends the active changes whose time is up and starts
+// the pending ones whose time has come, returning how many it handled.
+// Ending a change restores the previous price only if the price was not
+// changed again in the meantime.
+func (client DBClient) ApplyScheduledPrices(now int) (int, error) {
+	tx, err := client.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	ending, err := getScheduledPrices(tx, "WHERE status = ? AND endTimestamp <= ? FOR UPDATE", repositories.ActivePriceChange, now)
+	if err != nil {
+		return 0, err
+	}
+	for _, change := range ending.ScheduledPrices {
+		var current float32
+		table, rowID := stockOf(change.ProductID, change.VariantID)
+		err = tx.QueryRow("SELECT price FROM "+table+" WHERE ID = ? FOR UPDATE", rowID).Scan(&current)
+		if err != nil && err != sql.ErrNoRows {
+			return 0, err
+		}
+		if err == nil && current == change.Price {
+			_, err = setPrice(tx, change.ProductID, change.VariantID, change.PreviousPrice, repositories.ScheduledPriceSource, change.ID, now)
+			if err != nil {
+				return 0, err
+			}
+			err = auditScheduledPrice(tx, change, current, change.PreviousPrice)
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		err = setScheduledPriceStatus(tx, change, repositories.EndedPriceChange)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	starting, err := getScheduledPrices(tx, "WHERE status = ? AND startTimestamp <= ? ORDER BY startTimestamp FOR UPDATE", repositories.PendingPriceChange, now)
+	if err != nil {
+		return 0, err
+	}
+	for _, change := range starting.ScheduledPrices {
+		if change.EndTimestamp > 0 && change.EndTimestamp <= now {
+			err = setScheduledPriceStatus(tx, change, repositories.SkippedPriceChange)
+			if err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		previousPrice, err := setPrice(tx, change.ProductID, change.VariantID, change.Price, repositories.ScheduledPriceSource, change.ID, now)
+		if err == sql.ErrNoRows {
+			err = setScheduledPriceStatus(tx, change, repositories.SkippedPriceChange)
+			if err != nil {
+				return 0, err
+			}
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		err = auditScheduledPrice(tx, change, previousPrice, change.Price)
+		if err != nil {
+			return 0, err
+		}
+
+		status := repositories.AppliedPriceChange
+		if change.EndTimestamp > 0 {
+			status = repositories.ActivePriceChange
+		}
+		_, err = tx.Exec("UPDATE ScheduledPrices SET status = ?, previousPrice = ? WHERE ID = ?", status, previousPrice, change.ID)
+		if err != nil {
+			return 0, err
+		}
+		applied := change
+		applied.Status = status
+		applied.PreviousPrice = previousPrice
+		err = recordSystemChange(tx, repositories.ScheduledPriceEntity, change.ID, repositories.UpdateOperation, change, applied)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(ending.ScheduledPrices) + len(starting.ScheduledPrices), tx.Commit()
+}
+
+// setScheduledPriceStatus ends or skips a scheduled change, and audits it
+// under the system actor.
+func setScheduledPriceStatus(tx transaction, change repositories.ScheduledPrice, status string) error {
+	_, err := tx.Exec("UPDATE ScheduledPrices SET status = ? WHERE ID = ?", status, change.ID)
+	if err != nil {
+		return err
+	}
+
+	after := change
+	after.Status = status
+
+	return recordSystemChange(tx, repositories.ScheduledPriceEntity, change.ID, repositories.UpdateOperation, change, after)
+}
+
+// auditScheduledPrice audits the price a scheduled change set on its product
+// or variant under the system actor.
+func auditScheduledPrice(tx transaction, change repositories.ScheduledPrice, previousPrice float32, price float32) error {
+	entity, entityID := repositories.ProductEntity, change.ProductID
+	if change.VariantID > 0 {
+		entity, entityID = repositories.ProductVariantEntity, change.VariantID
+	}
+
+	return recordSystemChange(
+		tx,
+		entity,
+		entityID,
+		repositories.UpdateOperation,
+		map[string]float32{"price": previousPrice},
+		map[string]float32{"price": price},
+	)
+}
+
+func getScheduledPrices(db querier, condition string, args ...interface{}) (repositories.ScheduledPricesJSON, error) {
+	var (
+		scheduled     []repositories.ScheduledPrice
+		change        repositories.ScheduledPrice
+		variantID     *int
+		previousPrice *float32
+		endTimestamp  *int
+	)
+
+	rows, err := db.Query(
+		"SELECT ID, productID, variantID, price, previousPrice, startTimestamp, endTimestamp, status FROM ScheduledPrices "+condition,
+		args...,
+	)
+	if err != nil {
+		return repositories.ScheduledPricesJSON{ScheduledPrices: scheduled}, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		err := rows.Scan(&change.ID, &change.ProductID, &variantID, &change.Price, &previousPrice, &change.StartTimestamp, &endTimestamp, &change.Status)
+		if err != nil {
+			return repositories.ScheduledPricesJSON{ScheduledPrices: scheduled}, err
+		}
+
+		change.VariantID = 0
+		if variantID != nil {
+			change.VariantID = *variantID
+		}
+		change.PreviousPrice = 0
+		if previousPrice != nil {
+			change.PreviousPrice = *previousPrice
+		}
+		change.StartDate = ParseTimestamp(change.StartTimestamp)
+		change.EndTimestamp = 0
+		change.EndDate = ""
+		if endTimestamp != nil {
+			change.EndTimestamp = *endTimestamp
+			change.EndDate = ParseTimestamp(*endTimestamp)
+		}
+
+		scheduled = append(scheduled, change)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return repositories.ScheduledPricesJSON{ScheduledPrices: scheduled}, err
+	}
+
+	return repositories.ScheduledPricesJSON{ScheduledPrices: scheduled}, nil
+}
+
+// withPromotions sets the price from before the active promotions on the
+// products and variants they lowered the price of.
+func (client DBClient) withPromotions(products []repositories.Product, positions map[int]int, placeholders string, args []interface{}) error {
+	active, err := getScheduledPrices(
+		client.db,
+		"WHERE status = ? AND productID IN ("+placeholders+")",
+		append([]interface{}{repositories.ActivePriceChange}, args...)...,
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, change := range active.ScheduledPrices {
+		product := &products[positions[change.ProductID]]
+		if change.VariantID == 0 {
+			if change.PreviousPrice > product.Price {
+				product.WasPrice = change.PreviousPrice
+				product.PromotionEnd = change.EndTimestamp
+			}
+			continue
+		}
+
+		for i := range product.Variants {
+			variant := &product.Variants[i]
+			if variant.ID == change.VariantID && change.PreviousPrice > variant.Price {
+				variant.WasPrice = change.PreviousPrice
+				variant.PromotionEnd = change.EndTimestamp
+			}
+		}
+	}
+
+	return nil
+}
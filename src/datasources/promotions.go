@@ -0,0 +1,319 @@
+package datasources
+
+import (
+	"encoding/json"
+
+	"github.com/mariacalinoiu/smartket/src/promotions"
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+// promotionRules holds the fields of a promotion that depend on its type;
+// they are stored as JSON in the rules column.
+type promotionRules struct {
+	ProductIDs   []int   `json:"productIDs,omitempty"`
+	BuyQuantity  int     `json:"buyQuantity,omitempty"`
+	FreeQuantity int     `json:"freeQuantity,omitempty"`
+	CategoryID   int     `json:"categoryID,omitempty"`
+	Percentage   float32 `json:"percentage,omitempty"`
+	Threshold    float32 `json:"threshold,omitempty"`
+	Amount       float32 `json:"amount,omitempty"`
+	BundlePrice  float32 `json:"bundlePrice,omitempty"`
+}
+
+func (client DBClient) GetPromotions(promotionIDProvided ...int) (repositories.PromotionsJSON, error) {
+	if len(promotionIDProvided) == 1 {
+		return client.getPromotions("WHERE ID = ?", promotionIDProvided[0])
+	}
+
+	return client.getPromotions("")
+}
+
+// GetActivePromotions returns the promotions that are switched on and within
+// their period at now.
+func (client DBClient) GetActivePromotions(now int) (repositories.PromotionsJSON, error) {
+	return client.getPromotions(
+		"WHERE active = TRUE AND (startTimestamp IS NULL OR startTimestamp <= ?) AND (endTimestamp IS NULL OR endTimestamp > ?)",
+		now,
+		now,
+	)
+}
+
+func (client DBClient) InsertPromotion(promotion repositories.Promotion) (repositories.PromotionIDResponse, error) {
+	rules, err := rulesOf(promotion)
+	if err != nil {
+		return repositories.PromotionIDResponse{PromotionID: 0}, err
+	}
+
+	res, err := client.db.Exec(
+		"INSERT INTO Promotions(name, type, priority, stackable, active, startTimestamp, endTimestamp, rules) VALUES(?, ?, ?, ?, ?, ?, ?, ?)",
+		promotion.Name,
+		promotion.Type,
+		promotion.Priority,
+		promotion.Stackable,
+		promotion.Active,
+		nullableInt(promotion.StartTimestamp),
+		nullableInt(promotion.EndTimestamp),
+		rules,
+	)
+	if err != nil {
+		return repositories.PromotionIDResponse{PromotionID: 0}, err
+	}
+
+	promotionID, err := res.LastInsertId()
+	if err != nil {
+		return repositories.PromotionIDResponse{PromotionID: 0}, err
+	}
+
+	return repositories.PromotionIDResponse{PromotionID: int(promotionID)}, nil
+}
+
+func (client DBClient) EditPromotion(promotion repositories.Promotion) error {
+	rules, err := rulesOf(promotion)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.db.Exec(
+		"UPDATE Promotions SET name = ?, type = ?, priority = ?, stackable = ?, active = ?, startTimestamp = ?, endTimestamp = ?, rules = ? WHERE ID = ?",
+		promotion.Name,
+		promotion.Type,
+		promotion.Priority,
+		promotion.Stackable,
+		promotion.Active,
+		nullableInt(promotion.StartTimestamp),
+		nullableInt(promotion.EndTimestamp),
+		rules,
+		promotion.ID,
+	)
+
+	return err
+}
+
+// DeletePromotion leaves the orders it was applied to as they are: their
+// lines keep the discounts and names of the promotions.
+func (client DBClient) DeletePromotion(promotionID int) error {
+	_, err := client.db.Exec(
+		"DELETE FROM Promotions WHERE ID = ?",
+		promotionID,
+	)
+
+	return err
+}
+
+// savePromotions evaluates the active promotions again on the lines of the
+// order as they are billed now, at the unit prices saved with them, and saves
+// the discounts they give.
+func savePromotions(tx transaction, orderID int, active []repositories.Promotion) error {
+	var (
+		orderedLines []repositories.OrderedProduct
+		lines        []promotions.Line
+		productID    int
+		variantID    *int
+		unitPrice    float32
+		quantity     float32
+		categoryID   int
+	)
+
+	parents, err := categoryParents(tx)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(
+		"SELECT po.productID, po.variantID, "+orderedPrice+", "+billedQuantity+", p.categoryID FROM ProductOrders po "+
+			"JOIN Products p ON po.productID = p.ID "+variantJoin+" WHERE po.orderID = ? ORDER BY po.productID, po.variantID",
+		orderID,
+	)
+	if err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		err := rows.Scan(&productID, &variantID, &unitPrice, &quantity, &categoryID)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+
+		line := repositories.OrderedProduct{ProductID: productID}
+		if variantID != nil {
+			line.VariantID = *variantID
+		}
+		orderedLines = append(orderedLines, line)
+		lines = append(lines, promotions.Line{
+			ProductID:   productID,
+			CategoryIDs: categoryAncestry(parents, categoryID),
+			UnitPrice:   unitPrice,
+			Quantity:    quantity,
+		})
+	}
+	rows.Close()
+
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+
+	for i, discount := range promotions.Apply(lines, active) {
+		line := orderedLines[i]
+		line.PromotionDiscount = discount.Total
+		line.Promotions = discount.Applied
+
+		applied, err := appliedPromotionsOf(line)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(
+			"UPDATE ProductOrders SET promotionDiscount = ?, promotions = ? WHERE orderID = ? AND productID = ? AND variantID <=> ?",
+			line.PromotionDiscount,
+			applied,
+			orderID,
+			line.ProductID,
+			nullableInt(line.VariantID),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// categoryParents maps every category to its parent, 0 for the top ones.
+func categoryParents(tx transaction) (map[int]int, error) {
+	var (
+		id       int
+		parentID *int
+	)
+
+	parents := make(map[int]int)
+	rows, err := tx.Query("SELECT ID, parentID FROM Categories")
+	if err != nil {
+		return parents, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		err := rows.Scan(&id, &parentID)
+		if err != nil {
+			return parents, err
+		}
+
+		parents[id] = 0
+		if parentID != nil {
+			parents[id] = *parentID
+		}
+	}
+
+	return parents, rows.Err()
+}
+
+// categoryAncestry lists the category along with all the categories above it.
+func categoryAncestry(parents map[int]int, categoryID int) []int {
+	var ancestry []int
+
+	visited := make(map[int]bool)
+	for categoryID != 0 && !visited[categoryID] {
+		visited[categoryID] = true
+		ancestry = append(ancestry, categoryID)
+		categoryID = parents[categoryID]
+	}
+
+	return ancestry
+}
+
+func (client DBClient) getPromotions(condition string, args ...interface{}) (repositories.PromotionsJSON, error) {
+	var (
+		promotions     []repositories.Promotion
+		promotion      repositories.Promotion
+		startTimestamp *int
+		endTimestamp   *int
+		rules          string
+	)
+
+	rows, err := client.db.Query(
+		"SELECT ID, name, type, priority, stackable, active, startTimestamp, endTimestamp, rules FROM Promotions "+condition+" ORDER BY priority DESC, ID",
+		args...,
+	)
+	if err != nil {
+		return repositories.PromotionsJSON{Promotions: promotions}, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		err := rows.Scan(&promotion.ID, &promotion.Name, &promotion.Type, &promotion.Priority, &promotion.Stackable, &promotion.Active, &startTimestamp, &endTimestamp, &rules)
+		if err != nil {
+			return repositories.PromotionsJSON{Promotions: promotions}, err
+		}
+
+		var typeRules promotionRules
+		err = json.Unmarshal([]byte(rules), &typeRules)
+		if err != nil {
+			return repositories.PromotionsJSON{Promotions: promotions}, err
+		}
+
+		promotion.StartTimestamp = 0
+		if startTimestamp != nil {
+			promotion.StartTimestamp = *startTimestamp
+		}
+		promotion.EndTimestamp = 0
+		if endTimestamp != nil {
+			promotion.EndTimestamp = *endTimestamp
+		}
+		promotion.ProductIDs = typeRules.ProductIDs
+		promotion.BuyQuantity = typeRules.BuyQuantity
+		promotion.FreeQuantity = typeRules.FreeQuantity
+		promotion.CategoryID = typeRules.CategoryID
+		promotion.Percentage = typeRules.Percentage
+		promotion.Threshold = typeRules.Threshold
+		promotion.Amount = typeRules.Amount
+		promotion.BundlePrice = typeRules.BundlePrice
+
+		promotions = append(promotions, promotion)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return repositories.PromotionsJSON{Promotions: promotions}, err
+	}
+
+	return repositories.PromotionsJSON{Promotions: promotions}, nil
+}
+
+func rulesOf(promotion repositories.Promotion) (string, error) {
+	rules, err := json.Marshal(promotionRules{
+		ProductIDs:   promotion.ProductIDs,
+		BuyQuantity:  promotion.BuyQuantity,
+		FreeQuantity: promotion.FreeQuantity,
+		CategoryID:   promotion.CategoryID,
+		Percentage:   promotion.Percentage,
+		Threshold:    promotion.Threshold,
+		Amount:       promotion.Amount,
+		BundlePrice:  promotion.BundlePrice,
+	})
+
+	return string(rules), err
+}
+
+func appliedPromotionsOf(line repositories.OrderedProduct) (interface{}, error) {
+	if len(line.Promotions) == 0 {
+		return nil, nil
+	}
+
+	applied, err := json.Marshal(line.Promotions)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(applied), nil
+}
+
+func promotionDiscountOf(products []repositories.OrderedProduct) float32 {
+	total := float32(0)
+	for _, product := range products {
+		total += product.PromotionDiscount
+	}
+
+	return roundToCents(total)
+}
@@ -0,0 +1,89 @@
+package datasources
+
+import (
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+// GetCoPurchases counts, for every pair of products, the orders containing
+// both of them; each pair is returned in both directions.
+func (client DBClient) GetCoPurchases() ([]repositories.CoPurchase, error) {
+	var (
+		coPurchases []repositories.CoPurchase
+		coPurchase  repositories.CoPurchase
+	)
+
+	rows, err := client.db.Query(`
+			SELECT a.productID, b.productID, COUNT(DISTINCT a.orderID)
+			FROM ProductOrders a
+			JOIN ProductOrders b
+			ON b.orderID = a.orderID AND b.productID <> a.productID
+			JOIN Orders o
+			ON a.orderID = o.ID
+			WHERE o.archivedTimestamp IS NULL AND o.status <> ?
+			GROUP BY a.productID, b.productID
+		`,
+		repositories.CancelledOrderStatus,
+	)
+	if err != nil {
+		return coPurchases, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		err := rows.Scan(&coPurchase.ProductID, &coPurchase.RelatedID, &coPurchase.Orders)
+		if err != nil {
+			return coPurchases, err
+		}
+
+		coPurchases = append(coPurchases, coPurchase)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return coPurchases, err
+	}
+
+	return coPurchases, nil
+}
+
+// GetProductSales returns the quantity sold of every product, including the
+// ones never ordered, from the best seller down.
+func (client DBClient) GetProductSales() ([]repositories.ProductSales, error) {
+	var (
+		sales   []repositories.ProductSales
+		product repositories.ProductSales
+	)
+
+	rows, err := client.db.Query(`
+			SELECT p.ID, p.categoryID, COALESCE(SUM(CASE WHEN o.ID IS NULL THEN 0 ELSE po.quantity END), 0)
+			FROM Products p
+			LEFT JOIN ProductOrders po
+			ON po.productID = p.ID
+			LEFT JOIN Orders o
+			ON po.orderID = o.ID AND o.archivedTimestamp IS NULL AND o.status <> ?
+			GROUP BY p.ID, p.categoryID
+			ORDER BY 3 DESC, p.ID
+		`,
+		repositories.CancelledOrderStatus,
+	)
+	if err != nil {
+		return sales, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		err := rows.Scan(&product.ProductID, &product.CategoryID, &product.Quantity)
+		if err != nil {
+			return sales, err
+		}
+
+		sales = append(sales, product)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return sales, err
+	}
+
+	return sales, nil
+}
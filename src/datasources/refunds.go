@@ -0,0 +1,263 @@
+package datasources
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+var (
+	ErrRefundExceedsOrder    = errors.New("the refunded amount exceeds the amount left on the order")
+	ErrRefundExceedsQuantity = errors.New("the refunded quantity exceeds the quantity left on the order")
+)
+
+// refundTolerance absorbs the rounding of the amounts summed in float32.
+const refundTolerance = 0.005
+
+// InsertRefund locks the order while it checks the refund against what is
+// left of orderTotal and of the refunded lines, so that concurrent refunds
+// can not together go over the order. The order is marked refunded once
+// nothing is left of it. Lines of an order whose stock was already released
+// are not restocked a second time.
+func (client DBClient) InsertRefund(refund repositories.Refund, orderTotal float32) (repositories.RefundIDResponse, error) {
+	var (
+		refunded      float32
+		stockReleased bool
+	)
+
+	tx, err := client.db.Begin()
+	if err != nil {
+		return repositories.RefundIDResponse{RefundID: 0}, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow("SELECT stockReleased FROM Orders WHERE ID = ? FOR UPDATE", refund.OrderID).Scan(&stockReleased)
+	if err == sql.ErrNoRows {
+		return repositories.RefundIDResponse{RefundID: 0}, ErrOrderNotFound
+	}
+	if err != nil {
+		return repositories.RefundIDResponse{RefundID: 0}, err
+	}
+
+	err = tx.QueryRow("SELECT COALESCE(SUM(amount), 0) FROM Refunds WHERE orderID = ?", refund.OrderID).Scan(&refunded)
+	if err != nil {
+		return repositories.RefundIDResponse{RefundID: 0}, err
+	}
+	if refunded+refund.Amount > orderTotal+refundTolerance {
+		return repositories.RefundIDResponse{RefundID: 0}, ErrRefundExceedsOrder
+	}
+
+	for _, product := range refund.ProductsRefunded {
+		err = checkRefundedQuantity(tx, refund.OrderID, product)
+		if err != nil {
+			return repositories.RefundIDResponse{RefundID: 0}, err
+		}
+	}
+
+	res, err := tx.Exec(
+		"INSERT INTO Refunds(orderID, type, amount, reason, operator, restock, timestamp) VALUES(?, ?, ?, ?, ?, ?, ?)",
+		refund.OrderID,
+		refund.Type,
+		refund.Amount,
+		refund.Reason,
+		refund.Operator,
+		refund.Restock,
+		int(time.Now().UnixNano()/1000000000),
+	)
+	if err != nil {
+		return repositories.RefundIDResponse{RefundID: 0}, err
+	}
+
+	refundID, err := res.LastInsertId()
+	if err != nil {
+		return repositories.RefundIDResponse{RefundID: 0}, err
+	}
+
+	for _, product := range refund.ProductsRefunded {
+		_, err = tx.Exec(
+			"INSERT INTO RefundedProducts(refundID, productID, variantID, quantity, amount) VALUES(?, ?, ?, ?, ?)",
+			refundID,
+			product.ProductID,
+			nullableInt(product.VariantID),
+			product.Quantity,
+			product.Amount,
+		)
+		if err != nil {
+			return repositories.RefundIDResponse{RefundID: 0}, err
+		}
+
+		if refund.Restock && !stockReleased {
+			table, id := stockOf(product.ProductID, product.VariantID)
+			_, err = tx.Exec(
+				"UPDATE "+table+" SET stock = stock + ? WHERE ID = ?",
+				product.Quantity,
+				id,
+			)
+			if err != nil {
+				return repositories.RefundIDResponse{RefundID: 0}, err
+			}
+		}
+	}
+
+	if refunded+refund.Amount >= orderTotal-refundTolerance {
+		_, err = tx.Exec(
+			"UPDATE Orders SET status = ?, version = version + 1 WHERE ID = ?",
+			repositories.RefundedOrderStatus,
+			refund.OrderID,
+		)
+		if err != nil {
+			return repositories.RefundIDResponse{RefundID: 0}, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return repositories.RefundIDResponse{RefundID: 0}, err
+	}
+
+	return repositories.RefundIDResponse{RefundID: int(refundID)}, nil
+}
+
+func checkRefundedQuantity(tx transaction, orderID int, product repositories.RefundedProduct) error {
+	var ordered, refunded float32
+
+	err := tx.QueryRow(
+		"SELECT "+billedQuantity+" FROM ProductOrders po WHERE orderID = ? AND productID = ? AND variantID <=> ?",
+		orderID,
+		product.ProductID,
+		nullableInt(product.VariantID),
+	).Scan(&ordered)
+	if err == sql.ErrNoRows {
+		return ErrRefundExceedsQuantity
+	}
+	if err != nil {
+		return err
+	}
+
+	err = tx.QueryRow(`
+			SELECT COALESCE(SUM(rp.quantity), 0)
+			FROM RefundedProducts rp
+			JOIN Refunds r
+			ON rp.refundID = r.ID
+			WHERE r.orderID = ? AND rp.productID = ? AND rp.variantID <=> ?
+		`,
+		orderID,
+		product.ProductID,
+		nullableInt(product.VariantID),
+	).Scan(&refunded)
+	if err != nil {
+		return err
+	}
+	if refunded+product.Quantity > ordered+refundTolerance {
+		return ErrRefundExceedsQuantity
+	}
+
+	return nil
+}
+
+func (client DBClient) GetRefundsByOrderID(orderID int) (repositories.RefundsJSON, float32, error) {
+	var (
+		refunds       []repositories.Refund
+		id            int
+		refundType    string
+		amount        float32
+		reason        string
+		operator      string
+		restock       bool
+		timestamp     int
+		refundedValue float32
+	)
+
+	rows, err := client.db.Query(
+		"SELECT ID, type, amount, reason, operator, restock, timestamp FROM Refunds WHERE orderID = ? ORDER BY ID",
+		orderID,
+	)
+	if err != nil {
+		return repositories.RefundsJSON{Refunds: refunds}, refundedValue, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		err := rows.Scan(&id, &refundType, &amount, &reason, &operator, &restock, &timestamp)
+		if err != nil {
+			return repositories.RefundsJSON{Refunds: refunds}, refundedValue, err
+		}
+
+		refundedValue += amount
+
+		refunds = append(
+			refunds,
+			repositories.Refund{
+				ID:        id,
+				OrderID:   orderID,
+				Type:      refundType,
+				Amount:    amount,
+				Reason:    reason,
+				Operator:  operator,
+				Restock:   restock,
+				Timestamp: timestamp,
+				Date:      ParseTimestamp(timestamp),
+			},
+		)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return repositories.RefundsJSON{Refunds: refunds}, refundedValue, err
+	}
+
+	for i := range refunds {
+		refunds[i].ProductsRefunded, err = client.getRefundedProducts(refunds[i].ID)
+		if err != nil {
+			return repositories.RefundsJSON{Refunds: refunds}, refundedValue, err
+		}
+	}
+
+	return repositories.RefundsJSON{Refunds: refunds}, refundedValue, nil
+}
+
+func (client DBClient) getRefundedProducts(refundID int) ([]repositories.RefundedProduct, error) {
+	var (
+		products  []repositories.RefundedProduct
+		productID int
+		variantID *int
+		quantity  float32
+		amount    float32
+	)
+
+	rows, err := client.db.Query(
+		"SELECT productID, variantID, quantity, amount FROM RefundedProducts WHERE refundID = ?",
+		refundID,
+	)
+	if err != nil {
+		return products, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		err := rows.Scan(&productID, &variantID, &quantity, &amount)
+		if err != nil {
+			return products, err
+		}
+
+		product := repositories.RefundedProduct{
+			ProductID: productID,
+			Quantity:  quantity,
+			Amount:    amount,
+		}
+		if variantID != nil {
+			product.VariantID = *variantID
+		}
+
+		products = append(products, product)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return products, err
+	}
+
+	return products, nil
+}
@@ -0,0 +1,167 @@
+package datasources
+
+import (
+	"errors"
+
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+var ErrUnknownReport = errors.New("unknown report grouping")
+
+// salesDimension groups report rows by key and names them by label; product
+// level dimensions only count refunds of specific products.
+type salesDimension struct {
+	key          string
+	label        string
+	productLevel bool
+	condition    string
+}
+
+const totalsDimension = "totals"
+
+var salesDimensions = map[string]salesDimension{
+	repositories.DayReport:           {key: "DATE_FORMAT(FROM_UNIXTIME(o.timestamp), '%Y-%m-%d')", label: "DATE_FORMAT(FROM_UNIXTIME(o.timestamp), '%Y-%m-%d')"},
+	repositories.WeekReport:          {key: "DATE_FORMAT(FROM_UNIXTIME(o.timestamp), '%x-W%v')", label: "DATE_FORMAT(FROM_UNIXTIME(o.timestamp), '%x-W%v')"},
+	repositories.MonthReport:         {key: "DATE_FORMAT(FROM_UNIXTIME(o.timestamp), '%Y-%m')", label: "DATE_FORMAT(FROM_UNIXTIME(o.timestamp), '%Y-%m')"},
+	repositories.DepartmentReport:    {key: "d.ID", label: "d.name", productLevel: true},
+	repositories.CategoryReport:      {key: "c.ID", label: "c.name", productLevel: true},
+	repositories.ProductReport:       {key: "p.ID", label: "p.name", productLevel: true},
+	repositories.CityReport:          {key: "o.city", label: "o.city"},
+	repositories.PaymentMethodReport: {key: "o.paymentMethod", label: "o.paymentMethod"},
+	repositories.VoucherReport:       {key: "o.voucherCode", label: "o.voucherCode", condition: " AND o.voucherCode IS NOT NULL"},
+	totalsDimension:                  {key: "'total'", label: "'total'"},
+}
+
+func (client DBClient) GetSalesReport(groupBy string, from int, to int) ([]repositories.SalesRow, error) {
+	dimension, ok := salesDimensions[groupBy]
+	if !ok {
+		return nil, ErrUnknownReport
+	}
+
+	return client.getSalesRows(dimension, from, to)
+}
+
+func (client DBClient) GetSalesTotals(from int, to int) (repositories.SalesRow, error) {
+	rows, err := client.getSalesRows(salesDimensions[totalsDimension], from, to)
+	if err != nil || len(rows) == 0 {
+		return repositories.SalesRow{Key: "total", Label: "total"}, err
+	}
+
+	return rows[0], nil
+}
+
+func (client DBClient) getSalesRows(dimension salesDimension, from int, to int) ([]repositories.SalesRow, error) {
+	var (
+		salesRows []repositories.SalesRow
+		row       repositories.SalesRow
+	)
+
+	filter := `WHERE o.archivedTimestamp IS NULL AND o.status <> ? AND o.timestamp >= ? AND o.timestamp < ?` + dimension.condition
+	args := []interface{}{repositories.CancelledOrderStatus, from, to}
+
+	rows, err := client.db.Query(`
+			SELECT CAST(`+dimension.key+` AS CHAR), `+dimension.label+`, COUNT(DISTINCT o.ID), SUM(`+billedQuantity+`),
+				SUM((`+orderedPrice+` * `+billedQuantity+` - po.promotionDiscount) * 100 / (100 + COALESCE(v.discountPercentage, 0))),
+				SUM((`+orderedPrice+` * `+billedQuantity+` - po.promotionDiscount) * COALESCE(v.discountPercentage, 0) / (100 + COALESCE(v.discountPercentage, 0)))
+			FROM Orders o
+			JOIN ProductOrders po
+			ON po.orderID = o.ID
+			JOIN Products p
+			ON po.productID = p.ID
+			`+variantJoin+`
+			JOIN Categories c
+			ON p.categoryID = c.ID
+			JOIN Departments d
+			ON c.departmentID = d.ID
+			LEFT JOIN Vouchers v
+			ON o.voucherCode = v.code
+			`+filter+`
+			GROUP BY 1, 2
+			ORDER BY 1
+		`,
+		args...,
+	)
+	if err != nil {
+		return salesRows, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		err := rows.Scan(&row.Key, &row.Label, &row.Orders, &row.Quantity, &row.Revenue, &row.Discount)
+		if err != nil {
+			return salesRows, err
+		}
+
+		salesRows = append(salesRows, row)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return salesRows, err
+	}
+
+	refunded, err := client.getRefundedByGroup(dimension, filter, args)
+	if err != nil {
+		return salesRows, err
+	}
+
+	for i := range salesRows {
+		salesRows[i].Revenue = roundToCents(salesRows[i].Revenue)
+		salesRows[i].Discount = roundToCents(salesRows[i].Discount)
+		salesRows[i].Refunded = roundToCents(refunded[salesRows[i].Key])
+		salesRows[i].NetRevenue = roundToCents(salesRows[i].Revenue - salesRows[i].Refunded)
+		if salesRows[i].Orders > 0 {
+			salesRows[i].AverageBasket = roundToCents(salesRows[i].Revenue / float32(salesRows[i].Orders))
+		}
+	}
+
+	return salesRows, nil
+}
+
+func (client DBClient) getRefundedByGroup(dimension salesDimension, filter string, args []interface{}) (map[string]float32, error) {
+	var (
+		refunded = make(map[string]float32)
+		key      string
+		amount   float32
+	)
+
+	query := `
+		SELECT CAST(` + dimension.key + ` AS CHAR), SUM(r.amount)
+		FROM Refunds r
+		JOIN Orders o
+		ON r.orderID = o.ID
+	`
+	if dimension.productLevel {
+		query = `
+			SELECT CAST(` + dimension.key + ` AS CHAR), SUM(rp.amount)
+			FROM RefundedProducts rp
+			JOIN Refunds r
+			ON rp.refundID = r.ID
+			JOIN Orders o
+			ON r.orderID = o.ID
+			JOIN Products p
+			ON rp.productID = p.ID
+			JOIN Categories c
+			ON p.categoryID = c.ID
+			JOIN Departments d
+			ON c.departmentID = d.ID
+		`
+	}
+
+	rows, err := client.db.Query(query+filter+" GROUP BY 1", args...)
+	if err != nil {
+		return refunded, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		err := rows.Scan(&key, &amount)
+		if err != nil {
+			return refunded, err
+		}
+
+		refunded[key] = amount
+	}
+
+	return refunded, rows.Err()
+}
@@ -0,0 +1,420 @@
+package datasources
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+var ErrNotDeliverable = errors.New("there is no delivery zone covering the address provided")
+
+func (client DBClient) GetAddresses(email string) (repositories.AddressesJSON, error) {
+	return client.getAddresses("WHERE email = ?", email)
+}
+
+func (client DBClient) GetAddress(addressID int) (repositories.Address, error) {
+	addresses, err := client.getAddresses("WHERE ID = ?", addressID)
+	if err != nil {
+		return repositories.Address{}, err
+	}
+	if len(addresses.Addresses) != 1 {
+		return repositories.Address{}, errors.New("the address provided does not exist")
+	}
+
+	return addresses.Addresses[0], nil
+}
+
+func (client DBClient) getAddresses(condition string, args ...interface{}) (repositories.AddressesJSON, error) {
+	var (
+		addresses  []repositories.Address
+		id         int
+		email      string
+		street     string
+		number     string
+		details    string
+		postalCode string
+		city       string
+		county     string
+		country    string
+	)
+
+	rows, err := client.db.Query(
+		"SELECT ID, email, street, streetNumber, details, postalCode, city, county, country FROM Addresses "+condition,
+		args...,
+	)
+	if err != nil {
+		return repositories.AddressesJSON{Addresses: addresses}, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		err := rows.Scan(&id, &email, &street, &number, &details, &postalCode, &city, &county, &country)
+		if err != nil {
+			return repositories.AddressesJSON{Addresses: addresses}, err
+		}
+
+		addresses = append(
+			addresses,
+			repositories.Address{
+				ID:         id,
+				Email:      email,
+				Street:     street,
+				Number:     number,
+				Details:    details,
+				PostalCode: postalCode,
+				City:       city,
+				County:     county,
+				Country:    country,
+			},
+		)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return repositories.AddressesJSON{Addresses: addresses}, err
+	}
+
+	return repositories.AddressesJSON{Addresses: addresses}, nil
+}
+
+func (client DBClient) InsertAddress(address repositories.Address) (repositories.AddressIDResponse, error) {
+	res, err := client.db.Exec(
+		"INSERT INTO Addresses(email, street, streetNumber, details, postalCode, city, county, country) VALUES(?, ?, ?, ?, ?, ?, ?, ?)",
+		address.Email,
+		address.Street,
+		address.Number,
+		address.Details,
+		address.PostalCode,
+		address.City,
+		address.County,
+		address.Country,
+	)
+	if err != nil {
+		return repositories.AddressIDResponse{AddressID: 0}, err
+	}
+
+	addressID, err := res.LastInsertId()
+	if err != nil {
+		return repositories.AddressIDResponse{AddressID: 0}, err
+	}
+
+	return repositories.AddressIDResponse{AddressID: int(addressID)}, nil
+}
+
+func (client DBClient) EditAddress(address repositories.Address) error {
+	_, err := client.db.Exec(
+		"UPDATE Addresses SET email = ?, street = ?, streetNumber = ?, details = ?, postalCode = ?, city = ?, county = ?, country = ? WHERE ID = ?",
+		address.Email,
+		address.Street,
+		address.Number,
+		address.Details,
+		address.PostalCode,
+		address.City,
+		address.County,
+		address.Country,
+		address.ID,
+	)
+
+	return err
+}
+
+func (client DBClient) DeleteAddress(addressID int) error {
+	_, err := client.db.Exec(
+		"DELETE FROM Addresses WHERE ID = ?",
+		addressID,
+	)
+
+	return err
+}
+
+func (client DBClient) GetDeliveryZones(zoneIDProvided ...int) (repositories.DeliveryZonesJSON, error) {
+	var (
+		zoneRows *sql.Rows
+		err      error
+
+		zones                 []repositories.DeliveryZone
+		id                    int
+		name                  string
+		shippingFee           float32
+		freeShippingThreshold float32
+	)
+
+	query := "SELECT ID, name, shippingFee, freeShippingThreshold FROM DeliveryZones"
+
+	if len(zoneIDProvided) == 1 {
+		zoneRows, err = client.db.Query(query+" WHERE ID = ?", zoneIDProvided[0])
+	} else {
+		zoneRows, err = client.db.Query(query)
+	}
+	if err != nil {
+		return repositories.DeliveryZonesJSON{DeliveryZones: zones}, err
+	}
+
+	defer zoneRows.Close()
+	for zoneRows.Next() {
+		err := zoneRows.Scan(&id, &name, &shippingFee, &freeShippingThreshold)
+		if err != nil {
+			return repositories.DeliveryZonesJSON{DeliveryZones: zones}, err
+		}
+
+		zones = append(
+			zones,
+			repositories.DeliveryZone{
+				ID:                    id,
+				Name:                  name,
+				ShippingFee:           shippingFee,
+				FreeShippingThreshold: freeShippingThreshold,
+			},
+		)
+	}
+
+	err = zoneRows.Err()
+	if err != nil {
+		return repositories.DeliveryZonesJSON{DeliveryZones: zones}, err
+	}
+
+	for i := range zones {
+		zones[i].Counties, zones[i].PostalCodePrefixes, err = client.getDeliveryZoneAreas(zones[i].ID)
+		if err != nil {
+			return repositories.DeliveryZonesJSON{DeliveryZones: zones}, err
+		}
+	}
+
+	return repositories.DeliveryZonesJSON{DeliveryZones: zones}, nil
+}
+
+func (client DBClient) InsertDeliveryZone(zone repositories.DeliveryZone) (repositories.DeliveryZoneIDResponse, error) {
+	tx, err := client.db.Begin()
+	if err != nil {
+		return repositories.DeliveryZoneIDResponse{DeliveryZoneID: 0}, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		"INSERT INTO DeliveryZones(name, shippingFee, freeShippingThreshold) VALUES(?, ?, ?)",
+		zone.Name,
+		zone.ShippingFee,
+		zone.FreeShippingThreshold,
+	)
+	if err != nil {
+		return repositories.DeliveryZoneIDResponse{DeliveryZoneID: 0}, err
+	}
+
+	zoneID, err := res.LastInsertId()
+	if err != nil {
+		return repositories.DeliveryZoneIDResponse{DeliveryZoneID: 0}, err
+	}
+
+	err = insertDeliveryZoneAreas(tx, int(zoneID), zone)
+	if err != nil {
+		return repositories.DeliveryZoneIDResponse{DeliveryZoneID: 0}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return repositories.DeliveryZoneIDResponse{DeliveryZoneID: 0}, err
+	}
+
+	return repositories.DeliveryZoneIDResponse{DeliveryZoneID: int(zoneID)}, nil
+}
+
+func (client DBClient) EditDeliveryZone(zone repositories.DeliveryZone) error {
+	tx, err := client.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		"UPDATE DeliveryZones SET name = ?, shippingFee = ?, freeShippingThreshold = ? WHERE ID = ?",
+		zone.Name,
+		zone.ShippingFee,
+		zone.FreeShippingThreshold,
+		zone.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM DeliveryZoneAreas WHERE zoneID = ?", zone.ID)
+	if err != nil {
+		return err
+	}
+
+	err = insertDeliveryZoneAreas(tx, zone.ID, zone)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (client DBClient) DeleteDeliveryZone(zoneID int) error {
+	_, err := client.db.Exec(
+		"DELETE FROM DeliveryZoneAreas WHERE zoneID = ?",
+		zoneID,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.db.Exec(
+		"DELETE FROM DeliveryZones WHERE ID = ?",
+		zoneID,
+	)
+
+	return err
+}
+
+// FindDeliveryZone prefers the zone with the longest matching postal code
+// prefix and falls back to a zone covering the whole county.
+func (client DBClient) FindDeliveryZone(address repositories.Address) (repositories.DeliveryZone, error) {
+	var zoneID int
+
+	err := client.db.QueryRow(`
+			SELECT zoneID
+			FROM DeliveryZoneAreas
+			WHERE (postalCodePrefix IS NOT NULL AND ? LIKE CONCAT(postalCodePrefix, '%'))
+				OR (postalCodePrefix IS NULL AND county = ?)
+			ORDER BY CHAR_LENGTH(COALESCE(postalCodePrefix, '')) DESC
+			LIMIT 1
+		`,
+		strings.TrimSpace(address.PostalCode),
+		strings.TrimSpace(address.County),
+	).Scan(&zoneID)
+	if err == sql.ErrNoRows {
+		return repositories.DeliveryZone{}, ErrNotDeliverable
+	}
+	if err != nil {
+		return repositories.DeliveryZone{}, err
+	}
+
+	zones, err := client.GetDeliveryZones(zoneID)
+	if err != nil {
+		return repositories.DeliveryZone{}, err
+	}
+	if len(zones.DeliveryZones) != 1 {
+		return repositories.DeliveryZone{}, ErrNotDeliverable
+	}
+
+	return zones.DeliveryZones[0], nil
+}
+
+func insertDeliveryZoneAreas(tx transaction, zoneID int, zone repositories.DeliveryZone) error {
+	for _, county := range zone.Counties {
+		_, err := tx.Exec("INSERT INTO DeliveryZoneAreas(zoneID, county, postalCodePrefix) VALUES(?, ?, NULL)", zoneID, county)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, prefix := range zone.PostalCodePrefixes {
+		_, err := tx.Exec("INSERT INTO DeliveryZoneAreas(zoneID, county, postalCodePrefix) VALUES(?, NULL, ?)", zoneID, prefix)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (client DBClient) getDeliveryZoneAreas(zoneID int) ([]string, []string, error) {
+	var (
+		counties []string
+		prefixes []string
+		county   *string
+		prefix   *string
+	)
+
+	rows, err := client.db.Query(
+		"SELECT county, postalCodePrefix FROM DeliveryZoneAreas WHERE zoneID = ?",
+		zoneID,
+	)
+	if err != nil {
+		return counties, prefixes, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		err := rows.Scan(&county, &prefix)
+		if err != nil {
+			return counties, prefixes, err
+		}
+
+		if county != nil {
+			counties = append(counties, *county)
+		}
+		if prefix != nil {
+			prefixes = append(prefixes, *prefix)
+		}
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return counties, prefixes, err
+	}
+
+	return counties, prefixes, nil
+}
+
+// saveShippingCost saves on the order what shipping costs it with its lines
+// and delivery zone as they are now, and the VAT rate it is taxed at (the
+// default tax class's); orders keep both when the zone's fee, its free
+// shipping threshold or the default rate change later.
+func saveShippingCost(tx transaction, orderID int) error {
+	var (
+		fee           *float32
+		freeThreshold *float32
+		discount      int
+		vatRate       float32
+		totalValue    float32
+	)
+
+	err := tx.QueryRow(`
+			SELECT z.shippingFee, z.freeShippingThreshold, COALESCE(v.discountPercentage, 0),
+				COALESCE((SELECT rate FROM TaxClasses WHERE isDefault = 1 LIMIT 1), 0)
+			FROM Orders o
+			LEFT JOIN DeliveryZones z
+			ON o.deliveryZoneID = z.ID
+			LEFT JOIN Vouchers v
+			ON o.voucherCode = v.code
+			WHERE o.ID = ?
+		`,
+		orderID,
+	).Scan(&fee, &freeThreshold, &discount, &vatRate)
+	if err != nil {
+		return err
+	}
+
+	err = tx.QueryRow(
+		"SELECT COALESCE(SUM("+orderedPrice+" * "+billedQuantity+" - po.promotionDiscount), 0) FROM ProductOrders po "+
+			"JOIN Products p ON po.productID = p.ID "+variantJoin+" WHERE po.orderID = ?",
+		orderID,
+	).Scan(&totalValue)
+	if err != nil {
+		return err
+	}
+
+	value := totalValue * 100 / (100 + float32(discount))
+	_, err = tx.Exec(
+		"UPDATE Orders SET shippingCost = ?, shippingVATRate = ? WHERE ID = ?",
+		shippingCostFor(fee, freeThreshold, value),
+		vatRate,
+		orderID,
+	)
+
+	return err
+}
+
+func shippingCostFor(fee *float32, freeShippingThreshold *float32, value float32) float32 {
+	if fee == nil {
+		return 0
+	}
+	if freeShippingThreshold != nil && *freeShippingThreshold > 0 && value >= *freeShippingThreshold {
+		return 0
+	}
+
+	return *fee
+}
@@ -0,0 +1,276 @@
+package datasources
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+var (
+	ErrSlotFull               = errors.New("the delivery slot is fully booked")
+	ErrSlotReservationInvalid = errors.New("the delivery slot reservation does not exist, has expired or was already used")
+)
+
+func (client DBClient) GetDeliverySlots(zoneID int) (repositories.DeliverySlotsJSON, error) {
+	return client.getDeliverySlots("WHERE zoneID = ? ORDER BY weekday, startTime", zoneID)
+}
+
+func (client DBClient) GetPickupSlots(pickupLocationID int) (repositories.DeliverySlotsJSON, error) {
+	return client.getDeliverySlots("WHERE pickupLocationID = ? ORDER BY weekday, startTime", pickupLocationID)
+}
+
+func (client DBClient) GetDeliverySlot(slotID int) (repositories.DeliverySlot, error) {
+	slots, err := client.getDeliverySlots("WHERE ID = ?", slotID)
+	if err != nil {
+		return repositories.DeliverySlot{}, err
+	}
+	if len(slots.DeliverySlots) != 1 {
+		return repositories.DeliverySlot{}, errors.New("the delivery slot provided does not exist")
+	}
+
+	return slots.DeliverySlots[0], nil
+}
+
+func (client DBClient) getDeliverySlots(condition string, args ...interface{}) (repositories.DeliverySlotsJSON, error) {
+	var (
+		slots            []repositories.DeliverySlot
+		id               int
+		zoneID           *int
+		pickupLocationID *int
+		weekday          int
+		startTime        string
+		endTime          string
+		capacity         int
+	)
+
+	rows, err := client.db.Query(
+		"SELECT ID, zoneID, pickupLocationID, weekday, startTime, endTime, capacity FROM DeliverySlots "+condition,
+		args...,
+	)
+	if err != nil {
+		return repositories.DeliverySlotsJSON{DeliverySlots: slots}, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		err := rows.Scan(&id, &zoneID, &pickupLocationID, &weekday, &startTime, &endTime, &capacity)
+		if err != nil {
+			return repositories.DeliverySlotsJSON{DeliverySlots: slots}, err
+		}
+
+		slot := repositories.DeliverySlot{
+			ID:        id,
+			Weekday:   weekday,
+			StartTime: startTime,
+			EndTime:   endTime,
+			Capacity:  capacity,
+		}
+		if zoneID != nil {
+			slot.DeliveryZoneID = *zoneID
+		}
+		if pickupLocationID != nil {
+			slot.PickupLocationID = *pickupLocationID
+		}
+
+		slots = append(slots, slot)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return repositories.DeliverySlotsJSON{DeliverySlots: slots}, err
+	}
+
+	return repositories.DeliverySlotsJSON{DeliverySlots: slots}, nil
+}
+
+func (client DBClient) InsertDeliverySlot(slot repositories.DeliverySlot) (repositories.DeliverySlotIDResponse, error) {
+	res, err := client.db.Exec(
+		"INSERT INTO DeliverySlots(zoneID, pickupLocationID, weekday, startTime, endTime, capacity) VALUES(?, ?, ?, ?, ?, ?)",
+		nullableInt(slot.DeliveryZoneID),
+		nullableInt(slot.PickupLocationID),
+		slot.Weekday,
+		slot.StartTime,
+		slot.EndTime,
+		slot.Capacity,
+	)
+	if err != nil {
+		return repositories.DeliverySlotIDResponse{DeliverySlotID: 0}, err
+	}
+
+	slotID, err := res.LastInsertId()
+	if err != nil {
+		return repositories.DeliverySlotIDResponse{DeliverySlotID: 0}, err
+	}
+
+	return repositories.DeliverySlotIDResponse{DeliverySlotID: int(slotID)}, nil
+}
+
+func (client DBClient) EditDeliverySlot(slot repositories.DeliverySlot) error {
+	_, err := client.db.Exec(
+		"UPDATE DeliverySlots SET zoneID = ?, pickupLocationID = ?, weekday = ?, startTime = ?, endTime = ?, capacity = ? WHERE ID = ?",
+		nullableInt(slot.DeliveryZoneID),
+		nullableInt(slot.PickupLocationID),
+		slot.Weekday,
+		slot.StartTime,
+		slot.EndTime,
+		slot.Capacity,
+		slot.ID,
+	)
+
+	return err
+}
+
+func (client DBClient) DeleteDeliverySlot(slotID int) error {
+	_, err := client.db.Exec(
+		"DELETE FROM DeliverySlots WHERE ID = ?",
+		slotID,
+	)
+
+	return err
+}
+
+func (client DBClient) GetSlotBookings(slotID int, date string) (int, error) {
+	return countSlotBookings(client.db, slotID, date)
+}
+
+func (client DBClient) ReserveDeliverySlot(reservation repositories.SlotReservation, ttl time.Duration) (repositories.SlotReservation, error) {
+	var capacity int
+
+	tx, err := client.db.Begin()
+	if err != nil {
+		return reservation, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(
+		"SELECT capacity FROM DeliverySlots WHERE ID = ? FOR UPDATE",
+		reservation.SlotID,
+	).Scan(&capacity)
+	if err == sql.ErrNoRows {
+		return reservation, errors.New("the delivery slot provided does not exist")
+	}
+	if err != nil {
+		return reservation, err
+	}
+
+	booked, err := countSlotBookings(tx, reservation.SlotID, reservation.Date)
+	if err != nil {
+		return reservation, err
+	}
+	if booked >= capacity {
+		return reservation, ErrSlotFull
+	}
+
+	expires := time.Now().Add(ttl)
+	res, err := tx.Exec(
+		"INSERT INTO SlotReservations(slotID, deliveryDate, email, expiresTimestamp) VALUES(?, ?, ?, ?)",
+		reservation.SlotID,
+		reservation.Date,
+		reservation.Email,
+		int(expires.UnixNano()/1000000000),
+	)
+	if err != nil {
+		return reservation, err
+	}
+
+	reservationID, err := res.LastInsertId()
+	if err != nil {
+		return reservation, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return reservation, err
+	}
+
+	reservation.ID = int(reservationID)
+	reservation.ExpiresTimestamp = int(expires.UnixNano() / 1000000000)
+	reservation.ExpiresDate = ParseTimestamp(reservation.ExpiresTimestamp)
+
+	return reservation, nil
+}
+
+func (client DBClient) GetSlotReservation(reservationID int) (repositories.SlotReservation, error) {
+	var (
+		slotID           int
+		date             string
+		email            string
+		expiresTimestamp int
+		orderID          *int
+	)
+
+	err := client.db.QueryRow(
+		"SELECT slotID, deliveryDate, email, expiresTimestamp, orderID FROM SlotReservations WHERE ID = ?",
+		reservationID,
+	).Scan(&slotID, &date, &email, &expiresTimestamp, &orderID)
+	if err == sql.ErrNoRows {
+		return repositories.SlotReservation{}, ErrSlotReservationInvalid
+	}
+	if err != nil {
+		return repositories.SlotReservation{}, err
+	}
+
+	reservation := repositories.SlotReservation{
+		ID:               reservationID,
+		SlotID:           slotID,
+		Date:             date,
+		Email:            email,
+		ExpiresTimestamp: expiresTimestamp,
+		ExpiresDate:      ParseTimestamp(expiresTimestamp),
+	}
+	if orderID != nil {
+		reservation.OrderID = *orderID
+	}
+
+	return reservation, nil
+}
+
+// consumeSlotReservation turns the reservation into the order's booking,
+// failing with ErrSlotReservationInvalid when it expired or was used since.
+func consumeSlotReservation(tx transaction, reservationID int, orderID int) error {
+	res, err := tx.Exec(
+		"UPDATE SlotReservations SET orderID = ? WHERE ID = ? AND orderID IS NULL AND expiresTimestamp > ?",
+		orderID,
+		reservationID,
+		int(time.Now().UnixNano()/1000000000),
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrSlotReservationInvalid
+	}
+
+	return nil
+}
+
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// countSlotBookings counts placed orders plus reservations that have neither
+// expired nor turned into an order yet.
+func countSlotBookings(db queryRower, slotID int, date string) (int, error) {
+	var booked int
+
+	err := db.QueryRow(`
+			SELECT
+				(SELECT COUNT(*) FROM Orders WHERE deliverySlotID = ? AND deliveryDate = ? AND archivedTimestamp IS NULL) +
+				(SELECT COUNT(*) FROM SlotReservations WHERE slotID = ? AND deliveryDate = ? AND orderID IS NULL AND expiresTimestamp > ?)
+		`,
+		slotID,
+		date,
+		slotID,
+		date,
+		int(time.Now().UnixNano()/1000000000),
+	).Scan(&booked)
+
+	return booked, err
+}
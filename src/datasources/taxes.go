@@ -0,0 +1,232 @@
+package datasources
+
+import (
+	"database/sql"
+	"math"
+	"sort"
+
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+// productTaxJoins and productVATRate resolve the VAT rate of a product aliased
+// as p: its own tax class, then its category's (inherited from the nearest
+// parent that has one), then the default tax class.
+const (
+	productTaxJoins = `
+		LEFT JOIN TaxClasses pt ON p.taxClassID = pt.ID
+		LEFT JOIN Categories tc ON p.categoryID = tc.ID
+		LEFT JOIN TaxClasses ct ON tc.effectiveTaxClassID = ct.ID
+	`
+	productVATRate = "COALESCE(pt.rate, ct.rate, (SELECT rate FROM TaxClasses WHERE isDefault = 1 LIMIT 1), 0)"
+)
+
+func (client DBClient) GetTaxClasses(taxClassIDProvided ...int) (repositories.TaxClassesJSON, error) {
+	var (
+		taxClassRows *sql.Rows
+		err          error
+
+		taxClasses []repositories.TaxClass
+		id         int
+		name       string
+		rate       float32
+		isDefault  bool
+	)
+
+	query := "SELECT ID, name, rate, isDefault FROM TaxClasses"
+
+	if len(taxClassIDProvided) == 1 {
+		taxClassRows, err = client.db.Query(query+" WHERE ID = ?", taxClassIDProvided[0])
+	} else {
+		taxClassRows, err = client.db.Query(query)
+	}
+	if err != nil {
+		return repositories.TaxClassesJSON{TaxClasses: taxClasses}, err
+	}
+
+	defer taxClassRows.Close()
+	for taxClassRows.Next() {
+		err := taxClassRows.Scan(&id, &name, &rate, &isDefault)
+		if err != nil {
+			return repositories.TaxClassesJSON{TaxClasses: taxClasses}, err
+		}
+
+		taxClasses = append(
+			taxClasses,
+			repositories.TaxClass{
+				ID:        id,
+				Name:      name,
+				Rate:      rate,
+				IsDefault: isDefault,
+			},
+		)
+	}
+
+	err = taxClassRows.Err()
+	if err != nil {
+		return repositories.TaxClassesJSON{TaxClasses: taxClasses}, err
+	}
+
+	return repositories.TaxClassesJSON{TaxClasses: taxClasses}, nil
+}
+
+func (client DBClient) InsertTaxClass(taxClass repositories.TaxClass) (repositories.TaxClassIDResponse, error) {
+	tx, err := client.db.Begin()
+	if err != nil {
+		return repositories.TaxClassIDResponse{TaxClassID: 0}, err
+	}
+	defer tx.Rollback()
+
+	if taxClass.IsDefault {
+		_, err = tx.Exec("UPDATE TaxClasses SET isDefault = 0")
+		if err != nil {
+			return repositories.TaxClassIDResponse{TaxClassID: 0}, err
+		}
+	}
+
+	res, err := tx.Exec(
+		"INSERT INTO TaxClasses(name, rate, isDefault) VALUES(?, ?, ?)",
+		taxClass.Name,
+		taxClass.Rate,
+		taxClass.IsDefault,
+	)
+	if err != nil {
+		return repositories.TaxClassIDResponse{TaxClassID: 0}, err
+	}
+
+	taxClassID, err := res.LastInsertId()
+	if err != nil {
+		return repositories.TaxClassIDResponse{TaxClassID: 0}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return repositories.TaxClassIDResponse{TaxClassID: 0}, err
+	}
+
+	return repositories.TaxClassIDResponse{TaxClassID: int(taxClassID)}, nil
+}
+
+func (client DBClient) EditTaxClass(taxClass repositories.TaxClass) error {
+	tx, err := client.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if taxClass.IsDefault {
+		_, err = tx.Exec("UPDATE TaxClasses SET isDefault = 0 WHERE ID <> ?", taxClass.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(
+		"UPDATE TaxClasses SET name = ?, rate = ?, isDefault = ? WHERE ID = ?",
+		taxClass.Name,
+		taxClass.Rate,
+		taxClass.IsDefault,
+		taxClass.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (client DBClient) DeleteTaxClass(taxClassID int) error {
+	tx, err := client.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE Categories SET taxClassID = NULL, version = version + 1 WHERE taxClassID = ?", taxClassID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE Products SET taxClassID = NULL, version = version + 1 WHERE taxClassID = ?", taxClassID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM TaxClasses WHERE ID = ?", taxClassID)
+	if err != nil {
+		return err
+	}
+
+	err = refreshEffectiveTaxClasses(tx)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (client DBClient) AssignTaxClass(assignment repositories.TaxClassAssignment) error {
+	table, id := "Categories", assignment.CategoryID
+	if assignment.ProductID > 0 {
+		table, id = "Products", assignment.ProductID
+	}
+
+	tx, err := client.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		"UPDATE "+table+" SET taxClassID = ?, version = version + 1 WHERE ID = ?",
+		nullableInt(assignment.TaxClassID),
+		id,
+	)
+	if err != nil {
+		return err
+	}
+
+	if table == "Categories" {
+		err = refreshEffectiveTaxClasses(tx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// vatBreakdown groups the tax-inclusive order lines per VAT rate, after the
+// promotion and voucher discounts, along with the shipping cost at its own
+// rate, and returns it with the total VAT.
+func vatBreakdown(products []repositories.OrderedProduct, discount int, shippingCost float32, shippingVATRate float32) ([]repositories.VATLine, float32) {
+	grossByRate := make(map[float32]float32)
+	for _, product := range products {
+		gross := (product.Product.Price*float32(product.Quantity) - product.PromotionDiscount) * 100 / (100 + float32(discount))
+		grossByRate[product.Product.VATRate] += gross
+	}
+	if shippingCost > 0 {
+		grossByRate[shippingVATRate] += shippingCost
+	}
+
+	var lines []repositories.VATLine
+	vatTotal := float32(0)
+	for rate, gross := range grossByRate {
+		gross = roundToCents(gross)
+		vat := roundToCents(gross * rate / (100 + rate))
+		vatTotal += vat
+
+		lines = append(lines, repositories.VATLine{
+			Rate:  rate,
+			Net:   roundToCents(gross - vat),
+			VAT:   vat,
+			Gross: gross,
+		})
+	}
+	sort.Slice(lines, func(i, j int) bool { return lines[i].Rate > lines[j].Rate })
+
+	return lines, roundToCents(vatTotal)
+}
+
+func roundToCents(value float32) float32 {
+	return float32(math.Round(float64(value)*100) / 100)
+}
@@ -0,0 +1,104 @@
+package datasources
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// conn is what a client runs its queries on: the database itself, or the
+// transaction of the request it serves.
+type conn interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Prepare(query string) (*sql.Stmt, error)
+	Begin() (transaction, error)
+}
+
+type transaction interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Prepare(query string) (*sql.Stmt, error)
+	Commit() error
+	Rollback() error
+}
+
+type database struct {
+	*sql.DB
+}
+
+func (db database) Begin() (transaction, error) {
+	return db.DB.Begin()
+}
+
+// requestTransaction turns the transactions begun inside it into savepoints,
+// so that they are only committed along with it.
+type requestTransaction struct {
+	*sql.Tx
+	savepoints *int
+}
+
+func (tx requestTransaction) Begin() (transaction, error) {
+	*tx.savepoints++
+	name := fmt.Sprintf("savepoint%d", *tx.savepoints)
+
+	_, err := tx.Exec("SAVEPOINT " + name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &savepoint{Tx: tx.Tx, name: name}, nil
+}
+
+type savepoint struct {
+	*sql.Tx
+	name string
+	done bool
+}
+
+func (point *savepoint) Commit() error {
+	if point.done {
+		return sql.ErrTxDone
+	}
+	point.done = true
+
+	_, err := point.Exec("RELEASE SAVEPOINT " + point.name)
+
+	return err
+}
+
+func (point *savepoint) Rollback() error {
+	if point.done {
+		return sql.ErrTxDone
+	}
+	point.done = true
+
+	_, err := point.Exec("ROLLBACK TO SAVEPOINT " + point.name)
+
+	return err
+}
+
+// InTransaction runs fn with a client whose every query, including those of
+// the transactions its methods begin, belongs to a single transaction. It is
+// committed when fn returns nil and rolled back otherwise; inside another
+// InTransaction it becomes a savepoint of the outer transaction.
+func (client DBClient) InTransaction(fn func(tx DBClient) error) error {
+	tx, err := client.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	inner := client.db
+	if begun, ok := tx.(*sql.Tx); ok {
+		inner = requestTransaction{Tx: begun, savepoints: new(int)}
+	}
+
+	err = fn(DBClient{db: inner})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
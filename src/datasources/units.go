@@ -0,0 +1,137 @@
+package datasources
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+var (
+	ErrOrderLineNotFound = errors.New("the product provided is not on the order")
+	ErrSoldByPiece       = errors.New("only the products sold by weight or volume can be weighed")
+)
+
+// An order line is billed by its actual quantity once it was weighed;
+// billedQuantity expects the line's table to be aliased po.
+const billedQuantity = "COALESCE(po.actualQuantity, po.quantity)"
+
+func (client DBClient) SetProductUnit(productID int, unit repositories.ProductUnitRequest) error {
+	_, err := client.db.Exec(
+		"UPDATE Products SET unit = ?, quantityStep = ?, minQuantity = ?, version = version + 1 WHERE ID = ?",
+		unit.Unit,
+		unit.QuantityStep,
+		unit.MinQuantity,
+		productID,
+	)
+
+	return err
+}
+
+// SetActualQuantities bills the lines of an order by the quantities measured
+// when picking them, and moves the difference from the ordered quantities in
+// or out of stock. The active promotions and the shipping cost are evaluated
+// again on the quantities billed. The order must not be invoiced, cancelled or
+// refunded yet.
+func (client DBClient) SetActualQuantities(orderID int, lines []repositories.ActualQuantity, active []repositories.Promotion) error {
+	var (
+		status   string
+		invoices int
+	)
+
+	tx, err := client.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(
+		"SELECT status FROM Orders WHERE ID = ? AND archivedTimestamp IS NULL FOR UPDATE",
+		orderID,
+	).Scan(&status)
+	if err == sql.ErrNoRows {
+		return ErrOrderNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if status == repositories.CancelledOrderStatus || status == repositories.RefundedOrderStatus {
+		return ErrOrderNotEditable
+	}
+
+	err = tx.QueryRow(
+		"SELECT COUNT(*) FROM Invoices WHERE kind = ? AND orderID = ?",
+		repositories.InvoiceDocument,
+		orderID,
+	).Scan(&invoices)
+	if err != nil {
+		return err
+	}
+	if invoices > 0 {
+		return ErrInvoiceAlreadyIssued
+	}
+
+	for _, line := range lines {
+		err = setActualQuantity(tx, orderID, line)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = savePromotions(tx, orderID, active)
+	if err != nil {
+		return err
+	}
+
+	err = saveShippingCost(tx, orderID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE Orders SET version = version + 1 WHERE ID = ?", orderID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func setActualQuantity(tx transaction, orderID int, line repositories.ActualQuantity) error {
+	var (
+		currentQuantity float32
+		unit            string
+	)
+
+	err := tx.QueryRow(
+		"SELECT "+billedQuantity+", p.unit FROM ProductOrders po JOIN Products p ON po.productID = p.ID "+
+			"WHERE po.orderID = ? AND po.productID = ? AND po.variantID <=> ? FOR UPDATE",
+		orderID,
+		line.ProductID,
+		nullableInt(line.VariantID),
+	).Scan(&currentQuantity, &unit)
+	if err == sql.ErrNoRows {
+		return ErrOrderLineNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if unit == repositories.PieceUnit {
+		return ErrSoldByPiece
+	}
+
+	err = takeStock(tx, line.ProductID, line.VariantID, line.ActualQuantity-currentQuantity)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		"UPDATE ProductOrders SET actualQuantity = ? WHERE orderID = ? AND productID = ? AND variantID <=> ?",
+		line.ActualQuantity,
+		orderID,
+		line.ProductID,
+		nullableInt(line.VariantID),
+	)
+
+	return err
+}
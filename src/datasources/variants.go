@@ -0,0 +1,344 @@
+package datasources
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+var ErrVariantInUse = errors.New("the variant was already ordered and can not be deleted")
+
+// The SKU of an ordered line is its variant's, when it has one; its price
+// and VAT rate are the ones saved with the line when it was ordered, so later
+// price or tax changes leave placed orders as they are. Lines from before
+// those were saved fall back to the current price and the default rate, as
+// the migrations backfill them. orderedSKU and orderedPrice expect the
+// Products and variantJoin joins, and the line's table to be aliased po.
+const (
+	variantJoin    = "LEFT JOIN ProductVariants pv ON po.variantID = pv.ID"
+	orderedPrice   = "COALESCE(po.unitPrice, pv.price, p.price)"
+	orderedVATRate = "COALESCE(po.vatRate, (SELECT rate FROM TaxClasses WHERE isDefault = 1 LIMIT 1), 0)"
+	orderedSKU     = "COALESCE(pv.sku, p.sku)"
+)
+
+// linePriceOf returns the current price of a line's variant, or of its
+// product when it has no variant, and the product's VAT rate, to be saved
+// with the line.
+func linePriceOf(tx transaction, productID int, variantID int) (float32, float32, error) {
+	var price, vatRate float32
+
+	err := tx.QueryRow(
+		"SELECT COALESCE(pv.price, p.price), "+productVATRate+" FROM Products p LEFT JOIN ProductVariants pv ON pv.ID = ? AND pv.productID = p.ID "+
+			productTaxJoins+" WHERE p.ID = ?",
+		nullableInt(variantID),
+		productID,
+	).Scan(&price, &vatRate)
+
+	return price, vatRate, err
+}
+
+// stockOf returns the table and the ID of the row holding the stock of a
+// line: its variant's when it has one, otherwise its product's.
+func stockOf(productID int, variantID int) (string, int) {
+	if variantID > 0 {
+		return "ProductVariants", variantID
+	}
+
+	return "Products", productID
+}
+
+func (client DBClient) GetProductVariants(productID int) ([]repositories.ProductVariant, error) {
+	return client.getVariants("WHERE productID = ?", productID)
+}
+
+func (client DBClient) GetProductVariant(variantID int) ([]repositories.ProductVariant, error) {
+	return client.getVariants("WHERE ID = ?", variantID)
+}
+
+func (client DBClient) InsertProductVariant(variant repositories.ProductVariant) (repositories.ProductVariantIDResponse, error) {
+	options, err := json.Marshal(variant.Options)
+	if err != nil {
+		return repositories.ProductVariantIDResponse{VariantID: 0}, err
+	}
+
+	res, err := client.db.Exec(
+		"INSERT INTO ProductVariants(productID, sku, barcode, options, price, stock) VALUES(?, ?, ?, ?, ?, ?)",
+		variant.ProductID,
+		variant.SKU,
+		nullableString(variant.Barcode),
+		string(options),
+		variant.Price,
+		variant.Stock,
+	)
+	if err != nil {
+		return repositories.ProductVariantIDResponse{VariantID: 0}, err
+	}
+
+	variantID, err := res.LastInsertId()
+	if err != nil {
+		return repositories.ProductVariantIDResponse{VariantID: 0}, err
+	}
+
+	_, err = client.db.Exec("UPDATE Products SET version = version + 1 WHERE ID = ?", variant.ProductID)
+	if err != nil {
+		return repositories.ProductVariantIDResponse{VariantID: 0}, err
+	}
+
+	return repositories.ProductVariantIDResponse{VariantID: int(variantID)}, nil
+}
+
+func (client DBClient) EditProductVariant(variant repositories.ProductVariant) error {
+	var previousPrice float32
+
+	options, err := json.Marshal(variant.Options)
+	if err != nil {
+		return err
+	}
+
+	tx, err := client.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow("SELECT price FROM ProductVariants WHERE ID = ? AND productID = ? FOR UPDATE", variant.ID, variant.ProductID).Scan(&previousPrice)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		"UPDATE ProductVariants SET sku = ?, barcode = ?, options = ?, price = ?, stock = ? WHERE ID = ? AND productID = ?",
+		variant.SKU,
+		nullableString(variant.Barcode),
+		string(options),
+		variant.Price,
+		variant.Stock,
+		variant.ID,
+		variant.ProductID,
+	)
+	if err != nil {
+		return err
+	}
+
+	err = recordPriceChange(tx, variant.ProductID, variant.ID, previousPrice, variant.Price, repositories.ManualPriceSource, 0, int(time.Now().UnixNano()/1000000000))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE Products SET version = version + 1 WHERE ID = ?", variant.ProductID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteProductVariant refuses to delete variants that orders still point to;
+// their stock can be set to 0 instead.
+func (client DBClient) DeleteProductVariant(variantID int) error {
+	var lines int
+
+	err := client.db.QueryRow("SELECT COUNT(*) FROM ProductOrders WHERE variantID = ?", variantID).Scan(&lines)
+	if err != nil {
+		return err
+	}
+	if lines > 0 {
+		return ErrVariantInUse
+	}
+
+	_, err = client.db.Exec("DELETE FROM CartProducts WHERE variantID = ?", variantID)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.db.Exec("UPDATE Products SET version = version + 1 WHERE ID = (SELECT productID FROM ProductVariants WHERE ID = ?)", variantID)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.db.Exec("DELETE FROM ProductVariants WHERE ID = ?", variantID)
+
+	return err
+}
+
+func (client DBClient) getVariants(condition string, args ...interface{}) ([]repositories.ProductVariant, error) {
+	var (
+		variants []repositories.ProductVariant
+		variant  repositories.ProductVariant
+		barcode  *string
+		options  string
+	)
+
+	rows, err := client.db.Query(
+		"SELECT ID, productID, sku, barcode, options, price, stock FROM ProductVariants "+condition+" ORDER BY productID, ID",
+		args...,
+	)
+	if err != nil {
+		return variants, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		err := rows.Scan(&variant.ID, &variant.ProductID, &variant.SKU, &barcode, &options, &variant.Price, &variant.Stock)
+		if err != nil {
+			return variants, err
+		}
+
+		variant.Barcode = ""
+		if barcode != nil {
+			variant.Barcode = *barcode
+		}
+		variant.Options = nil
+		err = json.Unmarshal([]byte(options), &variant.Options)
+		if err != nil {
+			return variants, err
+		}
+
+		variants = append(variants, variant)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return variants, err
+	}
+
+	return variants, nil
+}
+
+// withOrderedVariants sets the details of the variant on the ordered lines
+// that have one, naming the line after the variant's options.
+func (client DBClient) withOrderedVariants(products []repositories.OrderedProduct) error {
+	var variantIDs []int
+	for _, product := range products {
+		if product.VariantID > 0 {
+			variantIDs = append(variantIDs, product.VariantID)
+		}
+	}
+
+	variants, err := client.getVariantsByIDs(variantIDs)
+	if err != nil {
+		return err
+	}
+
+	for i := range products {
+		if variant, ok := variants[products[i].VariantID]; ok {
+			products[i].Variant = &variant
+			products[i].Product.Name = variantName(products[i].Product.Name, variant)
+		}
+	}
+
+	return nil
+}
+
+func (client DBClient) withCartVariants(products []repositories.CartProduct) error {
+	var variantIDs []int
+	for _, product := range products {
+		if product.VariantID > 0 {
+			variantIDs = append(variantIDs, product.VariantID)
+		}
+	}
+
+	variants, err := client.getVariantsByIDs(variantIDs)
+	if err != nil {
+		return err
+	}
+
+	for i := range products {
+		if variant, ok := variants[products[i].VariantID]; ok {
+			products[i].Variant = &variant
+			products[i].Product.Name = variantName(products[i].Product.Name, variant)
+			products[i].Product.Price = variant.Price
+		}
+	}
+
+	return nil
+}
+
+func (client DBClient) getVariantsByIDs(variantIDs []int) (map[int]repositories.ProductVariant, error) {
+	byID := make(map[int]repositories.ProductVariant)
+	if len(variantIDs) == 0 {
+		return byID, nil
+	}
+
+	args := make([]interface{}, len(variantIDs))
+	for i, variantID := range variantIDs {
+		args[i] = variantID
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(variantIDs)), ", ")
+
+	variants, err := client.getVariants("WHERE ID IN ("+placeholders+")", args...)
+	if err != nil {
+		return byID, err
+	}
+
+	for _, variant := range variants {
+		byID[variant.ID] = variant
+	}
+
+	return byID, nil
+}
+
+// withVariants loads the variants of the products and the option dimensions
+// they span.
+func (client DBClient) withVariants(products []repositories.Product, positions map[int]int, placeholders string, args []interface{}) error {
+	variants, err := client.getVariants("WHERE productID IN ("+placeholders+")", args...)
+	if err != nil {
+		return err
+	}
+
+	for _, variant := range variants {
+		i := positions[variant.ProductID]
+		products[i].Variants = append(products[i].Variants, variant)
+	}
+	for i := range products {
+		products[i].Options = productOptionsOf(products[i].Variants)
+	}
+
+	return nil
+}
+
+// productOptionsOf lists the option dimensions of the variants by name, each
+// with its values in the order the variants were added.
+func productOptionsOf(variants []repositories.ProductVariant) []repositories.ProductOption {
+	var names []string
+	values := make(map[string][]string)
+	seen := make(map[string]bool)
+	for _, variant := range variants {
+		for name, value := range variant.Options {
+			if _, ok := values[name]; !ok {
+				names = append(names, name)
+				values[name] = []string{}
+			}
+			if !seen[name+"\x00"+value] {
+				seen[name+"\x00"+value] = true
+				values[name] = append(values[name], value)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	var options []repositories.ProductOption
+	for _, name := range names {
+		options = append(options, repositories.ProductOption{Name: name, Values: values[name]})
+	}
+
+	return options
+}
+
+// variantName describes a variant by its product and options, as in
+// "Iaurt (pack: 6, size: 500g)".
+func variantName(productName string, variant repositories.ProductVariant) string {
+	var parts []string
+	for _, option := range productOptionsOf([]repositories.ProductVariant{variant}) {
+		parts = append(parts, option.Name+": "+option.Values[0])
+	}
+	if len(parts) == 0 {
+		return productName
+	}
+
+	return productName + " (" + strings.Join(parts, ", ") + ")"
+}
@@ -0,0 +1,79 @@
+package exports
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+type Column struct {
+	Name  string
+	Value func(line repositories.ExportLine) interface{}
+}
+
+// Columns lists every exportable column, in the order used by default.
+var Columns = []Column{
+	{"orderID", func(line repositories.ExportLine) interface{} { return line.OrderID }},
+	{"date", func(line repositories.ExportLine) interface{} {
+		return time.Unix(int64(line.Timestamp), 0).Format("2006-01-02 15:04:05")
+	}},
+	{"status", func(line repositories.ExportLine) interface{} { return line.Status }},
+	{"email", func(line repositories.ExportLine) interface{} { return line.Email }},
+	{"firstName", func(line repositories.ExportLine) interface{} { return line.FirstName }},
+	{"lastName", func(line repositories.ExportLine) interface{} { return line.LastName }},
+	{"city", func(line repositories.ExportLine) interface{} { return line.City }},
+	{"fulfilmentType", func(line repositories.ExportLine) interface{} { return line.FulfilmentType }},
+	{"paymentMethod", func(line repositories.ExportLine) interface{} { return line.PaymentMethod }},
+	{"voucherCode", func(line repositories.ExportLine) interface{} { return line.VoucherCode }},
+	{"discountPercentage", func(line repositories.ExportLine) interface{} { return line.DiscountPercentage }},
+	{"productID", func(line repositories.ExportLine) interface{} { return line.ProductID }},
+	{"sku", func(line repositories.ExportLine) interface{} { return line.SKU }},
+	{"productName", func(line repositories.ExportLine) interface{} { return line.ProductName }},
+	{"quantity", func(line repositories.ExportLine) interface{} { return quantity(line.Quantity) }},
+	{"unitPrice", func(line repositories.ExportLine) interface{} { return line.UnitPrice }},
+	{"promotionDiscount", func(line repositories.ExportLine) interface{} { return line.PromotionDiscount }},
+	{"vatRate", func(line repositories.ExportLine) interface{} { return line.VATRate }},
+	{"net", func(line repositories.ExportLine) interface{} { return line.Total - line.VAT }},
+	{"vat", func(line repositories.ExportLine) interface{} { return line.VAT }},
+	{"total", func(line repositories.ExportLine) interface{} { return line.Total }},
+}
+
+// ParseColumns picks the columns named in the comma separated list, in the
+// given order; an empty list selects all of them.
+func ParseColumns(list string) ([]Column, error) {
+	if len(strings.TrimSpace(list)) == 0 {
+		return Columns, nil
+	}
+
+	var selected []Column
+	for _, name := range strings.Split(list, ",") {
+		column, ok := columnNamed(strings.TrimSpace(name))
+		if !ok {
+			return nil, fmt.Errorf("unknown export column '%s'", name)
+		}
+		selected = append(selected, column)
+	}
+
+	return selected, nil
+}
+
+func columnNamed(name string) (Column, bool) {
+	for _, column := range Columns {
+		if strings.EqualFold(column.Name, name) {
+			return column, true
+		}
+	}
+
+	return Column{}, false
+}
+
+// quantity widens a quantity without the float32 rounding noise, so writers
+// print it with the decimals it has rather than as an amount of money.
+func quantity(value float32) float64 {
+	widened, _ := strconv.ParseFloat(strconv.FormatFloat(float64(value), 'f', -1, 32), 64)
+
+	return widened
+}
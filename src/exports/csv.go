@@ -0,0 +1,49 @@
+package exports
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+)
+
+const csvFlushRows = 500
+
+type csvWriter struct {
+	writer *csv.Writer
+	record []string
+	rows   int
+}
+
+func newCSVWriter(out io.Writer) *csvWriter {
+	return &csvWriter{writer: csv.NewWriter(out)}
+}
+
+func (w *csvWriter) Write(values []interface{}) error {
+	w.record = w.record[:0]
+	for _, value := range values {
+		switch typed := value.(type) {
+		case float32:
+			w.record = append(w.record, fmt.Sprintf("%.2f", typed))
+		default:
+			w.record = append(w.record, fmt.Sprint(typed))
+		}
+	}
+
+	err := w.writer.Write(w.record)
+	if err != nil {
+		return err
+	}
+
+	w.rows++
+	if w.rows%csvFlushRows == 0 {
+		w.writer.Flush()
+	}
+
+	return w.writer.Error()
+}
+
+func (w *csvWriter) Close() error {
+	w.writer.Flush()
+
+	return w.writer.Error()
+}
@@ -0,0 +1,69 @@
+package exports
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/mariacalinoiu/smartket/src/datasources"
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+const (
+	CSVFormat  = "csv"
+	XLSXFormat = "xlsx"
+)
+
+// rowWriter writes one table row at a time; Close flushes whatever the format
+// still needs after the last row.
+type rowWriter interface {
+	Write(values []interface{}) error
+	Close() error
+}
+
+func ContentType(format string) string {
+	if format == XLSXFormat {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+
+	return "text/csv; charset=utf-8"
+}
+
+// ExportOrders streams the order lines matching filter to out as they are
+// read, and returns how many it wrote.
+func ExportOrders(db datasources.DBClient, filter repositories.ExportFilter, format string, columns []Column, out io.Writer) (int, error) {
+	header := make([]interface{}, len(columns))
+	for i, column := range columns {
+		header[i] = column.Name
+	}
+
+	var writer rowWriter
+	switch format {
+	case CSVFormat:
+		writer = newCSVWriter(out)
+	case XLSXFormat:
+		writer = newXLSXWriter(out)
+	default:
+		return 0, fmt.Errorf("unknown export format '%s'", format)
+	}
+
+	err := writer.Write(header)
+	if err != nil {
+		return 0, err
+	}
+
+	rows := 0
+	values := make([]interface{}, len(columns))
+	err = db.StreamOrderLines(filter, func(line repositories.ExportLine) error {
+		for i, column := range columns {
+			values[i] = column.Value(line)
+		}
+		rows++
+
+		return writer.Write(values)
+	})
+	if err != nil {
+		return rows, err
+	}
+
+	return rows, writer.Close()
+}
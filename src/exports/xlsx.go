@@ -0,0 +1,99 @@
+package exports
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// the minimal parts of a workbook with a single sheet; cells use inline strings
+// so rows can be written as they come, without a shared strings table.
+var xlsxParts = []struct{ name, content string }{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Orders" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`},
+}
+
+type xlsxWriter struct {
+	archive *zip.Writer
+	sheet   *bufio.Writer
+	err     error
+}
+
+func newXLSXWriter(out io.Writer) *xlsxWriter {
+	w := &xlsxWriter{archive: zip.NewWriter(out)}
+
+	for _, part := range xlsxParts {
+		entry, err := w.archive.Create(part.name)
+		if err == nil {
+			_, err = io.WriteString(entry, part.content)
+		}
+		if err != nil {
+			w.err = err
+			return w
+		}
+	}
+
+	entry, err := w.archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		w.err = err
+		return w
+	}
+	w.sheet = bufio.NewWriter(entry)
+	_, w.err = w.sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+
+	return w
+}
+
+func (w *xlsxWriter) Write(values []interface{}) error {
+	if w.err != nil {
+		return w.err
+	}
+
+	w.sheet.WriteString("<row>")
+	for _, value := range values {
+		switch typed := value.(type) {
+		case int:
+			fmt.Fprintf(w.sheet, "<c><v>%d</v></c>", typed)
+		case float32:
+			fmt.Fprintf(w.sheet, "<c><v>%.2f</v></c>", typed)
+		case float64:
+			fmt.Fprintf(w.sheet, "<c><v>%s</v></c>", strconv.FormatFloat(typed, 'f', -1, 64))
+		default:
+			w.sheet.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+			w.err = xml.EscapeText(w.sheet, []byte(fmt.Sprint(typed)))
+			w.sheet.WriteString("</t></is></c>")
+		}
+	}
+	_, err := w.sheet.WriteString("</row>")
+	if w.err == nil {
+		w.err = err
+	}
+
+	return w.err
+}
+
+func (w *xlsxWriter) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+
+	_, err := w.sheet.WriteString("</sheetData></worksheet>")
+	if err == nil {
+		err = w.sheet.Flush()
+	}
+	if err != nil {
+		return err
+	}
+
+	return w.archive.Close()
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+const (
+	attributeParam    = "attr."
+	attributeMinParam = "attrMin."
+	attributeMaxParam = "attrMax."
+)
+
+// attributeFilter keeps the products whose attribute equals one of values
+// (or, for lists, contains one of them) and, for numbers, lies within min and max.
+type attributeFilter struct {
+	name   string
+	values []string
+	min    *float64
+	max    *float64
+}
+
+func validateAttributes(attributes []repositories.ProductAttribute) error {
+	seen := make(map[string]bool)
+	for _, attribute := range attributes {
+		if len(attribute.Name) < 1 || len(attribute.Name) > 255 {
+			return errors.New("every product attribute must have a name of at most 255 characters")
+		}
+		if seen[attribute.Name] {
+			return fmt.Errorf("the product attribute '%s' is sent more than once", attribute.Name)
+		}
+		seen[attribute.Name] = true
+
+		valid := false
+		switch attribute.Type {
+		case repositories.TextAttribute:
+			_, valid = attribute.Value.(string)
+		case repositories.NumberAttribute:
+			_, valid = attribute.Value.(float64)
+		case repositories.BooleanAttribute:
+			_, valid = attribute.Value.(bool)
+		case repositories.ListAttribute:
+			var items []interface{}
+			items, valid = attribute.Value.([]interface{})
+			for _, item := range items {
+				if _, ok := item.(string); !ok {
+					valid = false
+				}
+			}
+		default:
+			return fmt.Errorf("the type of the product attribute '%s' must be one of text, number, boolean or list", attribute.Name)
+		}
+		if !valid {
+			return fmt.Errorf("the value of the product attribute '%s' does not match its type '%s'", attribute.Name, attribute.Type)
+		}
+	}
+
+	return nil
+}
+
+// attributeFiltersOf reads attr.{name}=value, attrMin.{name}=number and
+// attrMax.{name}=number from the query; repeated values match any of them.
+func attributeFiltersOf(query url.Values) ([]attributeFilter, error) {
+	filters := make(map[string]*attributeFilter)
+	filterOf := func(name string) *attributeFilter {
+		if _, ok := filters[name]; !ok {
+			filters[name] = &attributeFilter{name: name}
+		}
+		return filters[name]
+	}
+
+	for param, values := range query {
+		switch {
+		case strings.HasPrefix(param, attributeParam):
+			filter := filterOf(strings.TrimPrefix(param, attributeParam))
+			filter.values = append(filter.values, values...)
+		case strings.HasPrefix(param, attributeMinParam), strings.HasPrefix(param, attributeMaxParam):
+			bound, err := strconv.ParseFloat(values[0], 64)
+			if err != nil {
+				return nil, fmt.Errorf("could not convert parameter '%s' to a number", param)
+			}
+			if strings.HasPrefix(param, attributeMinParam) {
+				filterOf(strings.TrimPrefix(param, attributeMinParam)).min = &bound
+			} else {
+				filterOf(strings.TrimPrefix(param, attributeMaxParam)).max = &bound
+			}
+		}
+	}
+
+	var sorted []attributeFilter
+	for _, filter := range filters {
+		sorted = append(sorted, *filter)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].name < sorted[j].name })
+
+	return sorted, nil
+}
+
+func filterByAttributes(products []repositories.Product, filters []attributeFilter) []repositories.Product {
+	filtered := []repositories.Product{}
+	for _, product := range products {
+		matches := true
+		for _, filter := range filters {
+			if !filter.matches(product) {
+				matches = false
+				break
+			}
+		}
+
+		if matches {
+			filtered = append(filtered, product)
+		}
+	}
+
+	return filtered
+}
+
+func (filter attributeFilter) matches(product repositories.Product) bool {
+	for _, attribute := range product.Attributes {
+		if attribute.Name != filter.name {
+			continue
+		}
+
+		if filter.min != nil || filter.max != nil {
+			number, ok := attribute.Value.(float64)
+			if !ok || (filter.min != nil && number < *filter.min) || (filter.max != nil && number > *filter.max) {
+				return false
+			}
+		}
+
+		if len(filter.values) == 0 {
+			return true
+		}
+		for _, value := range filter.values {
+			if attributeEquals(attribute, value) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return false
+}
+
+func attributeEquals(attribute repositories.ProductAttribute, value string) bool {
+	switch current := attribute.Value.(type) {
+	case string:
+		return strings.EqualFold(current, value)
+	case float64:
+		number, err := strconv.ParseFloat(value, 64)
+		return err == nil && number == current
+	case bool:
+		boolean, err := strconv.ParseBool(value)
+		return err == nil && boolean == current
+	case []interface{}:
+		for _, item := range current {
+			if text, ok := item.(string); ok && strings.EqualFold(text, value) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
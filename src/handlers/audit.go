@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/mariacalinoiu/smartket/src/audit"
+	"github.com/mariacalinoiu/smartket/src/datasources"
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+const anonymousActor = "anonymous"
+
+func HandleAudit(w http.ResponseWriter, r *http.Request, db datasources.DBClient, logger *log.Logger) {
+	var response []byte
+	var status int
+	var err error
+
+	switch r.Method {
+	case http.MethodGet:
+		response, status, err = getAuditEntries(r, db, logger)
+	default:
+		status = http.StatusBadRequest
+		err = errors.New("wrong method type for /audit route")
+	}
+
+	if err != nil {
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	_, err = w.Write(response)
+	if err != nil {
+		status = http.StatusInternalServerError
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	status = http.StatusOK
+	logger.Printf("Status: %d %s", status, http.StatusText(status))
+}
+
+func getAuditEntries(r *http.Request, db datasources.DBClient, logger *log.Logger) ([]byte, int, error) {
+	query := r.URL.Query()
+	filter := repositories.AuditFilter{
+		Actor:     query.Get("actor"),
+		Entity:    query.Get("entity"),
+		Operation: query.Get("operation"),
+	}
+
+	for name, value := range map[string]*int{"entityID": &filter.EntityID, "from": &filter.From, "to": &filter.To} {
+		if len(query.Get(name)) > 0 {
+			converted, err := strconv.Atoi(query.Get(name))
+			if err != nil {
+				return nil, http.StatusBadRequest, fmt.Errorf("could not convert parameter '%s' to integer", name)
+			}
+			*value = converted
+		}
+	}
+
+	entries, err := db.GetAuditEntries(filter)
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, http.StatusInternalServerError, errors.New("could not get audit entries")
+	}
+
+	response, err := json.Marshal(entries)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("could not marshal audit entries response json")
+	}
+
+	return response, http.StatusOK, nil
+}
+
+// isAdmin tells whether the request carries a valid admin token.
+func isAdmin(r *http.Request) bool {
+	actor, ok := r.Context().Value(actorKey).(string)
+
+	return ok && len(actor) > 0
+}
+
+// actorOf is the operator the request was authenticated as, or anonymous.
+func actorOf(r *http.Request) string {
+	if actor, ok := r.Context().Value(actorKey).(string); ok && len(actor) > 0 {
+		return actor
+	}
+
+	return anonymousActor
+}
+
+// recordAudit saves the audit entry in the request's transaction; when it
+// can not, the whole request is rolled back.
+func recordAudit(r *http.Request, db datasources.DBClient, logger *log.Logger, entity string, entityID int, operation string, before interface{}, after interface{}) {
+	changes, err := audit.Diff(before, after)
+	if err != nil {
+		logger.Printf("Audit error: %s; Entity: %s %d", err.Error(), entity, entityID)
+		auditFailed(r)
+		return
+	}
+
+	err = db.InsertAuditEntry(repositories.AuditEntry{
+		Actor:     actorOf(r),
+		Entity:    entity,
+		EntityID:  entityID,
+		Operation: operation,
+		Changes:   changes,
+	})
+	if err != nil {
+		logger.Printf("Audit error: %s; Entity: %s %d", err.Error(), entity, entityID)
+		auditFailed(r)
+	}
+}
+
+func auditFailed(r *http.Request) {
+	if state, ok := r.Context().Value(auditKey).(*auditState); ok {
+		state.failed = true
+	}
+}
+
+func orderSnapshot(db datasources.DBClient, orderID int) interface{} {
+	orders, err := db.GetOrders(orderID)
+	if err != nil || len(orders.Orders) != 1 {
+		return nil
+	}
+
+	return orders.Orders[0]
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/mariacalinoiu/smartket/src/datasources"
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+func HandleCarts(w http.ResponseWriter, r *http.Request, db datasources.DBClient, logger *log.Logger) {
+	var response []byte
+	var status int
+	var err error
+
+	switch r.Method {
+	case http.MethodGet:
+		response, status, err = getCarts(r, db, logger)
+	case http.MethodPost, http.MethodPut:
+		response, status, err = insertCart(r, db, logger, r.Method == http.MethodPut)
+	case http.MethodDelete:
+		status, err = deleteCart(r, db, logger)
+	default:
+		status = http.StatusBadRequest
+		err = errors.New("wrong method type for /carts route")
+	}
+
+	if err != nil {
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	_, err = w.Write(response)
+	if err != nil {
+		status = http.StatusInternalServerError
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	status = http.StatusOK
+	logger.Printf("Status: %d %s", status, http.StatusText(status))
+}
+
+func getCarts(r *http.Request, db datasources.DBClient, logger *log.Logger) ([]byte, int, error) {
+	var carts repositories.CartsJSON
+	var err error
+
+	params, ok := r.URL.Query()["cartID"]
+	if ok && len(params[0]) > 0 {
+		cartID, convErr := strconv.Atoi(params[0])
+		if convErr != nil {
+			return nil, http.StatusBadRequest, errors.New("could not convert parameter 'cartID' to integer")
+		}
+		carts, err = db.GetCarts(cartID)
+	} else {
+		if !isAdmin(r) {
+			return nil, http.StatusForbidden, errors.New("listing all the carts is restricted to admins")
+		}
+		carts, err = db.GetCarts()
+	}
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, http.StatusInternalServerError, errors.New("could not get carts")
+	}
+
+	response, err := json.Marshal(carts)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("could not marshal carts response json")
+	}
+
+	return response, http.StatusOK, nil
+}
+
+func extractCartParams(r *http.Request) (repositories.Cart, error) {
+	var unmarshalledCart repositories.Cart
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return repositories.Cart{}, err
+	}
+
+	err = json.Unmarshal(body, &unmarshalledCart)
+	if err != nil {
+		return repositories.Cart{}, err
+	}
+
+	return unmarshalledCart, nil
+}
+
+func insertCart(r *http.Request, db datasources.DBClient, logger *log.Logger, update bool) ([]byte, int, error) {
+	cart, err := extractCartParams(r)
+	cartID := repositories.CartIDResponse{CartID: cart.ID}
+
+	if err != nil || !isCartValid(cart) {
+		return nil, http.StatusBadRequest, errors.New("cart information sent on request body does not match required format")
+	}
+
+	var lines []quantityLine
+	for _, product := range cart.ProductsInCart {
+		lines = append(lines, quantityLine{
+			productLine: productLine{productID: product.ProductID, variantID: product.VariantID},
+			quantity:    product.Quantity,
+		})
+	}
+	if len(lines) > 0 {
+		status, err := checkProductLines(db, lines, logger)
+		if err != nil {
+			return nil, status, err
+		}
+	}
+
+	var before interface{}
+	operation := repositories.CreateOperation
+	if update {
+		before = cartSnapshot(db, cart.ID)
+		operation = repositories.UpdateOperation
+		err = db.EditCart(cart)
+	} else {
+		cartID, err = db.InsertCart(cart)
+	}
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, http.StatusInternalServerError, errors.New("could not save Cart")
+	}
+	recordAudit(r, db, logger, repositories.CartEntity, cartID.CartID, operation, before, cartSnapshot(db, cartID.CartID))
+
+	response, err := json.Marshal(cartID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("could not marshal cartID response json")
+	}
+
+	return response, http.StatusOK, nil
+}
+
+func deleteCart(r *http.Request, db datasources.DBClient, logger *log.Logger) (int, error) {
+	params, ok := r.URL.Query()["cartID"]
+
+	if !ok || len(params[0]) < 1 {
+		return http.StatusBadRequest, errors.New("mandatory parameter 'cartID' not found")
+	}
+
+	cartID, err := strconv.Atoi(params[0])
+	if err != nil {
+		return http.StatusBadRequest, errors.New("could not convert parameter 'cartID' to integer")
+	}
+	before := cartSnapshot(db, cartID)
+	err = db.DeleteCart(cartID)
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return http.StatusInternalServerError, errors.New("could not delete Cart")
+	}
+	recordAudit(r, db, logger, repositories.CartEntity, cartID, repositories.DeleteOperation, before, nil)
+
+	return http.StatusOK, nil
+}
+
+func isCartValid(cart repositories.Cart) bool {
+	if len(cart.Email) < 1 {
+		return false
+	}
+
+	for _, product := range cart.ProductsInCart {
+		if product.ProductID < 1 || product.Quantity <= 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func cartSnapshot(db datasources.DBClient, cartID int) interface{} {
+	carts, err := db.GetCarts(cartID)
+	if err != nil || len(carts.Carts) != 1 {
+		return nil
+	}
+
+	return carts.Carts[0]
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/mariacalinoiu/smartket/src/catalog"
+	"github.com/mariacalinoiu/smartket/src/datasources"
+)
+
+const maxCatalogSize = 10 << 20
+
+func HandleCatalogImport(w http.ResponseWriter, r *http.Request, db datasources.DBClient, logger *log.Logger) {
+	var response []byte
+	var status int
+	var err error
+
+	switch r.Method {
+	case http.MethodPost:
+		response, status, err = importCatalog(w, r, db, logger)
+	default:
+		status = http.StatusBadRequest
+		err = errors.New("wrong method type for /catalog/import route")
+	}
+
+	if err != nil {
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	// rejected imports still answer with the report listing the invalid rows
+	if status != http.StatusOK {
+		w.WriteHeader(status)
+	}
+	_, err = w.Write(response)
+	if err != nil {
+		status = http.StatusInternalServerError
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	logger.Printf("Status: %d %s", status, http.StatusText(status))
+}
+
+func importCatalog(w http.ResponseWriter, r *http.Request, db datasources.DBClient, logger *log.Logger) ([]byte, int, error) {
+	format := r.URL.Query().Get("format")
+	if len(format) == 0 {
+		format = catalog.FormatOf(r.Header.Get("Content-Type"))
+	}
+	if format != catalog.CSVFormat && format != catalog.JSONFormat {
+		return nil, http.StatusBadRequest, errors.New("parameter 'format' must be csv or json")
+	}
+	dryRun := r.URL.Query().Get("dryRun") == "true"
+
+	rows, parseErrs, err := catalog.Parse(http.MaxBytesReader(w, r.Body, maxCatalogSize), format)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	report, err := catalog.Import(db, rows, parseErrs, dryRun, actorOf(r), logger)
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, http.StatusInternalServerError, errors.New("could not import the catalog")
+	}
+
+	response, err := json.Marshal(report)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("could not marshal import report response json")
+	}
+	if len(report.Errors) > 0 {
+		return response, http.StatusUnprocessableEntity, nil
+	}
+
+	return response, http.StatusOK, nil
+}
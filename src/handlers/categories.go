@@ -3,11 +3,13 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"strconv"
 
 	"github.com/mariacalinoiu/smartket/src/datasources"
+	"github.com/mariacalinoiu/smartket/src/repositories"
 )
 
 func HandleCategories(w http.ResponseWriter, r *http.Request, db datasources.DBClient, logger *log.Logger) {
@@ -17,7 +19,9 @@ func HandleCategories(w http.ResponseWriter, r *http.Request, db datasources.DBC
 
 	switch r.Method {
 	case http.MethodGet:
-		response, status, err = getCategories(r, db, logger)
+		response, status, err = getCategories(r, w.Header(), db, logger)
+	case http.MethodPost, http.MethodPut:
+		response, status, err = insertCategory(r, w.Header(), db, logger, r.Method == http.MethodPut)
 	default:
 		status = http.StatusBadRequest
 		err = errors.New("wrong method type for /categories route")
@@ -25,6 +29,14 @@ func HandleCategories(w http.ResponseWriter, r *http.Request, db datasources.DBC
 
 	if err != nil {
 		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		if status == http.StatusPreconditionFailed {
+			err = writePreconditionFailed(w, response)
+			if err != nil {
+				logger.Printf("Error: %s", err.Error())
+			}
+
+			return
+		}
 		http.Error(w, err.Error(), status)
 
 		return
@@ -43,7 +55,28 @@ func HandleCategories(w http.ResponseWriter, r *http.Request, db datasources.DBC
 	logger.Printf("Status: %d %s", status, http.StatusText(status))
 }
 
-func getCategories(r *http.Request, db datasources.DBClient, logger *log.Logger) ([]byte, int, error) {
+// getCategories lists the categories of a department or, when categoryID is
+// given, returns that category with its version in the ETag header.
+func getCategories(r *http.Request, header http.Header, db datasources.DBClient, logger *log.Logger) ([]byte, int, error) {
+	if params, ok := r.URL.Query()["categoryID"]; ok && len(params[0]) > 0 {
+		categoryID, err := strconv.Atoi(params[0])
+		if err != nil {
+			return nil, http.StatusBadRequest, errors.New("could not convert parameter 'categoryID' to integer")
+		}
+		category, err := getCategory(db, categoryID)
+		if err != nil {
+			return nil, http.StatusNotFound, err
+		}
+
+		response, err := json.Marshal(category)
+		if err != nil {
+			return nil, http.StatusInternalServerError, errors.New("could not marshal category response json")
+		}
+		header.Set("ETag", etagFor(category.Version))
+
+		return response, http.StatusOK, nil
+	}
+
 	params, ok := r.URL.Query()["departmentID"]
 
 	if !ok || len(params[0]) < 1 {
@@ -67,3 +100,154 @@ func getCategories(r *http.Request, db datasources.DBClient, logger *log.Logger)
 
 	return response, http.StatusOK, nil
 }
+
+func HandleCatalogTree(w http.ResponseWriter, r *http.Request, db datasources.DBClient, logger *log.Logger) {
+	var response []byte
+	var status int
+	var err error
+
+	switch r.Method {
+	case http.MethodGet:
+		response, status, err = getCatalogTree(db, logger)
+	default:
+		status = http.StatusBadRequest
+		err = errors.New("wrong method type for /catalog/tree route")
+	}
+
+	if err != nil {
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	_, err = w.Write(response)
+	if err != nil {
+		status = http.StatusInternalServerError
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	status = http.StatusOK
+	logger.Printf("Status: %d %s", status, http.StatusText(status))
+}
+
+func getCatalogTree(db datasources.DBClient, logger *log.Logger) ([]byte, int, error) {
+	tree, err := db.GetCatalogTree()
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, http.StatusInternalServerError, errors.New("could not get catalog tree")
+	}
+
+	response, err := json.Marshal(tree)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("could not marshal catalog tree response json")
+	}
+
+	return response, http.StatusOK, nil
+}
+
+// insertCategory saves a category under a department or, when parentID is
+// set, under another category, whose department it then takes. Edits need
+// the category's version in If-Match.
+func insertCategory(r *http.Request, header http.Header, db datasources.DBClient, logger *log.Logger, update bool) ([]byte, int, error) {
+	var category repositories.Category
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &category)
+	}
+	if err != nil || len(category.Name) < 1 || category.ParentID < 0 || (category.DepartmentId < 1 && category.ParentID < 1) {
+		return nil, http.StatusBadRequest, errors.New("category information sent on request body does not match required format")
+	}
+
+	if category.ParentID > 0 {
+		parent, getErr := getCategory(db, category.ParentID)
+		if getErr != nil {
+			return nil, http.StatusBadRequest, errors.New("the parent category provided does not exist")
+		}
+		category.DepartmentId = parent.DepartmentId
+	} else if !departmentExists(db, category.DepartmentId) {
+		return nil, http.StatusBadRequest, errors.New("the department provided does not exist")
+	}
+
+	categoryID := repositories.CategoryIDResponse{CategoryID: category.ID}
+	var before interface{}
+	operation := repositories.CreateOperation
+	if update {
+		category.Version, err = versionFromIfMatch(r)
+		if err != nil {
+			return nil, http.StatusPreconditionRequired, err
+		}
+		current, getErr := getCategory(db, category.ID)
+		if getErr != nil {
+			return nil, http.StatusNotFound, getErr
+		}
+		before = current
+		operation = repositories.UpdateOperation
+		err = db.EditCategory(category)
+	} else {
+		categoryID, err = db.InsertCategory(category)
+		category.ID = categoryID.CategoryID
+	}
+	if err == datasources.ErrVersionConflict {
+		current, getErr := getCategory(db, category.ID)
+		if getErr != nil {
+			return nil, http.StatusNotFound, getErr
+		}
+		response, marshalErr := json.Marshal(current)
+		if marshalErr != nil {
+			return nil, http.StatusInternalServerError, errors.New("could not marshal category response json")
+		}
+		header.Set("ETag", etagFor(current.Version))
+
+		return response, http.StatusPreconditionFailed, err
+	}
+	if err == datasources.ErrCategoryCycle {
+		return nil, http.StatusBadRequest, err
+	}
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, http.StatusInternalServerError, errors.New("could not save Category")
+	}
+	saved, err := getCategory(db, category.ID)
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, http.StatusInternalServerError, errors.New("could not get saved Category")
+	}
+	recordAudit(r, db, logger, repositories.CategoryEntity, category.ID, operation, before, saved)
+	header.Set("ETag", etagFor(saved.Version))
+
+	response, err := json.Marshal(categoryID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("could not marshal categoryID response json")
+	}
+
+	return response, http.StatusOK, nil
+}
+
+func getCategory(db datasources.DBClient, categoryID int) (repositories.Category, error) {
+	categories, err := db.GetCategories(categoryID)
+	if err != nil || len(categories.Categories) != 1 {
+		return repositories.Category{}, errors.New("the category provided does not exist")
+	}
+
+	return categories.Categories[0], nil
+}
+
+func departmentExists(db datasources.DBClient, departmentID int) bool {
+	departments, err := db.GetDepartments()
+	if err != nil {
+		return false
+	}
+
+	for _, department := range departments.Departments {
+		if department.ID == departmentID {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/mariacalinoiu/smartket/src/datasources"
+	"github.com/mariacalinoiu/smartket/src/exports"
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+const (
+	exportDateLayout = "2006-01-02"
+
+	// exportRowCountTrailer carries the number of rows of a complete export;
+	// exports cut off on the way lack it.
+	exportRowCountTrailer = "X-Row-Count"
+)
+
+func HandleOrdersExport(w http.ResponseWriter, r *http.Request, db datasources.DBClient, logger *log.Logger) {
+	var status int
+	var err error
+
+	switch r.Method {
+	case http.MethodGet:
+		status, err = exportOrders(w, r, db)
+	default:
+		status = http.StatusBadRequest
+		err = errors.New("wrong method type for /orders/export route")
+	}
+
+	// once streaming started the status is already sent, so errors can only be logged
+	if err != nil && status == http.StatusOK {
+		logger.Printf("Export error: %s", err.Error())
+		return
+	}
+	if err != nil {
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	logger.Printf("Status: %d %s", status, http.StatusText(status))
+}
+
+func exportOrders(w http.ResponseWriter, r *http.Request, db datasources.DBClient) (int, error) {
+	query := r.URL.Query()
+
+	format := query.Get("format")
+	if len(format) == 0 {
+		format = exports.CSVFormat
+	}
+	if format != exports.CSVFormat && format != exports.XLSXFormat {
+		return http.StatusBadRequest, errors.New("parameter 'format' must be csv or xlsx")
+	}
+
+	columns, err := exports.ParseColumns(query.Get("columns"))
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	from, to, err := dateRangeOf(query)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	filter := repositories.ExportFilter{From: from, To: to, Status: query.Get("status")}
+
+	w.Header().Set("Content-Type", exports.ContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="orders-%s.%s"`, time.Now().Format(exportDateLayout), format))
+	// the row count follows the body as a trailer, so it is only sent once
+	// the whole export was written
+	w.Header().Set("Trailer", exportRowCountTrailer)
+
+	rows, err := exports.ExportOrders(db, filter, format, columns, w)
+	if err != nil {
+		return http.StatusOK, err
+	}
+	w.Header().Set(exportRowCountTrailer, strconv.Itoa(rows))
+
+	return http.StatusOK, nil
+}
+
+// dateRangeOf reads the optional, inclusive 'from' and 'to' dates as
+// timestamps, with 'to' pointing right after the end of its day.
+func dateRangeOf(query url.Values) (int, int, error) {
+	from, to := 0, int(time.Now().Unix())+1
+
+	if len(query.Get("from")) > 0 {
+		date, err := time.ParseInLocation(exportDateLayout, query.Get("from"), time.Local)
+		if err != nil {
+			return 0, 0, errors.New("parameter 'from' must have the format YYYY-MM-DD")
+		}
+		from = int(date.Unix())
+	}
+	if len(query.Get("to")) > 0 {
+		date, err := time.ParseInLocation(exportDateLayout, query.Get("to"), time.Local)
+		if err != nil {
+			return 0, 0, errors.New("parameter 'to' must have the format YYYY-MM-DD")
+		}
+		to = int(date.AddDate(0, 0, 1).Unix())
+	}
+	if from >= to {
+		return 0, 0, errors.New("parameter 'from' must be before 'to'")
+	}
+
+	return from, to, nil
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/mariacalinoiu/smartket/src/datasources"
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (recorder *responseRecorder) WriteHeader(status int) {
+	recorder.status = status
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+func (recorder *responseRecorder) Write(body []byte) (int, error) {
+	if recorder.status == 0 {
+		recorder.status = http.StatusOK
+	}
+	recorder.body.Write(body)
+
+	return recorder.ResponseWriter.Write(body)
+}
+
+// Idempotent replays the stored response of the first POST/PUT carrying the same
+// Idempotency-Key, as long as it was sent within window and with the same body.
+func Idempotent(db datasources.DBClient, window time.Duration, logger *log.Logger, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if len(key) == 0 || (r.Method != http.MethodPost && r.Method != http.MethodPut) {
+			next(w, r)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			status := http.StatusBadRequest
+			logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+			http.Error(w, "could not read request body", status)
+
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		hash := sha256.Sum256(append([]byte(r.Method+" "+r.URL.Path+"\n"), body...))
+		requestHash := hex.EncodeToString(hash[:])
+		expiredBefore := int(time.Now().Add(-window).UnixNano() / 1000000000)
+
+		stored, reserved, err := db.ReserveIdempotencyKey(key, requestHash, expiredBefore)
+		if err != nil {
+			status := http.StatusInternalServerError
+			logger.Printf("Internal error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+			http.Error(w, "could not check Idempotency-Key", status)
+
+			return
+		}
+
+		if !reserved {
+			replayIdempotentResponse(w, stored, requestHash, logger)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: w}
+		next(recorder, r)
+
+		if recorder.status >= http.StatusInternalServerError {
+			err = db.ReleaseIdempotencyKey(key)
+		} else {
+			err = db.CompleteIdempotencyKey(repositories.IdempotentResponse{
+				Key:    key,
+				Status: recorder.status,
+				Body:   recorder.body.Bytes(),
+				ETag:   w.Header().Get("ETag"),
+			})
+		}
+		if err != nil {
+			logger.Printf("Idempotency error: %s; Key: %s", err.Error(), key)
+		}
+	}
+}
+
+func replayIdempotentResponse(w http.ResponseWriter, stored repositories.IdempotentResponse, requestHash string, logger *log.Logger) {
+	var status int
+	var message string
+
+	switch {
+	case stored.RequestHash != requestHash:
+		status = http.StatusUnprocessableEntity
+		message = "the Idempotency-Key was already used with a different request"
+	case !stored.Completed:
+		status = http.StatusConflict
+		message = "a request with the same Idempotency-Key is still being processed"
+	}
+
+	if status != 0 {
+		logger.Printf("Error: %s; Status: %d %s", message, status, http.StatusText(status))
+		http.Error(w, message, status)
+
+		return
+	}
+
+	if len(stored.ETag) > 0 {
+		w.Header().Set("ETag", stored.ETag)
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(stored.Status)
+
+	_, err := w.Write(stored.Body)
+	if err != nil {
+		logger.Printf("Error: %s", err.Error())
+		return
+	}
+
+	logger.Printf("Status: %d %s (replayed)", stored.Status, http.StatusText(stored.Status))
+}
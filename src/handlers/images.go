@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mariacalinoiu/smartket/src/datasources"
+	"github.com/mariacalinoiu/smartket/src/images"
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+// multipartOverhead is allowed on top of the image size for the rest of the
+// form.
+const multipartOverhead = 1 << 20
+
+func HandleImages(w http.ResponseWriter, r *http.Request, db datasources.DBClient, store *images.Store, logger *log.Logger) {
+	var response []byte
+	var status int
+	var err error
+
+	switch r.Method {
+	case http.MethodPost:
+		r.Body = http.MaxBytesReader(w, r.Body, int64(store.MaxSize()+multipartOverhead))
+		response, status, err = uploadImage(r, db, store, logger)
+	default:
+		status = http.StatusBadRequest
+		err = errors.New("wrong method type for /images route")
+	}
+
+	if err != nil {
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	_, err = w.Write(response)
+	if err != nil {
+		status = http.StatusInternalServerError
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	status = http.StatusOK
+	logger.Printf("Status: %d %s", status, http.StatusText(status))
+}
+
+// HandleImageFiles serves the stored images. Their names change with their
+// content, so they are cached for a year; the ETag still lets clients without
+// a copy in cache revalidate cheaply.
+func HandleImageFiles(w http.ResponseWriter, r *http.Request, store *images.Store, logger *log.Logger) {
+	var status int
+	var err error
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		status = http.StatusBadRequest
+		err = errors.New("wrong method type for " + r.URL.Path + " route")
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, images.URLPrefix)
+	content, contentType, err := store.Open(name)
+	if err != nil {
+		status = http.StatusNotFound
+		if err != images.ErrNotFound {
+			logger.Printf("Internal error: %s", err.Error())
+			status = http.StatusInternalServerError
+			err = errors.New("could not read image")
+		}
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("ETag", strconv.Quote(name))
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(content))
+
+	logger.Printf("Status: %d %s", http.StatusOK, http.StatusText(http.StatusOK))
+}
+
+// uploadImage stores the "image" file of a multipart form and, when the form
+// carries a productID, adds it after the product's other images.
+func uploadImage(r *http.Request, db datasources.DBClient, store *images.Store, logger *log.Logger) ([]byte, int, error) {
+	err := r.ParseMultipartForm(int64(store.MaxSize()))
+	if err != nil && strings.Contains(err.Error(), "too large") {
+		return nil, http.StatusRequestEntityTooLarge, images.ErrTooLarge
+	}
+
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		return nil, http.StatusBadRequest, errors.New("the image must be sent as the 'image' file of a multipart form")
+	}
+	defer file.Close()
+
+	content, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, http.StatusBadRequest, errors.New("could not read the uploaded image")
+	}
+
+	var product repositories.Product
+	productParam := r.FormValue("productID")
+	if len(productParam) > 0 {
+		productID, err := strconv.Atoi(productParam)
+		if err != nil {
+			return nil, http.StatusBadRequest, errors.New("could not convert parameter 'productID' to integer")
+		}
+		product, err = getProductByID(db, productID)
+		if err != nil {
+			return nil, http.StatusNotFound, err
+		}
+	}
+
+	uploaded, err := store.Upload(content)
+	switch {
+	case err == images.ErrUnsupportedType:
+		return nil, http.StatusUnsupportedMediaType, err
+	case errors.Is(err, images.ErrTooLarge):
+		return nil, http.StatusRequestEntityTooLarge, err
+	case err != nil:
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, http.StatusInternalServerError, errors.New("could not store image")
+	}
+
+	if product.ID > 0 {
+		productImages := append(product.Images, repositories.ProductImage{URL: uploaded.URL, AltText: r.FormValue("altText")})
+		err = db.SetProductImages(product.ID, productImages)
+		if err != nil {
+			logger.Printf("Internal error: %s", err.Error())
+			return nil, http.StatusInternalServerError, errors.New("could not save Product images")
+		}
+		recordAudit(r, db, logger, repositories.ProductEntity, product.ID, repositories.UpdateOperation, product, productSnapshot(db, product.ID))
+	}
+
+	response, err := json.Marshal(uploaded)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("could not marshal image response json")
+	}
+
+	return response, http.StatusOK, nil
+}
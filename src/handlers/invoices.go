@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mariacalinoiu/smartket/src/datasources"
+	"github.com/mariacalinoiu/smartket/src/invoices"
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+// HandleOrderDocuments serves /orders/{id}/invoice, /orders/{id}/credit-notes
+// and /orders/{id}/credit-notes/{creditNoteID}, as JSON or, with format=pdf, as PDF.
+func HandleOrderDocuments(w http.ResponseWriter, r *http.Request, db datasources.DBClient, logger *log.Logger) {
+	var response []byte
+	var contentType string
+	var status int
+	var err error
+
+	switch r.Method {
+	case http.MethodGet:
+		response, contentType, status, err = getOrderDocument(r, db, logger)
+	default:
+		status = http.StatusBadRequest
+		err = errors.New("wrong method type for " + r.URL.Path + " route")
+	}
+
+	if err != nil {
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	_, err = w.Write(response)
+	if err != nil {
+		status = http.StatusInternalServerError
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	status = http.StatusOK
+	logger.Printf("Status: %d %s", status, http.StatusText(status))
+}
+
+func getOrderDocument(r *http.Request, db datasources.DBClient, logger *log.Logger) ([]byte, string, int, error) {
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(segments) < 3 || len(segments) > 4 || (segments[2] != "invoice" && segments[2] != "credit-notes") ||
+		(segments[2] == "invoice" && len(segments) == 4) {
+		return nil, "", http.StatusNotFound, errors.New("unknown route " + r.URL.Path)
+	}
+
+	orderID, err := strconv.Atoi(segments[1])
+	if err != nil {
+		return nil, "", http.StatusBadRequest, errors.New("could not convert the order ID in the path to integer")
+	}
+
+	var document interface{}
+	var invoice repositories.Invoice
+	switch {
+	case segments[2] == "invoice":
+		invoice, err = db.GetInvoice(orderID)
+		document = invoice
+	case len(segments) == 3:
+		document, err = db.GetCreditNotes(orderID)
+	default:
+		invoice, err = getCreditNote(db, orderID, segments[3])
+		document = invoice
+	}
+	if err == datasources.ErrInvoiceNotFound {
+		return nil, "", http.StatusNotFound, err
+	}
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, "", http.StatusInternalServerError, errors.New("could not get invoice")
+	}
+
+	if r.URL.Query().Get("format") == "pdf" {
+		if invoice.ID == 0 {
+			return nil, "", http.StatusBadRequest, errors.New("only a single invoice or credit note can be downloaded as PDF")
+		}
+
+		return invoices.RenderPDF(invoice), "application/pdf", http.StatusOK, nil
+	}
+
+	response, err := json.Marshal(document)
+	if err != nil {
+		return nil, "", http.StatusInternalServerError, errors.New("could not marshal invoice response json")
+	}
+
+	return response, "application/json", http.StatusOK, nil
+}
+
+func getCreditNote(db datasources.DBClient, orderID int, creditNoteParam string) (repositories.Invoice, error) {
+	creditNoteID, err := strconv.Atoi(creditNoteParam)
+	if err != nil {
+		return repositories.Invoice{}, datasources.ErrInvoiceNotFound
+	}
+
+	creditNotes, err := db.GetCreditNotes(orderID)
+	if err != nil {
+		return repositories.Invoice{}, err
+	}
+	for _, creditNote := range creditNotes.Invoices {
+		if creditNote.ID == creditNoteID {
+			return creditNote, nil
+		}
+	}
+
+	return repositories.Invoice{}, datasources.ErrInvoiceNotFound
+}
+
+// issueInvoice is called once the order is confirmed. Its failures must not
+// undo the payment that confirmed the order: the order is then listed on
+// /orders/uninvoiced until the invoices worker issues the invoice.
+func issueInvoice(r *http.Request, db datasources.DBClient, config invoices.Config, logger *log.Logger, orderID int) error {
+	orders, err := db.GetOrders(orderID)
+	if err != nil {
+		return err
+	}
+	if len(orders.Orders) != 1 {
+		return datasources.ErrOrderNotFound
+	}
+
+	invoice, err := db.IssueInvoice(invoices.NewInvoice(orders.Orders[0], config))
+	if err == datasources.ErrInvoiceAlreadyIssued {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	recordAudit(r, db, logger, repositories.InvoiceEntity, invoice.ID, repositories.CreateOperation, nil, invoice)
+
+	return nil
+}
+
+// issueCreditNote corrects the order's invoice for the refund; orders that were
+// never invoiced need no credit note. Credit notes that fail are issued later
+// by the invoices worker, as the refund is kept.
+func issueCreditNote(r *http.Request, db datasources.DBClient, config invoices.Config, logger *log.Logger, order repositories.Order, refund repositories.Refund) error {
+	invoice, err := db.GetInvoice(order.ID)
+	if err == datasources.ErrInvoiceNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	creditNote, err := db.IssueInvoice(invoices.NewCreditNote(order, refund, invoice, config))
+	if err != nil {
+		return err
+	}
+	recordAudit(r, db, logger, repositories.InvoiceEntity, creditNote.ID, repositories.CreateOperation, nil, creditNote)
+
+	return nil
+}
+
+func HandleOrdersUninvoiced(w http.ResponseWriter, r *http.Request, db datasources.DBClient, logger *log.Logger) {
+	var response []byte
+	var status int
+	var err error
+
+	switch r.Method {
+	case http.MethodGet:
+		response, status, err = getUninvoicedOrders(db, logger)
+	default:
+		status = http.StatusBadRequest
+		err = errors.New("wrong method type for /orders/uninvoiced route")
+	}
+
+	if err != nil {
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	_, err = w.Write(response)
+	if err != nil {
+		status = http.StatusInternalServerError
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	status = http.StatusOK
+	logger.Printf("Status: %d %s", status, http.StatusText(status))
+}
+
+func getUninvoicedOrders(db datasources.DBClient, logger *log.Logger) ([]byte, int, error) {
+	orders, err := db.GetUninvoicedOrders()
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, http.StatusInternalServerError, errors.New("could not get uninvoiced orders")
+	}
+
+	response, err := json.Marshal(orders)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("could not marshal orders response json")
+	}
+
+	return response, http.StatusOK, nil
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	"github.com/mariacalinoiu/smartket/src/datasources"
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+var errNotificationToken = errors.New("the token sent with the reminders is required to see or change this preference")
+
+func HandleNotificationPreferences(w http.ResponseWriter, r *http.Request, db datasources.DBClient, logger *log.Logger) {
+	var response []byte
+	var status int
+	var err error
+
+	switch r.Method {
+	case http.MethodGet:
+		response, status, err = getNotificationPreference(r, db, logger)
+	case http.MethodPost, http.MethodPut:
+		response, status, err = setNotificationPreference(r, db, logger)
+	default:
+		status = http.StatusBadRequest
+		err = errors.New("wrong method type for /notifications/preferences route")
+	}
+
+	if err != nil {
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	_, err = w.Write(response)
+	if err != nil {
+		status = http.StatusInternalServerError
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	status = http.StatusOK
+	logger.Printf("Status: %d %s", status, http.StatusText(status))
+}
+
+func getNotificationPreference(r *http.Request, db datasources.DBClient, logger *log.Logger) ([]byte, int, error) {
+	params, ok := r.URL.Query()["email"]
+
+	if !ok || len(params[0]) < 1 {
+		return nil, http.StatusBadRequest, errors.New("mandatory parameter 'email' not found")
+	}
+
+	preference, err := db.GetNotificationPreference(params[0])
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, http.StatusInternalServerError, errors.New("could not get notification preference")
+	}
+	if !canChangePreference(r, preference, r.URL.Query().Get("token")) {
+		return nil, http.StatusForbidden, errNotificationToken
+	}
+	preference.Token = ""
+
+	response, err := json.Marshal(preference)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("could not marshal notification preference response json")
+	}
+
+	return response, http.StatusOK, nil
+}
+
+func setNotificationPreference(r *http.Request, db datasources.DBClient, logger *log.Logger) ([]byte, int, error) {
+	var preference repositories.NotificationPreference
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &preference)
+	}
+	if err != nil || len(preference.Email) < 1 {
+		return nil, http.StatusBadRequest, errors.New("notification preference sent on request body does not match required format")
+	}
+
+	current, err := db.GetNotificationPreference(preference.Email)
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, http.StatusInternalServerError, errors.New("could not get notification preference")
+	}
+	if !canChangePreference(r, current, preference.Token) {
+		return nil, http.StatusForbidden, errNotificationToken
+	}
+
+	err = db.SetNotificationPreference(preference)
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, http.StatusInternalServerError, errors.New("could not save notification preference")
+	}
+	preference.Token = ""
+
+	response, err := json.Marshal(preference)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("could not marshal notification preference response json")
+	}
+
+	return response, http.StatusOK, nil
+}
+
+// canChangePreference lets admins in, and customers who send the token of
+// their reminders; an email that was never sent one has no token to match.
+func canChangePreference(r *http.Request, current repositories.NotificationPreference, token string) bool {
+	if isAdmin(r) {
+		return true
+	}
+
+	return len(current.Token) > 0 && subtle.ConstantTimeCompare([]byte(current.Token), []byte(token)) == 1
+}
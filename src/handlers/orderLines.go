@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	"github.com/mariacalinoiu/smartket/src/datasources"
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+func HandleOrderLines(w http.ResponseWriter, r *http.Request, db datasources.DBClient, logger *log.Logger) {
+	var response []byte
+	var status int
+	var err error
+
+	switch r.Method {
+	case http.MethodPost, http.MethodPut:
+		response, status, err = editOrderLines(r, w.Header(), db, logger)
+	default:
+		status = http.StatusBadRequest
+		err = errors.New("wrong method type for /orders/lines route")
+	}
+
+	if err != nil {
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		if status == http.StatusPreconditionFailed {
+			err = writePreconditionFailed(w, response)
+			if err != nil {
+				logger.Printf("Error: %s", err.Error())
+			}
+
+			return
+		}
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	_, err = w.Write(response)
+	if err != nil {
+		status = http.StatusInternalServerError
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	status = http.StatusOK
+	logger.Printf("Status: %d %s", status, http.StatusText(status))
+}
+
+func editOrderLines(r *http.Request, header http.Header, db datasources.DBClient, logger *log.Logger) ([]byte, int, error) {
+	var request repositories.OrderLinesRequest
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &request)
+	}
+	if err != nil || !areOrderLinesValid(request) {
+		return nil, http.StatusBadRequest, errors.New("order lines sent on request body do not match required format")
+	}
+
+	status, err := checkProductLines(db, orderedLines(request.Lines), logger)
+	if err != nil {
+		return nil, status, err
+	}
+
+	expectedVersion, err := versionFromIfMatch(r)
+	if err != nil {
+		return nil, http.StatusPreconditionRequired, err
+	}
+
+	before := orderSnapshot(db, request.OrderID)
+	active, status, err := orderPromotions(db, before, logger)
+	if err != nil {
+		return nil, status, err
+	}
+	err = db.EditOrderLines(request.OrderID, expectedVersion, request.Lines, active)
+	switch {
+	case err == datasources.ErrVersionConflict:
+		response, marshalErr := json.Marshal(before)
+		if marshalErr != nil {
+			return nil, http.StatusInternalServerError, errors.New("could not marshal order response json")
+		}
+		if currentOrder, ok := before.(repositories.Order); ok {
+			header.Set("ETag", etagFor(currentOrder.Version))
+		}
+
+		return response, http.StatusPreconditionFailed, err
+	case err == datasources.ErrOrderNotFound:
+		return nil, http.StatusNotFound, err
+	case err == datasources.ErrOrderNotEditable, err == datasources.ErrInvalidVoucher, err == datasources.ErrEmptyOrder:
+		return nil, http.StatusConflict, err
+	case errors.Is(err, datasources.ErrInsufficientStock):
+		return nil, http.StatusConflict, err
+	case err != nil:
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, http.StatusInternalServerError, errors.New("could not save Order lines")
+	}
+
+	after := orderSnapshot(db, request.OrderID)
+	recordAudit(r, db, logger, repositories.OrderEntity, request.OrderID, repositories.UpdateOperation, before, after)
+
+	response, err := json.Marshal(after)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("could not marshal order response json")
+	}
+	if savedOrder, ok := after.(repositories.Order); ok {
+		header.Set("ETag", etagFor(savedOrder.Version))
+	}
+
+	return response, http.StatusOK, nil
+}
+
+func areOrderLinesValid(request repositories.OrderLinesRequest) bool {
+	if request.OrderID < 1 || len(request.Lines) < 1 {
+		return false
+	}
+
+	for _, line := range request.Lines {
+		if line.ProductID < 1 || line.Quantity < 0 {
+			return false
+		}
+	}
+
+	return true
+}
@@ -6,23 +6,25 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
-	"regexp"
 	"strconv"
 
 	"github.com/mariacalinoiu/smartket/src/datasources"
 	"github.com/mariacalinoiu/smartket/src/repositories"
+	"github.com/mariacalinoiu/smartket/src/validation"
 )
 
-func HandleOrdersAdd(w http.ResponseWriter, r *http.Request, db datasources.DBClient, logger *log.Logger) {
+var errOrderStatusChange = errors.New("the order status can only change through its payments, refunds or cancellation")
+
+func HandleOrdersAdd(w http.ResponseWriter, r *http.Request, db datasources.DBClient, validator validation.Validator, logger *log.Logger) {
 	var response []byte
 	var status int
 	var err error
 
 	switch r.Method {
 	case http.MethodGet:
-		response, status, err = getOrders(db, logger)
+		response, status, err = getOrders(r, w.Header(), db, logger)
 	case http.MethodPost, http.MethodPut:
-		response, status, err = insertOrder(r, db, logger, r.Method == http.MethodPut)
+		response, status, err = insertOrder(r, w.Header(), db, validator, logger, r.Method == http.MethodPut)
 	case http.MethodDelete:
 		status, err = deleteOrder(r, db, logger)
 	default:
@@ -32,6 +34,22 @@ func HandleOrdersAdd(w http.ResponseWriter, r *http.Request, db datasources.DBCl
 
 	if err != nil {
 		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		if status == http.StatusPreconditionFailed {
+			err = writePreconditionFailed(w, response)
+			if err != nil {
+				logger.Printf("Error: %s", err.Error())
+			}
+
+			return
+		}
+		if status == http.StatusBadRequest && response != nil {
+			err = writeValidationErrors(w, response)
+			if err != nil {
+				logger.Printf("Error: %s", err.Error())
+			}
+
+			return
+		}
 		http.Error(w, err.Error(), status)
 
 		return
@@ -50,14 +68,14 @@ func HandleOrdersAdd(w http.ResponseWriter, r *http.Request, db datasources.DBCl
 	logger.Printf("Status: %d %s", status, http.StatusText(status))
 }
 
-func HandleOrdersUpdate(w http.ResponseWriter, r *http.Request, db datasources.DBClient, logger *log.Logger) {
+func HandleOrdersUpdate(w http.ResponseWriter, r *http.Request, db datasources.DBClient, validator validation.Validator, logger *log.Logger) {
 	var response []byte
 	var status int
 	var err error
 
 	switch r.Method {
 	case http.MethodPost:
-		response, status, err = insertOrder(r, db, logger, true)
+		response, status, err = insertOrder(r, w.Header(), db, validator, logger, true)
 	default:
 		status = http.StatusBadRequest
 		err = errors.New("wrong method type for /orders/update route")
@@ -65,6 +83,22 @@ func HandleOrdersUpdate(w http.ResponseWriter, r *http.Request, db datasources.D
 
 	if err != nil {
 		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		if status == http.StatusPreconditionFailed {
+			err = writePreconditionFailed(w, response)
+			if err != nil {
+				logger.Printf("Error: %s", err.Error())
+			}
+
+			return
+		}
+		if status == http.StatusBadRequest && response != nil {
+			err = writeValidationErrors(w, response)
+			if err != nil {
+				logger.Printf("Error: %s", err.Error())
+			}
+
+			return
+		}
 		http.Error(w, err.Error(), status)
 
 		return
@@ -88,7 +122,7 @@ func HandleOrdersDelete(w http.ResponseWriter, r *http.Request, db datasources.D
 	var err error
 
 	switch r.Method {
-	case http.MethodGet:
+	case http.MethodPost, http.MethodDelete:
 		status, err = deleteOrder(r, db, logger)
 	default:
 		status = http.StatusBadRequest
@@ -115,8 +149,88 @@ func HandleOrdersDelete(w http.ResponseWriter, r *http.Request, db datasources.D
 	logger.Printf("Status: %d %s", status, http.StatusText(status))
 }
 
-func getOrders(db datasources.DBClient, logger *log.Logger) ([]byte, int, error) {
-	orders, err := db.GetOrders()
+func HandleOrdersArchived(w http.ResponseWriter, r *http.Request, db datasources.DBClient, logger *log.Logger) {
+	var response []byte
+	var status int
+	var err error
+
+	switch r.Method {
+	case http.MethodGet:
+		response, status, err = getArchivedOrders(db, logger)
+	default:
+		status = http.StatusBadRequest
+		err = errors.New("wrong method type for /orders/archived route")
+	}
+
+	if err != nil {
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	_, err = w.Write(response)
+	if err != nil {
+		status = http.StatusInternalServerError
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	status = http.StatusOK
+	logger.Printf("Status: %d %s", status, http.StatusText(status))
+}
+
+func HandleOrdersRestore(w http.ResponseWriter, r *http.Request, db datasources.DBClient, logger *log.Logger) {
+	var status int
+	var err error
+
+	switch r.Method {
+	case http.MethodPost:
+		status, err = restoreOrder(r, db, logger)
+	default:
+		status = http.StatusBadRequest
+		err = errors.New("wrong method type for /orders/restore route")
+	}
+
+	if err != nil {
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	_, err = w.Write([]byte("restored order"))
+	if err != nil {
+		status = http.StatusInternalServerError
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	status = http.StatusOK
+	logger.Printf("Status: %d %s", status, http.StatusText(status))
+}
+
+func getOrders(r *http.Request, header http.Header, db datasources.DBClient, logger *log.Logger) ([]byte, int, error) {
+	var orders repositories.OrdersJSON
+	var err error
+
+	params, ok := r.URL.Query()["orderID"]
+	if ok && len(params[0]) > 0 {
+		orderID, convErr := strconv.Atoi(params[0])
+		if convErr != nil {
+			return nil, http.StatusBadRequest, errors.New("could not convert parameter 'orderID' to integer")
+		}
+		orders, err = db.GetOrders(orderID)
+		if err == nil && len(orders.Orders) == 1 {
+			header.Set("ETag", etagFor(orders.Orders[0].Version))
+		}
+	} else {
+		orders, err = db.GetOrders()
+	}
 	if err != nil {
 		logger.Printf("Internal error: %s", err.Error())
 		return nil, http.StatusInternalServerError, errors.New("could not get orders")
@@ -130,6 +244,21 @@ func getOrders(db datasources.DBClient, logger *log.Logger) ([]byte, int, error)
 	return response, http.StatusOK, nil
 }
 
+func getArchivedOrders(db datasources.DBClient, logger *log.Logger) ([]byte, int, error) {
+	orders, err := db.GetArchivedOrders()
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, http.StatusInternalServerError, errors.New("could not get archived orders")
+	}
+
+	response, err := json.Marshal(orders)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("could not marshal orders response json")
+	}
+
+	return response, http.StatusOK, nil
+}
+
 func extractOrderParams(r *http.Request) (repositories.Order, error) {
 	var unmarshalledOrder repositories.Order
 
@@ -146,24 +275,89 @@ func extractOrderParams(r *http.Request) (repositories.Order, error) {
 	return unmarshalledOrder, nil
 }
 
-func insertOrder(r *http.Request, db datasources.DBClient, logger *log.Logger, update bool) ([]byte, int, error) {
+func insertOrder(r *http.Request, header http.Header, db datasources.DBClient, validator validation.Validator, logger *log.Logger, update bool) ([]byte, int, error) {
 	order, err := extractOrderParams(r)
 	orderID := datasources.GetOrderID(order.ID)
 
-	if err != nil || !isOrderValid(order) {
+	if err != nil {
 		return nil, http.StatusBadRequest, errors.New("order information sent on request body does not match required format")
 	}
 
+	order, status, err := resolveFulfilment(order, db, logger)
+	if err != nil {
+		return nil, status, err
+	}
+	if !update {
+		status, err = checkProductLines(db, orderedLines(order.ProductsOrdered), logger)
+		if err != nil {
+			return nil, status, err
+		}
+		order, status, err = resolveDeliverySlot(order, db, logger)
+		if err != nil {
+			return nil, status, err
+		}
+		order.ProductsOrdered, status, err = applyPromotions(db, order.ProductsOrdered, logger)
+		if err != nil {
+			return nil, status, err
+		}
+	}
+
+	order, validationErrs := validateOrder(order, validator)
+	if len(validationErrs) > 0 {
+		response, err := json.Marshal(validationErrs)
+		if err != nil {
+			return nil, http.StatusInternalServerError, errors.New("could not marshal validation errors json")
+		}
+
+		return response, http.StatusBadRequest, validationErrs
+	}
+
+	var before interface{}
+	operation := repositories.CreateOperation
 	if update {
+		order.Version, err = versionFromIfMatch(r)
+		if err != nil {
+			return nil, http.StatusPreconditionRequired, err
+		}
+
+		before = orderSnapshot(db, order.ID)
+		if before == nil {
+			return nil, http.StatusNotFound, errors.New("the order provided does not exist")
+		}
+		if len(order.Status) > 0 && order.Status != before.(repositories.Order).Status {
+			return nil, http.StatusBadRequest, errOrderStatusChange
+		}
+		operation = repositories.UpdateOperation
 		err = db.EditOrder(order)
 	} else {
 		orderID, err = db.InsertOrder(order)
 	}
+	if err == datasources.ErrVersionConflict {
+		current := orderSnapshot(db, order.ID)
+		response, marshalErr := json.Marshal(current)
+		if marshalErr != nil {
+			return nil, http.StatusInternalServerError, errors.New("could not marshal order response json")
+		}
+		if currentOrder, ok := current.(repositories.Order); ok {
+			header.Set("ETag", etagFor(currentOrder.Version))
+		}
+
+		return response, http.StatusPreconditionFailed, err
+	}
+	if errors.Is(err, datasources.ErrInsufficientStock) || err == datasources.ErrSlotReservationInvalid {
+		return nil, http.StatusConflict, err
+	}
 	if err != nil {
 		logger.Printf("Internal error: %s", err.Error())
 		return nil, http.StatusInternalServerError, errors.New("could not save Order")
 	}
 
+	after := orderSnapshot(db, orderID.OrderID)
+	if savedOrder, ok := after.(repositories.Order); ok {
+		header.Set("ETag", etagFor(savedOrder.Version))
+	}
+	recordAudit(r, db, logger, repositories.OrderEntity, orderID.OrderID, operation, before, after)
+
 	response, err := json.Marshal(orderID)
 	if err != nil {
 		return nil, http.StatusInternalServerError, errors.New("could not marshal orderID response json")
@@ -183,32 +377,111 @@ func deleteOrder(r *http.Request, db datasources.DBClient, logger *log.Logger) (
 	if err != nil {
 		return http.StatusBadRequest, errors.New("could not convert parameter 'orderID' to integer")
 	}
-	err = db.DeleteOrder(orderID)
+
+	before := orderSnapshot(db, orderID)
+	err = db.DeleteOrder(orderID, actorOf(r))
+	if err == datasources.ErrOrderNotFound {
+		return http.StatusNotFound, err
+	}
+	if err == datasources.ErrOrderAlreadyArchived {
+		return http.StatusConflict, err
+	}
 	if err != nil {
 		logger.Printf("Internal error: %s", err.Error())
 		return http.StatusInternalServerError, errors.New("could not delete Order")
 	}
+	recordAudit(r, db, logger, repositories.OrderEntity, orderID, repositories.DeleteOperation, before, orderSnapshot(db, orderID))
+
+	return http.StatusOK, nil
+}
+
+func restoreOrder(r *http.Request, db datasources.DBClient, logger *log.Logger) (int, error) {
+	params, ok := r.URL.Query()["orderID"]
+
+	if !ok || len(params[0]) < 1 {
+		return http.StatusBadRequest, errors.New("mandatory parameter 'orderID' not found")
+	}
+
+	orderID, err := strconv.Atoi(params[0])
+	if err != nil {
+		return http.StatusBadRequest, errors.New("could not convert parameter 'orderID' to integer")
+	}
+	before := orderSnapshot(db, orderID)
+	err = db.RestoreOrder(orderID)
+	if err == datasources.ErrOrderNotFound {
+		return http.StatusNotFound, err
+	}
+	if err == datasources.ErrOrderNotArchived || errors.Is(err, datasources.ErrInsufficientStock) {
+		return http.StatusConflict, err
+	}
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return http.StatusInternalServerError, errors.New("could not restore Order")
+	}
+	recordAudit(r, db, logger, repositories.OrderEntity, orderID, repositories.RestoreOperation, before, orderSnapshot(db, orderID))
 
 	return http.StatusOK, nil
 }
 
-func isOrderValid(order repositories.Order) bool {
-	if len(order.FirstName) < 1 || len(order.LastName) < 1 || len(order.Email) < 1 || len(order.PhoneNumber) < 1 ||
-		len(order.City) < 1 || len(order.Address) < 1 || len(order.PaymentMethod) < 1 {
-		return false
+// writeValidationErrors answers with the fields of the order that failed
+// validation, as a JSON list of field and message pairs.
+func writeValidationErrors(w http.ResponseWriter, validationErrs []byte) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	_, err := w.Write(validationErrs)
+
+	return err
+}
+
+func validateOrder(order repositories.Order, validator validation.Validator) (repositories.Order, validation.Errors) {
+	normalized, errs := validator.Validate(map[string]string{
+		"firstName":     order.FirstName,
+		"lastName":      order.LastName,
+		"email":         order.Email,
+		"phoneNumber":   order.PhoneNumber,
+		"city":          order.City,
+		"address":       order.Address,
+		"paymentMethod": order.PaymentMethod,
+	})
+	if len(errs) > 0 {
+		return order, errs
 	}
 
-	isAlpha := regexp.MustCompile(`^[A-Za-z]+$`).MatchString
-	if !isAlpha(order.FirstName) || !isAlpha(order.LastName) || !isAlpha(order.City) {
-		return false
+	order.PhoneNumber = normalized["phoneNumber"]
+
+	return order, nil
+}
+
+func resolveShippingAddress(order repositories.Order, db datasources.DBClient, logger *log.Logger) (repositories.Order, int, error) {
+	if order.AddressID > 0 {
+		address, err := db.GetAddress(order.AddressID)
+		if err != nil || address.Email != order.Email {
+			return order, http.StatusBadRequest, errors.New("the saved address provided does not belong to the order email")
+		}
+		order.ShippingAddress = &address
 	}
 
-	isValidPhoneNumber := regexp.MustCompile(`^[0-9\-\+]{10}$`).MatchString
-	if !isValidPhoneNumber(order.PhoneNumber) {
-		return false
+	if order.ShippingAddress == nil {
+		return order, http.StatusBadRequest, errors.New("delivery orders need a shippingAddress or the addressID of a saved address")
+	}
+
+	address := *order.ShippingAddress
+	if !isAddressValid(address) {
+		return order, http.StatusBadRequest, errors.New("the shipping address must have a street, number, postal code, city, county and country")
+	}
+
+	zone, err := db.FindDeliveryZone(address)
+	if err == datasources.ErrNotDeliverable {
+		return order, http.StatusBadRequest, err
+	}
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return order, http.StatusInternalServerError, errors.New("could not find a delivery zone for the shipping address")
 	}
 
-	isValidEmail := regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$").MatchString
+	order.City = address.City
+	order.Address = formatAddress(address)
+	order.DeliveryZoneID = zone.ID
 
-	return isValidEmail(order.Email)
+	return order, http.StatusOK, nil
 }
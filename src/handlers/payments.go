@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/mariacalinoiu/smartket/src/datasources"
+	"github.com/mariacalinoiu/smartket/src/invoices"
+	"github.com/mariacalinoiu/smartket/src/payments"
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+func HandlePayments(w http.ResponseWriter, r *http.Request, db datasources.DBClient, providers payments.Registry, invoicing invoices.Config, logger *log.Logger) {
+	var response []byte
+	var status int
+	var err error
+
+	switch r.Method {
+	case http.MethodGet:
+		response, status, err = getPayments(r, db, logger)
+	case http.MethodPost:
+		response, status, err = processPayment(r, db, providers, invoicing, logger)
+	default:
+		status = http.StatusBadRequest
+		err = errors.New("wrong method type for /payments route")
+	}
+
+	if err != nil {
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	_, err = w.Write(response)
+	if err != nil {
+		status = http.StatusInternalServerError
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	status = http.StatusOK
+	logger.Printf("Status: %d %s", status, http.StatusText(status))
+}
+
+func getPayments(r *http.Request, db datasources.DBClient, logger *log.Logger) ([]byte, int, error) {
+	params, ok := r.URL.Query()["orderID"]
+
+	if !ok || len(params[0]) < 1 {
+		return nil, http.StatusBadRequest, errors.New("mandatory parameter 'orderID' not found")
+	}
+
+	orderID, err := strconv.Atoi(params[0])
+	if err != nil {
+		return nil, http.StatusBadRequest, errors.New("could not convert parameter 'orderID' to integer")
+	}
+	paymentsJSON, err := db.GetPaymentsByOrderID(orderID)
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, http.StatusInternalServerError, errors.New("could not get payments for Order")
+	}
+
+	response, err := json.Marshal(paymentsJSON)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("could not marshal payments response json")
+	}
+
+	return response, http.StatusOK, nil
+}
+
+func processPayment(r *http.Request, db datasources.DBClient, providers payments.Registry, invoicing invoices.Config, logger *log.Logger) ([]byte, int, error) {
+	var request repositories.PaymentRequest
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &request)
+	}
+	if err != nil || request.OrderID < 1 || request.Amount < 0 {
+		return nil, http.StatusBadRequest, errors.New("payment information sent on request body does not match required format")
+	}
+
+	orders, err := db.GetOrders(request.OrderID)
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, http.StatusInternalServerError, errors.New("could not get Order")
+	}
+	if len(orders.Orders) != 1 {
+		return nil, http.StatusBadRequest, errors.New("the order provided does not exist")
+	}
+	order := orders.Orders[0]
+
+	provider, err := providers.Get(order.PaymentMethod)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	authorization, captured, refunded := summarizePayments(order.Payments)
+	if request.Operation == payments.OperationRefund {
+		return refundPayment(r, db, providers, invoicing, logger, order, request.Amount, captured-refunded)
+	}
+	transaction := transactionOf(authorization, captured, refunded)
+	payment := repositories.Payment{
+		OrderID:   order.ID,
+		Provider:  order.PaymentMethod,
+		Operation: request.Operation,
+		Amount:    request.Amount,
+	}
+	orderStatus := ""
+
+	var result payments.Result
+	switch request.Operation {
+	case payments.OperationAuthorize:
+		if authorization.ID > 0 {
+			return nil, http.StatusBadRequest, errors.New("the order already has an active authorization")
+		}
+		if payment.Amount == 0 {
+			payment.Amount = order.Total
+		}
+		result, err = provider.Authorize(strconv.Itoa(order.ID), payment.Amount)
+	case payments.OperationCapture:
+		if authorization.ID == 0 || captured > 0 {
+			return nil, http.StatusBadRequest, errors.New("the order has no authorization to capture")
+		}
+		if payment.Amount == 0 {
+			payment.Amount = authorization.Amount
+		}
+		result, err = provider.Capture(transaction, payment.Amount)
+		orderStatus = repositories.PaidOrderStatus
+	case payments.OperationVoid:
+		if authorization.ID == 0 || captured > 0 {
+			return nil, http.StatusBadRequest, errors.New("the order has no authorization to void")
+		}
+		payment.Amount = authorization.Amount
+		result, err = provider.Void(transaction)
+		orderStatus = repositories.CancelledOrderStatus
+	default:
+		return nil, http.StatusBadRequest, fmt.Errorf("unknown payment operation '%s'", request.Operation)
+	}
+
+	payment.TransactionID = result.TransactionID
+	payment.Status = result.Status
+	if err != nil {
+		if err == payments.ErrDeclined {
+			_, saveErr := db.InsertPayment(payment)
+			if saveErr != nil {
+				logger.Printf("Internal error: %s", saveErr.Error())
+			}
+		}
+		return nil, http.StatusBadRequest, err
+	}
+
+	payment.ID, err = db.InsertPayment(payment)
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, http.StatusInternalServerError, errors.New("could not save Payment")
+	}
+	recordAudit(r, db, logger, repositories.PaymentEntity, payment.ID, repositories.CreateOperation, nil, payment)
+
+	if len(orderStatus) > 0 {
+		err = db.UpdateOrderStatus(order.ID, orderStatus)
+		if err != nil {
+			logger.Printf("Internal error: %s", err.Error())
+			return nil, http.StatusInternalServerError, errors.New("could not update Order status")
+		}
+		recordAudit(r, db, logger, repositories.OrderEntity, order.ID, repositories.UpdateOperation, order, orderSnapshot(db, order.ID))
+	}
+	if orderStatus == repositories.PaidOrderStatus {
+		err = issueInvoice(r, db, invoicing, logger, order.ID)
+		if err != nil {
+			logger.Printf("Invoicing error: %s; OrderID: %d; the invoice will be issued by the invoices worker", err.Error(), order.ID)
+		}
+	}
+
+	response, err := json.Marshal(payment)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("could not marshal payment response json")
+	}
+
+	return response, http.StatusOK, nil
+}
+
+// refundPayment refunds amount of the order, or all that is left of its
+// captured payment, the way /refunds does, so that the refund is recorded and
+// credited as well.
+func refundPayment(r *http.Request, db datasources.DBClient, providers payments.Registry, invoicing invoices.Config, logger *log.Logger, order repositories.Order, amount float32, remaining float32) ([]byte, int, error) {
+	refund := repositories.Refund{
+		OrderID:  order.ID,
+		Type:     repositories.AmountRefund,
+		Amount:   amount,
+		Reason:   "refunded through /payments",
+		Operator: actorOf(r),
+	}
+	if refund.Amount == 0 {
+		refund.Amount = remaining
+	}
+
+	refund, err := calculateRefund(refund, order)
+	if err == errNoCapturedPayment {
+		return nil, http.StatusConflict, err
+	}
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	_, payment, status, err := refundOrder(r, db, providers, invoicing, logger, order, refund)
+	if err != nil {
+		return nil, status, err
+	}
+
+	response, err := json.Marshal(payment)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("could not marshal payment response json")
+	}
+
+	return response, http.StatusOK, nil
+}
+
+func summarizePayments(orderPayments []repositories.Payment) (repositories.Payment, float32, float32) {
+	var authorization repositories.Payment
+	captured := float32(0)
+	refunded := float32(0)
+
+	for _, payment := range orderPayments {
+		switch payment.Status {
+		case payments.StatusAuthorized:
+			authorization = payment
+		case payments.StatusCaptured:
+			captured += payment.Amount
+		case payments.StatusRefunded:
+			refunded += payment.Amount
+		case payments.StatusVoided:
+			authorization = repositories.Payment{}
+		}
+	}
+
+	return authorization, captured, refunded
+}
+
+// transactionOf rebuilds the state of the order's authorization from its
+// recorded payments, for the provider to check the operation against.
+func transactionOf(authorization repositories.Payment, captured float32, refunded float32) payments.Transaction {
+	status := authorization.Status
+	if captured > 0 {
+		status = payments.StatusCaptured
+	}
+
+	return payments.Transaction{
+		ID:         authorization.TransactionID,
+		Status:     status,
+		Authorized: authorization.Amount,
+		Captured:   captured,
+		Refunded:   refunded,
+	}
+}
@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/mariacalinoiu/smartket/src/datasources"
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+func HandlePickupLocations(w http.ResponseWriter, r *http.Request, db datasources.DBClient, logger *log.Logger) {
+	var response []byte
+	var status int
+	var err error
+
+	switch r.Method {
+	case http.MethodGet:
+		response, status, err = getPickupLocations(r, db, logger)
+	case http.MethodPost, http.MethodPut:
+		response, status, err = insertPickupLocation(r, db, logger, r.Method == http.MethodPut)
+	case http.MethodDelete:
+		status, err = deletePickupLocation(r, db, logger)
+	default:
+		status = http.StatusBadRequest
+		err = errors.New("wrong method type for /pickup-locations route")
+	}
+
+	if err != nil {
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	_, err = w.Write(response)
+	if err != nil {
+		status = http.StatusInternalServerError
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	status = http.StatusOK
+	logger.Printf("Status: %d %s", status, http.StatusText(status))
+}
+
+func HandleOrdersReadyForPickup(w http.ResponseWriter, r *http.Request, db datasources.DBClient, logger *log.Logger) {
+	var status int
+	var err error
+
+	switch r.Method {
+	case http.MethodPost:
+		status, err = markReadyForPickup(r, db, logger)
+	default:
+		status = http.StatusBadRequest
+		err = errors.New("wrong method type for /orders/ready-for-pickup route")
+	}
+
+	if err != nil {
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	_, err = w.Write([]byte("order ready for pickup"))
+	if err != nil {
+		status = http.StatusInternalServerError
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	status = http.StatusOK
+	logger.Printf("Status: %d %s", status, http.StatusText(status))
+}
+
+func getPickupLocations(r *http.Request, db datasources.DBClient, logger *log.Logger) ([]byte, int, error) {
+	var locations repositories.PickupLocationsJSON
+	var err error
+
+	params, ok := r.URL.Query()["pickupLocationID"]
+	if ok && len(params[0]) > 0 {
+		locationID, convErr := strconv.Atoi(params[0])
+		if convErr != nil {
+			return nil, http.StatusBadRequest, errors.New("could not convert parameter 'pickupLocationID' to integer")
+		}
+		locations, err = db.GetPickupLocations(locationID)
+	} else {
+		locations, err = db.GetPickupLocations()
+	}
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, http.StatusInternalServerError, errors.New("could not get pickup locations")
+	}
+
+	response, err := json.Marshal(locations)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("could not marshal pickup locations response json")
+	}
+
+	return response, http.StatusOK, nil
+}
+
+func insertPickupLocation(r *http.Request, db datasources.DBClient, logger *log.Logger, update bool) ([]byte, int, error) {
+	var location repositories.PickupLocation
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &location)
+	}
+	if err != nil || !isPickupLocationValid(location) {
+		return nil, http.StatusBadRequest, errors.New("pickup location information sent on request body does not match required format")
+	}
+
+	locationID := repositories.PickupLocationIDResponse{PickupLocationID: location.ID}
+	var before interface{}
+	operation := repositories.CreateOperation
+	if update {
+		current, getErr := getPickupLocation(db, location.ID)
+		if getErr != nil {
+			return nil, http.StatusNotFound, getErr
+		}
+		before = current
+		operation = repositories.UpdateOperation
+		err = db.EditPickupLocation(location)
+	} else {
+		locationID, err = db.InsertPickupLocation(location)
+		location.ID = locationID.PickupLocationID
+	}
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, http.StatusInternalServerError, errors.New("could not save Pickup Location")
+	}
+	recordAudit(r, db, logger, repositories.PickupLocationEntity, location.ID, operation, before, location)
+
+	response, err := json.Marshal(locationID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("could not marshal pickupLocationID response json")
+	}
+
+	return response, http.StatusOK, nil
+}
+
+func deletePickupLocation(r *http.Request, db datasources.DBClient, logger *log.Logger) (int, error) {
+	params, ok := r.URL.Query()["pickupLocationID"]
+
+	if !ok || len(params[0]) < 1 {
+		return http.StatusBadRequest, errors.New("mandatory parameter 'pickupLocationID' not found")
+	}
+
+	locationID, err := strconv.Atoi(params[0])
+	if err != nil {
+		return http.StatusBadRequest, errors.New("could not convert parameter 'pickupLocationID' to integer")
+	}
+
+	before, err := getPickupLocation(db, locationID)
+	if err != nil {
+		return http.StatusNotFound, err
+	}
+	err = db.DeletePickupLocation(locationID)
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return http.StatusInternalServerError, errors.New("could not delete Pickup Location")
+	}
+	recordAudit(r, db, logger, repositories.PickupLocationEntity, locationID, repositories.DeleteOperation, before, nil)
+
+	return http.StatusOK, nil
+}
+
+func markReadyForPickup(r *http.Request, db datasources.DBClient, logger *log.Logger) (int, error) {
+	params, ok := r.URL.Query()["orderID"]
+
+	if !ok || len(params[0]) < 1 {
+		return http.StatusBadRequest, errors.New("mandatory parameter 'orderID' not found")
+	}
+
+	orderID, err := strconv.Atoi(params[0])
+	if err != nil {
+		return http.StatusBadRequest, errors.New("could not convert parameter 'orderID' to integer")
+	}
+
+	before := orderSnapshot(db, orderID)
+	order, ok := before.(repositories.Order)
+	if !ok || order.ArchivedTimestamp != 0 {
+		return http.StatusNotFound, errors.New("the order provided does not exist")
+	}
+	if order.FulfilmentType != repositories.PickupFulfilment {
+		return http.StatusBadRequest, errors.New("only pickup orders can be marked as ready for pickup")
+	}
+	if order.Status == repositories.CancelledOrderStatus || order.Status == repositories.RefundedOrderStatus {
+		return http.StatusConflict, fmt.Errorf("an order with status '%s' can not be marked as ready for pickup", order.Status)
+	}
+
+	err = db.MarkReadyForPickup(orderID)
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return http.StatusInternalServerError, errors.New("could not update Order fulfilment status")
+	}
+	recordAudit(r, db, logger, repositories.OrderEntity, orderID, repositories.UpdateOperation, before, orderSnapshot(db, orderID))
+
+	return http.StatusOK, nil
+}
+
+func getPickupLocation(db datasources.DBClient, locationID int) (repositories.PickupLocation, error) {
+	locations, err := db.GetPickupLocations(locationID)
+	if err != nil || len(locations.PickupLocations) != 1 {
+		return repositories.PickupLocation{}, errors.New("the pickup location provided does not exist")
+	}
+
+	return locations.PickupLocations[0], nil
+}
+
+// resolvePickupLocation checks the store a pickup order is collected from;
+// pickup orders carry neither a shipping address nor shipping costs, and keep
+// the customer's own address for billing.
+func resolvePickupLocation(order repositories.Order, db datasources.DBClient) (repositories.Order, int, error) {
+	if order.PickupLocationID < 1 {
+		return order, http.StatusBadRequest, errors.New("mandatory field 'pickupLocationID' not found for a pickup order")
+	}
+
+	_, err := getPickupLocation(db, order.PickupLocationID)
+	if err != nil {
+		return order, http.StatusBadRequest, err
+	}
+
+	order.AddressID = 0
+	order.ShippingAddress = nil
+	order.DeliveryZoneID = 0
+
+	return order, http.StatusOK, nil
+}
+
+func resolveFulfilment(order repositories.Order, db datasources.DBClient, logger *log.Logger) (repositories.Order, int, error) {
+	switch order.FulfilmentType {
+	case "", repositories.DeliveryFulfilment:
+		order.FulfilmentType = repositories.DeliveryFulfilment
+		order.PickupLocationID = 0
+		return resolveShippingAddress(order, db, logger)
+	case repositories.PickupFulfilment:
+		return resolvePickupLocation(order, db)
+	default:
+		return order, http.StatusBadRequest, fmt.Errorf("the fulfilment type must be '%s' or '%s'", repositories.DeliveryFulfilment, repositories.PickupFulfilment)
+	}
+}
+
+func isPickupLocationValid(location repositories.PickupLocation) bool {
+	if len(location.Name) < 1 || len(location.Street) < 1 || len(location.Number) < 1 || len(location.PostalCode) < 1 ||
+		len(location.City) < 1 || len(location.County) < 1 || len(location.OpeningHours) < 1 {
+		return false
+	}
+
+	for _, interval := range location.OpeningHours {
+		if interval.Weekday < 0 || interval.Weekday > 6 || !slotTimePattern.MatchString(interval.Opens) ||
+			!slotTimePattern.MatchString(interval.Closes) || interval.Opens >= interval.Closes {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isWithinOpeningHours(slot repositories.DeliverySlot, location repositories.PickupLocation) bool {
+	for _, interval := range location.OpeningHours {
+		if interval.Weekday == slot.Weekday && interval.Opens <= slot.StartTime && slot.EndTime <= interval.Closes {
+			return true
+		}
+	}
+
+	return false
+}
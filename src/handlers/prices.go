@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mariacalinoiu/smartket/src/datasources"
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+func HandlePriceHistory(w http.ResponseWriter, r *http.Request, db datasources.DBClient, logger *log.Logger) {
+	var response []byte
+	var status int
+	var err error
+
+	switch r.Method {
+	case http.MethodGet:
+		response, status, err = getPriceHistory(r, db, logger)
+	default:
+		status = http.StatusBadRequest
+		err = errors.New("wrong method type for /prices/history route")
+	}
+
+	if err != nil {
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	_, err = w.Write(response)
+	if err != nil {
+		status = http.StatusInternalServerError
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	status = http.StatusOK
+	logger.Printf("Status: %d %s", status, http.StatusText(status))
+}
+
+func HandleScheduledPrices(w http.ResponseWriter, r *http.Request, db datasources.DBClient, logger *log.Logger) {
+	var response []byte
+	var status int
+	var err error
+
+	switch r.Method {
+	case http.MethodGet:
+		response, status, err = getScheduledPrices(r, db, logger)
+	case http.MethodPost:
+		response, status, err = insertScheduledPrice(r, db, logger)
+	case http.MethodDelete:
+		status, err = cancelScheduledPrice(r, db, logger)
+	default:
+		status = http.StatusBadRequest
+		err = errors.New("wrong method type for /prices/scheduled route")
+	}
+
+	if err != nil {
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	_, err = w.Write(response)
+	if err != nil {
+		status = http.StatusInternalServerError
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	status = http.StatusOK
+	logger.Printf("Status: %d %s", status, http.StatusText(status))
+}
+
+func getPriceHistory(r *http.Request, db datasources.DBClient, logger *log.Logger) ([]byte, int, error) {
+	params, ok := r.URL.Query()["productID"]
+
+	if !ok || len(params[0]) < 1 {
+		return nil, http.StatusBadRequest, errors.New("mandatory parameter 'productID' not found")
+	}
+
+	productID, err := strconv.Atoi(params[0])
+	if err != nil {
+		return nil, http.StatusBadRequest, errors.New("could not convert parameter 'productID' to integer")
+	}
+
+	prices, err := db.GetPriceHistory(productID)
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, http.StatusInternalServerError, errors.New("could not get price history")
+	}
+
+	response, err := json.Marshal(prices)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("could not marshal price history response json")
+	}
+
+	return response, http.StatusOK, nil
+}
+
+func getScheduledPrices(r *http.Request, db datasources.DBClient, logger *log.Logger) ([]byte, int, error) {
+	var productID int
+	var err error
+
+	params, ok := r.URL.Query()["productID"]
+	if ok && len(params[0]) > 0 {
+		productID, err = strconv.Atoi(params[0])
+		if err != nil {
+			return nil, http.StatusBadRequest, errors.New("could not convert parameter 'productID' to integer")
+		}
+	}
+
+	scheduled, err := db.GetScheduledPrices(productID, r.URL.Query().Get("status"))
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, http.StatusInternalServerError, errors.New("could not get scheduled prices")
+	}
+
+	response, err := json.Marshal(scheduled)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("could not marshal scheduled prices response json")
+	}
+
+	return response, http.StatusOK, nil
+}
+
+// insertScheduledPrice applies the change right away when it already started,
+// rather than waiting for the scheduler.
+func insertScheduledPrice(r *http.Request, db datasources.DBClient, logger *log.Logger) ([]byte, int, error) {
+	var change repositories.ScheduledPrice
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &change)
+	}
+	if err != nil || change.ProductID < 1 || change.Price <= 0 || change.StartTimestamp < 1 ||
+		(change.EndTimestamp != 0 && change.EndTimestamp <= change.StartTimestamp) {
+		return nil, http.StatusBadRequest, errors.New("scheduled price information sent on request body does not match required format")
+	}
+
+	line := quantityLine{productLine: productLine{productID: change.ProductID, variantID: change.VariantID}}
+	status, err := checkProductLines(db, []quantityLine{line}, logger)
+	if err != nil {
+		return nil, status, err
+	}
+
+	scheduledPriceID, err := db.InsertScheduledPrice(change)
+	if err == datasources.ErrScheduledPriceOverlaps {
+		return nil, http.StatusConflict, err
+	}
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, http.StatusInternalServerError, errors.New("could not save Scheduled price")
+	}
+	change.ID = scheduledPriceID.ScheduledPriceID
+	change.Status = repositories.PendingPriceChange
+	recordAudit(r, db, logger, repositories.ScheduledPriceEntity, change.ID, repositories.CreateOperation, nil, change)
+
+	applyScheduledPrices(db, logger)
+
+	response, err := json.Marshal(scheduledPriceID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("could not marshal scheduledPriceID response json")
+	}
+
+	return response, http.StatusOK, nil
+}
+
+func cancelScheduledPrice(r *http.Request, db datasources.DBClient, logger *log.Logger) (int, error) {
+	params, ok := r.URL.Query()["scheduledPriceID"]
+
+	if !ok || len(params[0]) < 1 {
+		return http.StatusBadRequest, errors.New("mandatory parameter 'scheduledPriceID' not found")
+	}
+
+	scheduledPriceID, err := strconv.Atoi(params[0])
+	if err != nil {
+		return http.StatusBadRequest, errors.New("could not convert parameter 'scheduledPriceID' to integer")
+	}
+
+	before, err := db.GetScheduledPrice(scheduledPriceID)
+	if err == datasources.ErrScheduledPriceNotFound {
+		return http.StatusNotFound, err
+	}
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return http.StatusInternalServerError, errors.New("could not get scheduled price")
+	}
+
+	err = db.CancelScheduledPrice(scheduledPriceID, int(time.Now().UnixNano()/1000000000))
+	switch {
+	case err == datasources.ErrScheduledPriceNotFound:
+		return http.StatusNotFound, err
+	case err == datasources.ErrScheduledPriceCompleted:
+		return http.StatusConflict, err
+	case err != nil:
+		logger.Printf("Internal error: %s", err.Error())
+		return http.StatusInternalServerError, errors.New("could not cancel Scheduled price")
+	}
+
+	applyScheduledPrices(db, logger)
+
+	after, err := db.GetScheduledPrice(scheduledPriceID)
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+	}
+	recordAudit(r, db, logger, repositories.ScheduledPriceEntity, scheduledPriceID, repositories.UpdateOperation, before, after)
+
+	return http.StatusOK, nil
+}
+
+// applyScheduledPrices only logs its errors: the scheduler retries on its next
+// run.
+func applyScheduledPrices(db datasources.DBClient, logger *log.Logger) {
+	_, err := db.ApplyScheduledPrices(int(time.Now().UnixNano() / 1000000000))
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+	}
+}
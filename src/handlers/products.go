@@ -3,11 +3,15 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/mariacalinoiu/smartket/src/datasources"
+	"github.com/mariacalinoiu/smartket/src/recommendations"
+	"github.com/mariacalinoiu/smartket/src/repositories"
 )
 
 func HandleProducts(w http.ResponseWriter, r *http.Request, db datasources.DBClient, logger *log.Logger) {
@@ -54,12 +58,25 @@ func getProducts(r *http.Request, db datasources.DBClient, logger *log.Logger) (
 	if err != nil {
 		return nil, http.StatusBadRequest, errors.New("could not convert parameter 'categoryID' to integer")
 	}
-	products, err := db.GetProductsByCategoryID(categoryId)
+	var products repositories.ProductsJSON
+	if r.URL.Query().Get("includeDescendants") == "true" {
+		products, err = db.GetProductsInCategoryTree(categoryId)
+	} else {
+		products, err = db.GetProductsByCategoryID(categoryId)
+	}
 	if err != nil {
 		logger.Printf("Internal error: %s", err.Error())
 		return nil, http.StatusInternalServerError, errors.New("could not get products in Category")
 	}
 
+	filters, err := attributeFiltersOf(r.URL.Query())
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if len(filters) > 0 {
+		products.Products = filterByAttributes(products.Products, filters)
+	}
+
 	response, err := json.Marshal(products)
 	if err != nil {
 		return nil, http.StatusInternalServerError, errors.New("could not marshal products response json")
@@ -67,3 +84,230 @@ func getProducts(r *http.Request, db datasources.DBClient, logger *log.Logger) (
 
 	return response, http.StatusOK, nil
 }
+
+// HandleProductPaths serves /products/{id}, /products/{id}/related and the
+// admin only /products/{id}/attributes, /products/{id}/images,
+// /products/{id}/unit and /products/{id}/variants.
+func HandleProductPaths(w http.ResponseWriter, r *http.Request, db datasources.DBClient, engine *recommendations.Engine, logger *log.Logger) {
+	var response []byte
+	var status int
+	var err error
+
+	segments := append(strings.Split(strings.Trim(r.URL.Path, "/"), "/"), "")
+	productID, convErr := strconv.Atoi(segments[1])
+	route := strings.Trim(strings.Join(segments[2:], "/"), "/")
+
+	switch {
+	case convErr != nil:
+		status = http.StatusBadRequest
+		err = errors.New("could not convert the product ID in the path to integer")
+	case r.Method == http.MethodGet && route == "":
+		response, status, err = getProduct(w.Header(), db, productID, logger)
+	case r.Method == http.MethodGet && route == "related":
+		response, status, err = getRelatedProducts(r, db, engine, productID, logger)
+	case isProductEdit(r.Method, route):
+		response, status, err = editProduct(r, w.Header(), db, productID, route, logger)
+	case route == "" || route == "related" || route == "attributes" || route == "images" || route == "unit" ||
+		route == "variants":
+		status = http.StatusBadRequest
+		err = errors.New("wrong method type for " + r.URL.Path + " route")
+	default:
+		status = http.StatusNotFound
+		err = errors.New("unknown route " + r.URL.Path)
+	}
+
+	if err != nil {
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		if status == http.StatusPreconditionFailed {
+			err = writePreconditionFailed(w, response)
+			if err != nil {
+				logger.Printf("Error: %s", err.Error())
+			}
+
+			return
+		}
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	_, err = w.Write(response)
+	if err != nil {
+		status = http.StatusInternalServerError
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	status = http.StatusOK
+	logger.Printf("Status: %d %s", status, http.StatusText(status))
+}
+
+func isProductEdit(method string, route string) bool {
+	switch route {
+	case "attributes", "images", "unit":
+		return method == http.MethodPut
+	case "variants":
+		return method == http.MethodPost || method == http.MethodPut || method == http.MethodDelete
+	}
+
+	return false
+}
+
+// editProduct applies an edit made through one of the product's
+// sub-resources, which all need the product's version in If-Match. The
+// product stays locked until the request ends, and the response carries its
+// new ETag.
+func editProduct(r *http.Request, header http.Header, db datasources.DBClient, productID int, route string, logger *log.Logger) ([]byte, int, error) {
+	var response []byte
+	var status int
+
+	expectedVersion, err := versionFromIfMatch(r)
+	if err != nil {
+		return nil, http.StatusPreconditionRequired, err
+	}
+
+	err = db.LockProductVersion(productID, expectedVersion)
+	if err == datasources.ErrProductNotFound {
+		return nil, http.StatusNotFound, err
+	}
+	if err == datasources.ErrVersionConflict {
+		current, getErr := getProductByID(db, productID)
+		if getErr != nil {
+			return nil, http.StatusNotFound, getErr
+		}
+		response, marshalErr := json.Marshal(current)
+		if marshalErr != nil {
+			return nil, http.StatusInternalServerError, errors.New("could not marshal product response json")
+		}
+		header.Set("ETag", etagFor(current.Version))
+
+		return response, http.StatusPreconditionFailed, err
+	}
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, http.StatusInternalServerError, errors.New("could not get product")
+	}
+
+	switch {
+	case route == "attributes":
+		status, err = setProductAttributes(r, db, productID, logger)
+	case route == "images":
+		status, err = setProductImages(r, db, productID, logger)
+	case route == "unit":
+		status, err = setProductUnit(r, db, productID, logger)
+	case r.Method == http.MethodDelete:
+		status, err = deleteVariant(r, db, productID, logger)
+	default:
+		response, status, err = insertVariant(r, db, productID, logger, r.Method == http.MethodPut)
+	}
+	if err != nil {
+		return response, status, err
+	}
+
+	if saved, getErr := getProductByID(db, productID); getErr == nil {
+		header.Set("ETag", etagFor(saved.Version))
+	}
+
+	return response, status, nil
+}
+
+func getProduct(header http.Header, db datasources.DBClient, productID int, logger *log.Logger) ([]byte, int, error) {
+	products, err := db.GetProductsByIDs(productID)
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, http.StatusInternalServerError, errors.New("could not get product")
+	}
+	if len(products.Products) != 1 {
+		return nil, http.StatusNotFound, errors.New("the product provided does not exist")
+	}
+
+	response, err := json.Marshal(products.Products[0])
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("could not marshal product response json")
+	}
+	header.Set("ETag", etagFor(products.Products[0].Version))
+
+	return response, http.StatusOK, nil
+}
+
+func setProductAttributes(r *http.Request, db datasources.DBClient, productID int, logger *log.Logger) (int, error) {
+	var request repositories.ProductAttributesRequest
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &request)
+	}
+	if err != nil {
+		return http.StatusBadRequest, errors.New("product attributes sent on request body do not match required format")
+	}
+
+	err = validateAttributes(request.Attributes)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	before, err := getProductByID(db, productID)
+	if err != nil {
+		return http.StatusNotFound, err
+	}
+
+	err = db.SetProductAttributes(productID, request.Attributes)
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return http.StatusInternalServerError, errors.New("could not save Product attributes")
+	}
+	recordAudit(r, db, logger, repositories.ProductEntity, productID, repositories.UpdateOperation, before, productSnapshot(db, productID))
+
+	return http.StatusOK, nil
+}
+
+func setProductImages(r *http.Request, db datasources.DBClient, productID int, logger *log.Logger) (int, error) {
+	var request repositories.ProductImagesRequest
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &request)
+	}
+	if err != nil {
+		return http.StatusBadRequest, errors.New("product images sent on request body do not match required format")
+	}
+	for _, image := range request.Images {
+		if len(image.URL) < 1 || len(image.URL) > 255 {
+			return http.StatusBadRequest, errors.New("every product image must have a url of at most 255 characters")
+		}
+	}
+
+	before, err := getProductByID(db, productID)
+	if err != nil {
+		return http.StatusNotFound, err
+	}
+
+	err = db.SetProductImages(productID, request.Images)
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return http.StatusInternalServerError, errors.New("could not save Product images")
+	}
+	recordAudit(r, db, logger, repositories.ProductEntity, productID, repositories.UpdateOperation, before, productSnapshot(db, productID))
+
+	return http.StatusOK, nil
+}
+
+func getProductByID(db datasources.DBClient, productID int) (repositories.Product, error) {
+	products, err := db.GetProductsByIDs(productID)
+	if err != nil || len(products.Products) != 1 {
+		return repositories.Product{}, errors.New("the product provided does not exist")
+	}
+
+	return products.Products[0], nil
+}
+
+func productSnapshot(db datasources.DBClient, productID int) interface{} {
+	product, err := getProductByID(db, productID)
+	if err != nil {
+		return nil
+	}
+
+	return product
+}
@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mariacalinoiu/smartket/src/datasources"
+	"github.com/mariacalinoiu/smartket/src/promotions"
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+func HandlePromotions(w http.ResponseWriter, r *http.Request, db datasources.DBClient, logger *log.Logger) {
+	var response []byte
+	var status int
+	var err error
+
+	switch r.Method {
+	case http.MethodGet:
+		response, status, err = getPromotions(r, db, logger)
+	case http.MethodPost, http.MethodPut:
+		response, status, err = insertPromotion(r, db, logger, r.Method == http.MethodPut)
+	case http.MethodDelete:
+		status, err = deletePromotion(r, db, logger)
+	default:
+		status = http.StatusBadRequest
+		err = errors.New("wrong method type for /promotions route")
+	}
+
+	if err != nil {
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	_, err = w.Write(response)
+	if err != nil {
+		status = http.StatusInternalServerError
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	status = http.StatusOK
+	logger.Printf("Status: %d %s", status, http.StatusText(status))
+}
+
+func getPromotions(r *http.Request, db datasources.DBClient, logger *log.Logger) ([]byte, int, error) {
+	var found repositories.PromotionsJSON
+	var err error
+
+	params, ok := r.URL.Query()["promotionID"]
+	if ok && len(params[0]) > 0 {
+		promotionID, convErr := strconv.Atoi(params[0])
+		if convErr != nil {
+			return nil, http.StatusBadRequest, errors.New("could not convert parameter 'promotionID' to integer")
+		}
+		found, err = db.GetPromotions(promotionID)
+	} else {
+		found, err = db.GetPromotions()
+	}
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, http.StatusInternalServerError, errors.New("could not get promotions")
+	}
+
+	response, err := json.Marshal(found)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("could not marshal promotions response json")
+	}
+
+	return response, http.StatusOK, nil
+}
+
+func insertPromotion(r *http.Request, db datasources.DBClient, logger *log.Logger, update bool) ([]byte, int, error) {
+	var promotion repositories.Promotion
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &promotion)
+	}
+	if err != nil || !isPromotionValid(promotion) {
+		return nil, http.StatusBadRequest, errors.New("promotion information sent on request body does not match required format")
+	}
+
+	status, err := checkPromotionTargets(db, promotion, logger)
+	if err != nil {
+		return nil, status, err
+	}
+
+	promotionID := repositories.PromotionIDResponse{PromotionID: promotion.ID}
+	var before interface{}
+	operation := repositories.CreateOperation
+	if update {
+		current, getErr := getPromotion(db, promotion.ID)
+		if getErr != nil {
+			return nil, http.StatusNotFound, getErr
+		}
+		before = current
+		operation = repositories.UpdateOperation
+		err = db.EditPromotion(promotion)
+	} else {
+		promotionID, err = db.InsertPromotion(promotion)
+		promotion.ID = promotionID.PromotionID
+	}
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, http.StatusInternalServerError, errors.New("could not save Promotion")
+	}
+	recordAudit(r, db, logger, repositories.PromotionEntity, promotion.ID, operation, before, promotion)
+
+	response, err := json.Marshal(promotionID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("could not marshal promotionID response json")
+	}
+
+	return response, http.StatusOK, nil
+}
+
+func deletePromotion(r *http.Request, db datasources.DBClient, logger *log.Logger) (int, error) {
+	params, ok := r.URL.Query()["promotionID"]
+
+	if !ok || len(params[0]) < 1 {
+		return http.StatusBadRequest, errors.New("mandatory parameter 'promotionID' not found")
+	}
+
+	promotionID, err := strconv.Atoi(params[0])
+	if err != nil {
+		return http.StatusBadRequest, errors.New("could not convert parameter 'promotionID' to integer")
+	}
+
+	before, err := getPromotion(db, promotionID)
+	if err != nil {
+		return http.StatusNotFound, err
+	}
+	err = db.DeletePromotion(promotionID)
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return http.StatusInternalServerError, errors.New("could not delete Promotion")
+	}
+	recordAudit(r, db, logger, repositories.PromotionEntity, promotionID, repositories.DeleteOperation, before, nil)
+
+	return http.StatusOK, nil
+}
+
+func getPromotion(db datasources.DBClient, promotionID int) (repositories.Promotion, error) {
+	found, err := db.GetPromotions(promotionID)
+	if err != nil || len(found.Promotions) != 1 {
+		return repositories.Promotion{}, errors.New("the promotion provided does not exist")
+	}
+
+	return found.Promotions[0], nil
+}
+
+func isPromotionValid(promotion repositories.Promotion) bool {
+	if len(promotion.Name) < 1 || promotion.StartTimestamp < 0 ||
+		(promotion.EndTimestamp != 0 && promotion.EndTimestamp <= promotion.StartTimestamp) {
+		return false
+	}
+
+	switch promotion.Type {
+	case repositories.BuyXGetYPromotion:
+		return len(promotion.ProductIDs) > 0 && promotion.BuyQuantity > 0 && promotion.FreeQuantity > 0
+	case repositories.CategoryPercentagePromotion:
+		return promotion.CategoryID > 0 && promotion.Percentage > 0 && promotion.Percentage <= 100
+	case repositories.ThresholdAmountPromotion:
+		return promotion.Threshold > 0 && promotion.Amount > 0
+	case repositories.BundlePromotion:
+		seen := make(map[int]bool)
+		for _, productID := range promotion.ProductIDs {
+			if seen[productID] {
+				return false
+			}
+			seen[productID] = true
+		}
+		return len(promotion.ProductIDs) > 1 && promotion.BundlePrice > 0
+	}
+
+	return false
+}
+
+// checkPromotionTargets requires the products and the category a promotion
+// is for to exist.
+func checkPromotionTargets(db datasources.DBClient, promotion repositories.Promotion, logger *log.Logger) (int, error) {
+	if len(promotion.ProductIDs) > 0 {
+		products, err := db.GetProductsByIDs(promotion.ProductIDs...)
+		if err != nil {
+			logger.Printf("Internal error: %s", err.Error())
+			return http.StatusInternalServerError, errors.New("could not get promotion products")
+		}
+		if len(products.Products) != len(promotion.ProductIDs) {
+			return http.StatusBadRequest, errors.New("one of the promotion products does not exist")
+		}
+	}
+
+	if promotion.CategoryID > 0 {
+		categories, err := db.GetCategories(promotion.CategoryID)
+		if err != nil {
+			logger.Printf("Internal error: %s", err.Error())
+			return http.StatusInternalServerError, errors.New("could not get promotion category")
+		}
+		if len(categories.Categories) != 1 {
+			return http.StatusBadRequest, errors.New("the promotion category does not exist")
+		}
+	}
+
+	return http.StatusOK, nil
+}
+
+// activePromotions returns the promotions running at the given timestamp.
+func activePromotions(db datasources.DBClient, timestamp int, logger *log.Logger) ([]repositories.Promotion, int, error) {
+	active, err := db.GetActivePromotions(timestamp)
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, http.StatusInternalServerError, errors.New("could not get promotions")
+	}
+
+	return active.Promotions, http.StatusOK, nil
+}
+
+// orderPromotions returns the promotions that were running when the order in
+// the snapshot was placed, so changing its lines keeps the same offers.
+func orderPromotions(db datasources.DBClient, snapshot interface{}, logger *log.Logger) ([]repositories.Promotion, int, error) {
+	order, ok := snapshot.(repositories.Order)
+	if !ok {
+		return nil, http.StatusNotFound, datasources.ErrOrderNotFound
+	}
+
+	return activePromotions(db, order.Timestamp, logger)
+}
+
+// applyPromotions sets on the order lines what the promotions active now take
+// off them, replacing whatever the lines carried before.
+func applyPromotions(db datasources.DBClient, products []repositories.OrderedProduct, logger *log.Logger) ([]repositories.OrderedProduct, int, error) {
+	active, status, err := activePromotions(db, int(time.Now().UnixNano()/1000000000), logger)
+	if err != nil {
+		return products, status, err
+	}
+
+	var productIDs []int
+	for _, product := range products {
+		productIDs = append(productIDs, product.ProductID)
+	}
+	found, err := db.GetProductsByIDs(productIDs...)
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return products, http.StatusInternalServerError, errors.New("could not get ordered products")
+	}
+
+	byID := make(map[int]repositories.Product)
+	for _, product := range found.Products {
+		byID[product.ID] = product
+	}
+
+	var lines []promotions.Line
+	for _, ordered := range products {
+		lines = append(lines, promotionLine(byID[ordered.ProductID], ordered))
+	}
+
+	for i, discount := range promotions.Apply(lines, active) {
+		products[i].PromotionDiscount = discount.Total
+		products[i].Promotions = discount.Applied
+	}
+
+	return products, http.StatusOK, nil
+}
+
+func promotionLine(product repositories.Product, ordered repositories.OrderedProduct) promotions.Line {
+	line := promotions.Line{
+		ProductID: ordered.ProductID,
+		UnitPrice: product.Price,
+		Quantity:  ordered.Quantity,
+	}
+
+	for _, variant := range product.Variants {
+		if variant.ID == ordered.VariantID {
+			line.UnitPrice = variant.Price
+		}
+	}
+	for _, breadcrumb := range product.Breadcrumbs {
+		if breadcrumb.Kind == repositories.CategoryBreadcrumb {
+			line.CategoryIDs = append(line.CategoryIDs, breadcrumb.ID)
+		}
+	}
+
+	return line
+}
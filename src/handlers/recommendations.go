@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/mariacalinoiu/smartket/src/datasources"
+	"github.com/mariacalinoiu/smartket/src/recommendations"
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+const (
+	defaultRecommendations = 10
+	maxRecommendations     = 50
+)
+
+func HandleCartSuggestions(w http.ResponseWriter, r *http.Request, db datasources.DBClient, engine *recommendations.Engine, logger *log.Logger) {
+	var response []byte
+	var status int
+	var err error
+
+	switch r.Method {
+	case http.MethodGet:
+		response, status, err = getCartSuggestions(r, db, engine, logger)
+	default:
+		status = http.StatusBadRequest
+		err = errors.New("wrong method type for /carts/suggestions route")
+	}
+
+	if err != nil {
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	_, err = w.Write(response)
+	if err != nil {
+		status = http.StatusInternalServerError
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	status = http.StatusOK
+	logger.Printf("Status: %d %s", status, http.StatusText(status))
+}
+
+func getRelatedProducts(r *http.Request, db datasources.DBClient, engine *recommendations.Engine, productID int, logger *log.Logger) ([]byte, int, error) {
+	limit, err := recommendationsLimitOf(r.URL.Query())
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	return recommendedProducts(db, engine.Related(productID, 2*limit), limit, logger)
+}
+
+func getCartSuggestions(r *http.Request, db datasources.DBClient, engine *recommendations.Engine, logger *log.Logger) ([]byte, int, error) {
+	query := r.URL.Query()
+
+	limit, err := recommendationsLimitOf(query)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	var basket []int
+	switch {
+	case len(query.Get("cartID")) > 0:
+		cartID, convErr := strconv.Atoi(query.Get("cartID"))
+		if convErr != nil {
+			return nil, http.StatusBadRequest, errors.New("could not convert parameter 'cartID' to integer")
+		}
+
+		carts, getErr := db.GetCarts(cartID)
+		if getErr != nil {
+			logger.Printf("Internal error: %s", getErr.Error())
+			return nil, http.StatusInternalServerError, errors.New("could not get cart")
+		}
+		if len(carts.Carts) != 1 {
+			return nil, http.StatusNotFound, errors.New("the cart provided does not exist")
+		}
+
+		for _, product := range carts.Carts[0].ProductsInCart {
+			basket = append(basket, product.ProductID)
+		}
+	case len(query.Get("productIDs")) > 0:
+		for _, param := range strings.Split(query.Get("productIDs"), ",") {
+			productID, convErr := strconv.Atoi(strings.TrimSpace(param))
+			if convErr != nil {
+				return nil, http.StatusBadRequest, errors.New("could not convert parameter 'productIDs' to a list of integers")
+			}
+			basket = append(basket, productID)
+		}
+	default:
+		return nil, http.StatusBadRequest, errors.New("one of the parameters 'cartID' or 'productIDs' is mandatory")
+	}
+
+	return recommendedProducts(db, engine.ForBasket(basket, 2*limit), limit, logger)
+}
+
+// recommendedProducts loads the details of the suggested products, dropping
+// the ones out of stock; twice the limit is asked of the engine to make up for them.
+func recommendedProducts(db datasources.DBClient, productIDs []int, limit int, logger *log.Logger) ([]byte, int, error) {
+	found, err := db.GetProductsByIDs(productIDs...)
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, http.StatusInternalServerError, errors.New("could not get recommended products")
+	}
+
+	products := repositories.ProductsJSON{Products: []repositories.Product{}}
+	for _, product := range found.Products {
+		if product.Stock > 0 && len(products.Products) < limit {
+			products.Products = append(products.Products, product)
+		}
+	}
+
+	response, err := json.Marshal(products)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("could not marshal products response json")
+	}
+
+	return response, http.StatusOK, nil
+}
+
+func recommendationsLimitOf(query url.Values) (int, error) {
+	if len(query.Get("limit")) == 0 {
+		return defaultRecommendations, nil
+	}
+
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit < 1 || limit > maxRecommendations {
+		return 0, errors.New("parameter 'limit' must be an integer between 1 and " + strconv.Itoa(maxRecommendations))
+	}
+
+	return limit, nil
+}
@@ -0,0 +1,284 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/mariacalinoiu/smartket/src/datasources"
+	"github.com/mariacalinoiu/smartket/src/invoices"
+	"github.com/mariacalinoiu/smartket/src/payments"
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+var errNoCapturedPayment = errors.New("the order has no captured payment to refund")
+
+func HandleRefunds(w http.ResponseWriter, r *http.Request, db datasources.DBClient, providers payments.Registry, invoicing invoices.Config, logger *log.Logger) {
+	var response []byte
+	var status int
+	var err error
+
+	switch r.Method {
+	case http.MethodGet:
+		response, status, err = getRefunds(r, db, logger)
+	case http.MethodPost:
+		response, status, err = insertRefund(r, db, providers, invoicing, logger)
+	default:
+		status = http.StatusBadRequest
+		err = errors.New("wrong method type for /refunds route")
+	}
+
+	if err != nil {
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	_, err = w.Write(response)
+	if err != nil {
+		status = http.StatusInternalServerError
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	status = http.StatusOK
+	logger.Printf("Status: %d %s", status, http.StatusText(status))
+}
+
+func getRefunds(r *http.Request, db datasources.DBClient, logger *log.Logger) ([]byte, int, error) {
+	params, ok := r.URL.Query()["orderID"]
+
+	if !ok || len(params[0]) < 1 {
+		return nil, http.StatusBadRequest, errors.New("mandatory parameter 'orderID' not found")
+	}
+
+	orderID, err := strconv.Atoi(params[0])
+	if err != nil {
+		return nil, http.StatusBadRequest, errors.New("could not convert parameter 'orderID' to integer")
+	}
+	refunds, _, err := db.GetRefundsByOrderID(orderID)
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, http.StatusInternalServerError, errors.New("could not get refunds for Order")
+	}
+
+	response, err := json.Marshal(refunds)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("could not marshal refunds response json")
+	}
+
+	return response, http.StatusOK, nil
+}
+
+func extractRefundParams(r *http.Request) (repositories.Refund, error) {
+	var unmarshalledRefund repositories.Refund
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return repositories.Refund{}, err
+	}
+
+	err = json.Unmarshal(body, &unmarshalledRefund)
+	if err != nil {
+		return repositories.Refund{}, err
+	}
+
+	return unmarshalledRefund, nil
+}
+
+func insertRefund(r *http.Request, db datasources.DBClient, providers payments.Registry, invoicing invoices.Config, logger *log.Logger) ([]byte, int, error) {
+	refund, err := extractRefundParams(r)
+	refund.Operator = actorOf(r)
+	if err != nil || !isRefundValid(refund) {
+		return nil, http.StatusBadRequest, errors.New("refund information sent on request body does not match required format")
+	}
+
+	orders, err := db.GetOrders(refund.OrderID)
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, http.StatusInternalServerError, errors.New("could not get Order")
+	}
+	if len(orders.Orders) != 1 {
+		return nil, http.StatusBadRequest, errors.New("the order provided does not exist")
+	}
+	order := orders.Orders[0]
+
+	refund, err = calculateRefund(refund, order)
+	if err == errNoCapturedPayment {
+		return nil, http.StatusConflict, err
+	}
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	refund, _, status, err := refundOrder(r, db, providers, invoicing, logger, order, refund)
+	if err != nil {
+		return nil, status, err
+	}
+
+	response, err := json.Marshal(repositories.RefundIDResponse{RefundID: refund.ID})
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("could not marshal refundID response json")
+	}
+
+	return response, http.StatusOK, nil
+}
+
+// refundOrder records the refund, checked against what is left of the order,
+// and sends its amount back through the provider of the order's captured
+// payment. When the provider fails, the refund is undone along with the rest
+// of the request.
+func refundOrder(r *http.Request, db datasources.DBClient, providers payments.Registry, invoicing invoices.Config, logger *log.Logger, order repositories.Order, refund repositories.Refund) (repositories.Refund, repositories.Payment, int, error) {
+	provider, err := providers.Get(order.PaymentMethod)
+	if err != nil {
+		return refund, repositories.Payment{}, http.StatusBadRequest, err
+	}
+
+	refundID, err := db.InsertRefund(refund, order.Total)
+	switch {
+	case err == datasources.ErrOrderNotFound:
+		return refund, repositories.Payment{}, http.StatusBadRequest, errors.New("the order provided does not exist")
+	case err == datasources.ErrRefundExceedsOrder, err == datasources.ErrRefundExceedsQuantity:
+		return refund, repositories.Payment{}, http.StatusConflict, err
+	case err != nil:
+		logger.Printf("Internal error: %s", err.Error())
+		return refund, repositories.Payment{}, http.StatusInternalServerError, errors.New("could not save Refund")
+	}
+	refund.ID = refundID.RefundID
+
+	authorization, captured, refunded := summarizePayments(order.Payments)
+	result, err := provider.Refund(transactionOf(authorization, captured, refunded), refund.Amount)
+	if err != nil {
+		logger.Printf("Payment error: %s; OrderID: %d", err.Error(), order.ID)
+		return refund, repositories.Payment{}, http.StatusBadGateway, errors.New("the payment provider did not refund the order: " + err.Error())
+	}
+
+	payment := repositories.Payment{
+		OrderID:       order.ID,
+		Provider:      order.PaymentMethod,
+		Operation:     payments.OperationRefund,
+		TransactionID: result.TransactionID,
+		Status:        result.Status,
+		Amount:        refund.Amount,
+	}
+	payment.ID, err = db.InsertPayment(payment)
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return refund, payment, http.StatusInternalServerError, errors.New("could not save Payment")
+	}
+
+	recordAudit(r, db, logger, repositories.RefundEntity, refund.ID, repositories.CreateOperation, nil, refund)
+	recordAudit(r, db, logger, repositories.PaymentEntity, payment.ID, repositories.CreateOperation, nil, payment)
+	recordAudit(r, db, logger, repositories.OrderEntity, order.ID, repositories.UpdateOperation, order, orderSnapshot(db, order.ID))
+	err = issueCreditNote(r, db, invoicing, logger, order, refund)
+	if err != nil {
+		logger.Printf("Invoicing error: %s; OrderID: %d, RefundID: %d; the credit note will be issued by the invoices worker", err.Error(), order.ID, refund.ID)
+	}
+
+	return refund, payment, http.StatusOK, nil
+}
+
+// calculateRefund works out the amounts of the refund from the order; only
+// orders with a captured payment can be refunded.
+func calculateRefund(refund repositories.Refund, order repositories.Order) (repositories.Refund, error) {
+	_, captured, _ := summarizePayments(order.Payments)
+	if captured == 0 {
+		return refund, errNoCapturedPayment
+	}
+
+	remainingValue := order.Total - order.RefundedValue
+	if remainingValue <= 0 {
+		return refund, errors.New("the order has already been fully refunded")
+	}
+
+	refundedQuantities := make(map[productLine]float32)
+	for _, previousRefund := range order.Refunds {
+		for _, product := range previousRefund.ProductsRefunded {
+			refundedQuantities[productLine{productID: product.ProductID, variantID: product.VariantID}] += product.Quantity
+		}
+	}
+
+	lineAmount := func(product repositories.OrderedProduct, quantity float32) float32 {
+		amount := product.Product.Price * quantity
+		if product.Quantity > 0 {
+			amount -= product.PromotionDiscount * quantity / product.Quantity
+		}
+		return amount * 100 / (100 + float32(order.DiscountPercentage))
+	}
+
+	switch refund.Type {
+	case repositories.FullRefund:
+		refund.ProductsRefunded = nil
+		for _, product := range order.ProductsOrdered {
+			quantity := product.Quantity - refundedQuantities[productLine{productID: product.ProductID, variantID: product.VariantID}]
+			if quantity > 0 {
+				refund.ProductsRefunded = append(refund.ProductsRefunded, repositories.RefundedProduct{
+					ProductID: product.ProductID,
+					VariantID: product.VariantID,
+					Quantity:  quantity,
+					Amount:    lineAmount(product, quantity),
+				})
+			}
+		}
+		refund.Amount = remainingValue
+	case repositories.LinesRefund:
+		ordered := make(map[productLine]repositories.OrderedProduct)
+		for _, product := range order.ProductsOrdered {
+			ordered[productLine{productID: product.ProductID, variantID: product.VariantID}] = product
+		}
+
+		refund.Amount = 0
+		for i, line := range refund.ProductsRefunded {
+			key := productLine{productID: line.ProductID, variantID: line.VariantID}
+			product, ok := ordered[key]
+			if !ok || line.Quantity > product.Quantity-refundedQuantities[key] {
+				return refund, datasources.ErrRefundExceedsQuantity
+			}
+			refundedQuantities[key] += line.Quantity
+
+			refund.ProductsRefunded[i].Amount = lineAmount(product, line.Quantity)
+			refund.Amount += refund.ProductsRefunded[i].Amount
+		}
+	case repositories.AmountRefund:
+		refund.ProductsRefunded = nil
+		refund.Restock = false
+	}
+
+	if refund.Amount > remainingValue {
+		return refund, datasources.ErrRefundExceedsOrder
+	}
+
+	return refund, nil
+}
+
+func isRefundValid(refund repositories.Refund) bool {
+	if refund.OrderID < 1 || len(refund.Reason) < 1 || len(refund.Operator) < 1 {
+		return false
+	}
+
+	switch refund.Type {
+	case repositories.FullRefund:
+		return true
+	case repositories.LinesRefund:
+		if len(refund.ProductsRefunded) < 1 {
+			return false
+		}
+		for _, product := range refund.ProductsRefunded {
+			if product.Quantity <= 0 {
+				return false
+			}
+		}
+
+		return true
+	case repositories.AmountRefund:
+		return refund.Amount > 0
+	}
+
+	return false
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mariacalinoiu/smartket/src/datasources"
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+func HandleSalesReports(w http.ResponseWriter, r *http.Request, db datasources.DBClient, logger *log.Logger) {
+	handleReport(w, r, db, logger, r.URL.Query().Get("groupBy"))
+}
+
+func HandleVoucherReports(w http.ResponseWriter, r *http.Request, db datasources.DBClient, logger *log.Logger) {
+	handleReport(w, r, db, logger, repositories.VoucherReport)
+}
+
+func handleReport(w http.ResponseWriter, r *http.Request, db datasources.DBClient, logger *log.Logger, groupBy string) {
+	var response []byte
+	var contentType string
+	var status int
+	var err error
+
+	switch r.Method {
+	case http.MethodGet:
+		response, contentType, status, err = getSalesReport(r, db, logger, groupBy)
+	default:
+		status = http.StatusBadRequest
+		err = errors.New("wrong method type for " + r.URL.Path + " route")
+	}
+
+	if err != nil {
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	_, err = w.Write(response)
+	if err != nil {
+		status = http.StatusInternalServerError
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	status = http.StatusOK
+	logger.Printf("Status: %d %s", status, http.StatusText(status))
+}
+
+func getSalesReport(r *http.Request, db datasources.DBClient, logger *log.Logger, groupBy string) ([]byte, string, int, error) {
+	query := r.URL.Query()
+
+	format := query.Get("format")
+	if len(format) == 0 {
+		format = "json"
+	}
+	if format != "json" && format != "csv" {
+		return nil, "", http.StatusBadRequest, errors.New("parameter 'format' must be json or csv")
+	}
+
+	from, to, err := dateRangeOf(query)
+	if err != nil {
+		return nil, "", http.StatusBadRequest, err
+	}
+
+	rows, err := db.GetSalesReport(groupBy, from, to)
+	if err == datasources.ErrUnknownReport {
+		return nil, "", http.StatusBadRequest, fmt.Errorf("parameter 'groupBy' must be one of day, week, month, department, category, product, city, paymentMethod or voucher")
+	}
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, "", http.StatusInternalServerError, errors.New("could not get sales report")
+	}
+
+	totals, err := db.GetSalesTotals(from, to)
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, "", http.StatusInternalServerError, errors.New("could not get sales report totals")
+	}
+
+	report := repositories.SalesReport{
+		GroupBy: groupBy,
+		From:    time.Unix(int64(from), 0).Format(exportDateLayout),
+		To:      time.Unix(int64(to-1), 0).Format(exportDateLayout),
+		Rows:    rows,
+		Totals:  totals,
+	}
+
+	if format == "csv" {
+		response, err := salesReportCSV(report)
+		if err != nil {
+			return nil, "", http.StatusInternalServerError, errors.New("could not write sales report csv")
+		}
+
+		return response, "text/csv; charset=utf-8", http.StatusOK, nil
+	}
+
+	response, err := json.Marshal(report)
+	if err != nil {
+		return nil, "", http.StatusInternalServerError, errors.New("could not marshal sales report response json")
+	}
+
+	return response, "application/json", http.StatusOK, nil
+}
+
+func salesReportCSV(report repositories.SalesReport) ([]byte, error) {
+	var out bytes.Buffer
+	writer := csv.NewWriter(&out)
+
+	money := func(value float32) string {
+		return strconv.FormatFloat(float64(value), 'f', 2, 32)
+	}
+
+	records := [][]string{{report.GroupBy, "label", "orders", "quantity", "revenue", "discount", "refunded", "netRevenue", "averageBasket"}}
+	for _, row := range append(report.Rows, report.Totals) {
+		records = append(records, []string{
+			row.Key, row.Label, strconv.Itoa(row.Orders), strconv.FormatFloat(float64(row.Quantity), 'f', -1, 32), money(row.Revenue),
+			money(row.Discount), money(row.Refunded), money(row.NetRevenue), money(row.AverageBasket),
+		})
+	}
+
+	err := writer.WriteAll(records)
+
+	return out.Bytes(), err
+}
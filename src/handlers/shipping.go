@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/mariacalinoiu/smartket/src/datasources"
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+func HandleAddresses(w http.ResponseWriter, r *http.Request, db datasources.DBClient, logger *log.Logger) {
+	var response []byte
+	var status int
+	var err error
+
+	switch r.Method {
+	case http.MethodGet:
+		response, status, err = getAddresses(r, db, logger)
+	case http.MethodPost, http.MethodPut:
+		response, status, err = insertAddress(r, db, logger, r.Method == http.MethodPut)
+	case http.MethodDelete:
+		status, err = deleteAddress(r, db, logger)
+	default:
+		status = http.StatusBadRequest
+		err = errors.New("wrong method type for /addresses route")
+	}
+
+	if err != nil {
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	_, err = w.Write(response)
+	if err != nil {
+		status = http.StatusInternalServerError
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	status = http.StatusOK
+	logger.Printf("Status: %d %s", status, http.StatusText(status))
+}
+
+func HandleDeliveryZones(w http.ResponseWriter, r *http.Request, db datasources.DBClient, logger *log.Logger) {
+	var response []byte
+	var status int
+	var err error
+
+	switch r.Method {
+	case http.MethodGet:
+		response, status, err = getDeliveryZones(db, logger)
+	case http.MethodPost, http.MethodPut:
+		response, status, err = insertDeliveryZone(r, db, logger, r.Method == http.MethodPut)
+	case http.MethodDelete:
+		status, err = deleteDeliveryZone(r, db, logger)
+	default:
+		status = http.StatusBadRequest
+		err = errors.New("wrong method type for /delivery-zones route")
+	}
+
+	if err != nil {
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	_, err = w.Write(response)
+	if err != nil {
+		status = http.StatusInternalServerError
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	status = http.StatusOK
+	logger.Printf("Status: %d %s", status, http.StatusText(status))
+}
+
+func getAddresses(r *http.Request, db datasources.DBClient, logger *log.Logger) ([]byte, int, error) {
+	params, ok := r.URL.Query()["email"]
+
+	if !ok || len(params[0]) < 1 {
+		return nil, http.StatusBadRequest, errors.New("mandatory parameter 'email' not found")
+	}
+
+	addresses, err := db.GetAddresses(params[0])
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, http.StatusInternalServerError, errors.New("could not get addresses")
+	}
+
+	response, err := json.Marshal(addresses)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("could not marshal addresses response json")
+	}
+
+	return response, http.StatusOK, nil
+}
+
+func insertAddress(r *http.Request, db datasources.DBClient, logger *log.Logger, update bool) ([]byte, int, error) {
+	var address repositories.Address
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &address)
+	}
+	if err != nil || len(address.Email) < 1 || !isAddressValid(address) {
+		return nil, http.StatusBadRequest, errors.New("address information sent on request body does not match required format")
+	}
+
+	addressID := repositories.AddressIDResponse{AddressID: address.ID}
+	var before interface{}
+	operation := repositories.CreateOperation
+	if update {
+		current, getErr := db.GetAddress(address.ID)
+		if getErr != nil {
+			return nil, http.StatusNotFound, getErr
+		}
+		before = current
+		operation = repositories.UpdateOperation
+		err = db.EditAddress(address)
+	} else {
+		addressID, err = db.InsertAddress(address)
+		address.ID = addressID.AddressID
+	}
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, http.StatusInternalServerError, errors.New("could not save Address")
+	}
+	recordAudit(r, db, logger, repositories.AddressEntity, address.ID, operation, before, address)
+
+	response, err := json.Marshal(addressID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("could not marshal addressID response json")
+	}
+
+	return response, http.StatusOK, nil
+}
+
+func deleteAddress(r *http.Request, db datasources.DBClient, logger *log.Logger) (int, error) {
+	params, ok := r.URL.Query()["addressID"]
+
+	if !ok || len(params[0]) < 1 {
+		return http.StatusBadRequest, errors.New("mandatory parameter 'addressID' not found")
+	}
+
+	addressID, err := strconv.Atoi(params[0])
+	if err != nil {
+		return http.StatusBadRequest, errors.New("could not convert parameter 'addressID' to integer")
+	}
+
+	before, err := db.GetAddress(addressID)
+	if err != nil {
+		return http.StatusNotFound, err
+	}
+	err = db.DeleteAddress(addressID)
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return http.StatusInternalServerError, errors.New("could not delete Address")
+	}
+	recordAudit(r, db, logger, repositories.AddressEntity, addressID, repositories.DeleteOperation, before, nil)
+
+	return http.StatusOK, nil
+}
+
+func getDeliveryZones(db datasources.DBClient, logger *log.Logger) ([]byte, int, error) {
+	zones, err := db.GetDeliveryZones()
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, http.StatusInternalServerError, errors.New("could not get delivery zones")
+	}
+
+	response, err := json.Marshal(zones)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("could not marshal delivery zones response json")
+	}
+
+	return response, http.StatusOK, nil
+}
+
+func insertDeliveryZone(r *http.Request, db datasources.DBClient, logger *log.Logger, update bool) ([]byte, int, error) {
+	var zone repositories.DeliveryZone
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &zone)
+	}
+	if err != nil || len(zone.Name) < 1 || zone.ShippingFee < 0 || zone.FreeShippingThreshold < 0 ||
+		len(zone.Counties)+len(zone.PostalCodePrefixes) == 0 {
+		return nil, http.StatusBadRequest, errors.New("delivery zone information sent on request body does not match required format")
+	}
+
+	zoneID := repositories.DeliveryZoneIDResponse{DeliveryZoneID: zone.ID}
+	var before interface{}
+	operation := repositories.CreateOperation
+	if update {
+		zones, getErr := db.GetDeliveryZones(zone.ID)
+		if getErr != nil || len(zones.DeliveryZones) != 1 {
+			return nil, http.StatusNotFound, errors.New("the delivery zone provided does not exist")
+		}
+		before = zones.DeliveryZones[0]
+		operation = repositories.UpdateOperation
+		err = db.EditDeliveryZone(zone)
+	} else {
+		zoneID, err = db.InsertDeliveryZone(zone)
+		zone.ID = zoneID.DeliveryZoneID
+	}
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, http.StatusInternalServerError, errors.New("could not save Delivery Zone")
+	}
+	recordAudit(r, db, logger, repositories.DeliveryZoneEntity, zone.ID, operation, before, zone)
+
+	response, err := json.Marshal(zoneID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("could not marshal deliveryZoneID response json")
+	}
+
+	return response, http.StatusOK, nil
+}
+
+func deleteDeliveryZone(r *http.Request, db datasources.DBClient, logger *log.Logger) (int, error) {
+	params, ok := r.URL.Query()["deliveryZoneID"]
+
+	if !ok || len(params[0]) < 1 {
+		return http.StatusBadRequest, errors.New("mandatory parameter 'deliveryZoneID' not found")
+	}
+
+	zoneID, err := strconv.Atoi(params[0])
+	if err != nil {
+		return http.StatusBadRequest, errors.New("could not convert parameter 'deliveryZoneID' to integer")
+	}
+
+	zones, err := db.GetDeliveryZones(zoneID)
+	if err != nil || len(zones.DeliveryZones) != 1 {
+		return http.StatusNotFound, errors.New("the delivery zone provided does not exist")
+	}
+	err = db.DeleteDeliveryZone(zoneID)
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return http.StatusInternalServerError, errors.New("could not delete Delivery Zone")
+	}
+	recordAudit(r, db, logger, repositories.DeliveryZoneEntity, zoneID, repositories.DeleteOperation, zones.DeliveryZones[0], nil)
+
+	return http.StatusOK, nil
+}
+
+func isAddressValid(address repositories.Address) bool {
+	return len(address.Street) > 0 && len(address.Number) > 0 && len(address.PostalCode) > 0 &&
+		len(address.City) > 0 && len(address.County) > 0 && len(address.Country) > 0
+}
+
+func formatAddress(address repositories.Address) string {
+	formatted := fmt.Sprintf("%s %s", address.Street, address.Number)
+	if len(address.Details) > 0 {
+		formatted += ", " + address.Details
+	}
+
+	return fmt.Sprintf("%s, %s %s, %s, %s", formatted, address.PostalCode, address.City, address.County, address.Country)
+}
@@ -0,0 +1,403 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/mariacalinoiu/smartket/src/datasources"
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+const (
+	defaultSlotDays = 7
+	maxSlotDays     = 30
+)
+
+var slotTimePattern = regexp.MustCompile(`^([01][0-9]|2[0-3]):[0-5][0-9]$`)
+
+func HandleDeliverySlots(w http.ResponseWriter, r *http.Request, db datasources.DBClient, logger *log.Logger) {
+	var response []byte
+	var status int
+	var err error
+
+	switch r.Method {
+	case http.MethodGet:
+		response, status, err = getDeliverySlots(r, db, logger)
+	case http.MethodPost, http.MethodPut:
+		response, status, err = insertDeliverySlot(r, db, logger, r.Method == http.MethodPut)
+	case http.MethodDelete:
+		status, err = deleteDeliverySlot(r, db, logger)
+	default:
+		status = http.StatusBadRequest
+		err = errors.New("wrong method type for /delivery-slots route")
+	}
+
+	if err != nil {
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	_, err = w.Write(response)
+	if err != nil {
+		status = http.StatusInternalServerError
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	status = http.StatusOK
+	logger.Printf("Status: %d %s", status, http.StatusText(status))
+}
+
+func HandleAvailableDeliverySlots(w http.ResponseWriter, r *http.Request, db datasources.DBClient, logger *log.Logger) {
+	var response []byte
+	var status int
+	var err error
+
+	switch r.Method {
+	case http.MethodGet:
+		response, status, err = getAvailableDeliverySlots(r, db, logger)
+	default:
+		status = http.StatusBadRequest
+		err = errors.New("wrong method type for /delivery-slots/available route")
+	}
+
+	if err != nil {
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	_, err = w.Write(response)
+	if err != nil {
+		status = http.StatusInternalServerError
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	status = http.StatusOK
+	logger.Printf("Status: %d %s", status, http.StatusText(status))
+}
+
+func HandleSlotReservations(w http.ResponseWriter, r *http.Request, db datasources.DBClient, ttl time.Duration, logger *log.Logger) {
+	var response []byte
+	var status int
+	var err error
+
+	switch r.Method {
+	case http.MethodPost:
+		response, status, err = reserveDeliverySlot(r, db, ttl, logger)
+	default:
+		status = http.StatusBadRequest
+		err = errors.New("wrong method type for /delivery-slots/reservations route")
+	}
+
+	if err != nil {
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	_, err = w.Write(response)
+	if err != nil {
+		status = http.StatusInternalServerError
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	status = http.StatusOK
+	logger.Printf("Status: %d %s", status, http.StatusText(status))
+}
+
+func getDeliverySlots(r *http.Request, db datasources.DBClient, logger *log.Logger) ([]byte, int, error) {
+	slots, status, err := slotsFor(r, db, logger)
+	if err != nil {
+		return nil, status, err
+	}
+
+	response, err := json.Marshal(slots)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("could not marshal delivery slots response json")
+	}
+
+	return response, http.StatusOK, nil
+}
+
+func insertDeliverySlot(r *http.Request, db datasources.DBClient, logger *log.Logger, update bool) ([]byte, int, error) {
+	var slot repositories.DeliverySlot
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &slot)
+	}
+	if err != nil || !isDeliverySlotValid(slot) {
+		return nil, http.StatusBadRequest, errors.New("delivery slot information sent on request body does not match required format")
+	}
+	if slot.PickupLocationID > 0 {
+		location, getErr := getPickupLocation(db, slot.PickupLocationID)
+		if getErr != nil {
+			return nil, http.StatusBadRequest, getErr
+		}
+		if !isWithinOpeningHours(slot, location) {
+			return nil, http.StatusBadRequest, errors.New("the pickup slot must fall within the opening hours of the pickup location")
+		}
+	}
+
+	slotID := repositories.DeliverySlotIDResponse{DeliverySlotID: slot.ID}
+	var before interface{}
+	operation := repositories.CreateOperation
+	if update {
+		current, getErr := db.GetDeliverySlot(slot.ID)
+		if getErr != nil {
+			return nil, http.StatusNotFound, getErr
+		}
+		before = current
+		operation = repositories.UpdateOperation
+		err = db.EditDeliverySlot(slot)
+	} else {
+		slotID, err = db.InsertDeliverySlot(slot)
+		slot.ID = slotID.DeliverySlotID
+	}
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, http.StatusInternalServerError, errors.New("could not save Delivery Slot")
+	}
+	recordAudit(r, db, logger, repositories.DeliverySlotEntity, slot.ID, operation, before, slot)
+
+	response, err := json.Marshal(slotID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("could not marshal deliverySlotID response json")
+	}
+
+	return response, http.StatusOK, nil
+}
+
+func deleteDeliverySlot(r *http.Request, db datasources.DBClient, logger *log.Logger) (int, error) {
+	params, ok := r.URL.Query()["deliverySlotID"]
+
+	if !ok || len(params[0]) < 1 {
+		return http.StatusBadRequest, errors.New("mandatory parameter 'deliverySlotID' not found")
+	}
+
+	slotID, err := strconv.Atoi(params[0])
+	if err != nil {
+		return http.StatusBadRequest, errors.New("could not convert parameter 'deliverySlotID' to integer")
+	}
+
+	before, err := db.GetDeliverySlot(slotID)
+	if err != nil {
+		return http.StatusNotFound, err
+	}
+	err = db.DeleteDeliverySlot(slotID)
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return http.StatusInternalServerError, errors.New("could not delete Delivery Slot")
+	}
+	recordAudit(r, db, logger, repositories.DeliverySlotEntity, slotID, repositories.DeleteOperation, before, nil)
+
+	return http.StatusOK, nil
+}
+
+func getAvailableDeliverySlots(r *http.Request, db datasources.DBClient, logger *log.Logger) ([]byte, int, error) {
+	var err error
+
+	days := defaultSlotDays
+	if dayParams, ok := r.URL.Query()["days"]; ok && len(dayParams[0]) > 0 {
+		days, err = strconv.Atoi(dayParams[0])
+		if err != nil || days < 1 || days > maxSlotDays {
+			return nil, http.StatusBadRequest, errors.New("parameter 'days' must be an integer between 1 and 30")
+		}
+	}
+
+	slots, status, err := slotsFor(r, db, logger)
+	if err != nil {
+		return nil, status, err
+	}
+
+	var available []repositories.AvailableSlot
+	now := time.Now()
+	for day := 0; day < days; day++ {
+		date := now.AddDate(0, 0, day)
+		for _, slot := range slots.DeliverySlots {
+			if slot.Weekday != int(date.Weekday()) || slotHasStarted(slot, date.Format(repositories.DeliveryDateLayout), now) {
+				continue
+			}
+
+			booked, err := db.GetSlotBookings(slot.ID, date.Format(repositories.DeliveryDateLayout))
+			if err != nil {
+				logger.Printf("Internal error: %s", err.Error())
+				return nil, http.StatusInternalServerError, errors.New("could not get delivery slot bookings")
+			}
+			if booked >= slot.Capacity {
+				continue
+			}
+
+			available = append(available, repositories.AvailableSlot{
+				SlotID:           slot.ID,
+				DeliveryZoneID:   slot.DeliveryZoneID,
+				PickupLocationID: slot.PickupLocationID,
+				Date:             date.Format(repositories.DeliveryDateLayout),
+				StartTime:        slot.StartTime,
+				EndTime:          slot.EndTime,
+				Capacity:         slot.Capacity,
+				Available:        slot.Capacity - booked,
+			})
+		}
+	}
+
+	response, err := json.Marshal(repositories.AvailableSlotsJSON{AvailableSlots: available})
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("could not marshal available delivery slots response json")
+	}
+
+	return response, http.StatusOK, nil
+}
+
+func reserveDeliverySlot(r *http.Request, db datasources.DBClient, ttl time.Duration, logger *log.Logger) ([]byte, int, error) {
+	var reservation repositories.SlotReservation
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &reservation)
+	}
+	if err != nil || reservation.SlotID < 1 || len(reservation.Email) < 1 {
+		return nil, http.StatusBadRequest, errors.New("slot reservation sent on request body does not match required format")
+	}
+
+	date, err := time.ParseInLocation(repositories.DeliveryDateLayout, reservation.Date, time.Local)
+	if err != nil {
+		return nil, http.StatusBadRequest, errors.New("the reservation date must have the format YYYY-MM-DD")
+	}
+
+	slot, err := db.GetDeliverySlot(reservation.SlotID)
+	if err != nil {
+		return nil, http.StatusNotFound, err
+	}
+
+	now := time.Now()
+	lastDate := now.AddDate(0, 0, maxSlotDays)
+	if slot.Weekday != int(date.Weekday()) || slotHasStarted(slot, reservation.Date, now) || date.After(lastDate) {
+		return nil, http.StatusBadRequest, errors.New("the delivery slot is not available on the date provided")
+	}
+
+	reservation, err = db.ReserveDeliverySlot(reservation, ttl)
+	if err == datasources.ErrSlotFull {
+		return nil, http.StatusConflict, err
+	}
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, http.StatusInternalServerError, errors.New("could not reserve Delivery Slot")
+	}
+
+	response, err := json.Marshal(reservation)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("could not marshal slot reservation response json")
+	}
+
+	return response, http.StatusOK, nil
+}
+
+func resolveDeliverySlot(order repositories.Order, db datasources.DBClient, logger *log.Logger) (repositories.Order, int, error) {
+	order.DeliverySlot = nil
+	if order.SlotReservationID == 0 {
+		return order, http.StatusOK, nil
+	}
+
+	reservation, err := db.GetSlotReservation(order.SlotReservationID)
+	if err == datasources.ErrSlotReservationInvalid {
+		return order, http.StatusBadRequest, err
+	}
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return order, http.StatusInternalServerError, errors.New("could not get Slot Reservation")
+	}
+
+	expired := int64(reservation.ExpiresTimestamp) <= time.Now().Unix()
+	if reservation.OrderID != 0 || expired || reservation.Email != order.Email {
+		return order, http.StatusBadRequest, datasources.ErrSlotReservationInvalid
+	}
+
+	slot, err := db.GetDeliverySlot(reservation.SlotID)
+	if err != nil {
+		return order, http.StatusBadRequest, err
+	}
+	if order.FulfilmentType == repositories.PickupFulfilment && slot.PickupLocationID != order.PickupLocationID {
+		return order, http.StatusBadRequest, errors.New("the reserved slot does not belong to the pickup location")
+	}
+	if order.FulfilmentType != repositories.PickupFulfilment && (slot.DeliveryZoneID == 0 || slot.DeliveryZoneID != order.DeliveryZoneID) {
+		return order, http.StatusBadRequest, errors.New("the reserved delivery slot does not cover the shipping address")
+	}
+
+	order.DeliverySlot = &repositories.BookedSlot{
+		SlotID:    slot.ID,
+		Date:      reservation.Date,
+		StartTime: slot.StartTime,
+		EndTime:   slot.EndTime,
+	}
+
+	return order, http.StatusOK, nil
+}
+
+func slotHasStarted(slot repositories.DeliverySlot, date string, now time.Time) bool {
+	start, err := time.ParseInLocation(repositories.DeliveryDateLayout+" 15:04", date+" "+slot.StartTime, time.Local)
+	if err != nil {
+		return true
+	}
+
+	return !start.After(now)
+}
+
+// slotsFor lists the slots of the delivery zone or of the pickup location
+// given as query parameter.
+func slotsFor(r *http.Request, db datasources.DBClient, logger *log.Logger) (repositories.DeliverySlotsJSON, int, error) {
+	var slots repositories.DeliverySlotsJSON
+
+	name := "deliveryZoneID"
+	params, ok := r.URL.Query()[name]
+	if !ok || len(params[0]) < 1 {
+		name = "pickupLocationID"
+		params, ok = r.URL.Query()[name]
+	}
+	if !ok || len(params[0]) < 1 {
+		return slots, http.StatusBadRequest, errors.New("mandatory parameter 'deliveryZoneID' or 'pickupLocationID' not found")
+	}
+
+	id, err := strconv.Atoi(params[0])
+	if err != nil {
+		return slots, http.StatusBadRequest, fmt.Errorf("could not convert parameter '%s' to integer", name)
+	}
+
+	if name == "pickupLocationID" {
+		slots, err = db.GetPickupSlots(id)
+	} else {
+		slots, err = db.GetDeliverySlots(id)
+	}
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return slots, http.StatusInternalServerError, errors.New("could not get delivery slots")
+	}
+
+	return slots, http.StatusOK, nil
+}
+
+func isDeliverySlotValid(slot repositories.DeliverySlot) bool {
+	return (slot.DeliveryZoneID > 0) != (slot.PickupLocationID > 0) && slot.Weekday >= 0 && slot.Weekday <= 6 && slot.Capacity > 0 &&
+		slotTimePattern.MatchString(slot.StartTime) && slotTimePattern.MatchString(slot.EndTime) &&
+		slot.StartTime < slot.EndTime
+}
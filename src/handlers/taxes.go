@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/mariacalinoiu/smartket/src/datasources"
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+func HandleTaxClasses(w http.ResponseWriter, r *http.Request, db datasources.DBClient, logger *log.Logger) {
+	var response []byte
+	var status int
+	var err error
+
+	switch r.Method {
+	case http.MethodGet:
+		response, status, err = getTaxClasses(db, logger)
+	case http.MethodPost, http.MethodPut:
+		response, status, err = insertTaxClass(r, db, logger, r.Method == http.MethodPut)
+	case http.MethodDelete:
+		status, err = deleteTaxClass(r, db, logger)
+	default:
+		status = http.StatusBadRequest
+		err = errors.New("wrong method type for /tax-classes route")
+	}
+
+	if err != nil {
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	_, err = w.Write(response)
+	if err != nil {
+		status = http.StatusInternalServerError
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	status = http.StatusOK
+	logger.Printf("Status: %d %s", status, http.StatusText(status))
+}
+
+func HandleTaxClassAssignments(w http.ResponseWriter, r *http.Request, db datasources.DBClient, logger *log.Logger) {
+	var status int
+	var err error
+
+	switch r.Method {
+	case http.MethodPost:
+		status, err = assignTaxClass(r, db, logger)
+	default:
+		status = http.StatusBadRequest
+		err = errors.New("wrong method type for /tax-classes/assignments route")
+	}
+
+	if err != nil {
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	_, err = w.Write([]byte("assigned tax class"))
+	if err != nil {
+		status = http.StatusInternalServerError
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	status = http.StatusOK
+	logger.Printf("Status: %d %s", status, http.StatusText(status))
+}
+
+func getTaxClasses(db datasources.DBClient, logger *log.Logger) ([]byte, int, error) {
+	taxClasses, err := db.GetTaxClasses()
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, http.StatusInternalServerError, errors.New("could not get tax classes")
+	}
+
+	response, err := json.Marshal(taxClasses)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("could not marshal tax classes response json")
+	}
+
+	return response, http.StatusOK, nil
+}
+
+func insertTaxClass(r *http.Request, db datasources.DBClient, logger *log.Logger, update bool) ([]byte, int, error) {
+	var taxClass repositories.TaxClass
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &taxClass)
+	}
+	if err != nil || len(taxClass.Name) < 1 || taxClass.Rate < 0 || taxClass.Rate >= 100 {
+		return nil, http.StatusBadRequest, errors.New("tax class information sent on request body does not match required format")
+	}
+
+	taxClassID := repositories.TaxClassIDResponse{TaxClassID: taxClass.ID}
+	var before interface{}
+	operation := repositories.CreateOperation
+	if update {
+		taxClasses, getErr := db.GetTaxClasses(taxClass.ID)
+		if getErr != nil || len(taxClasses.TaxClasses) != 1 {
+			return nil, http.StatusNotFound, errors.New("the tax class provided does not exist")
+		}
+		before = taxClasses.TaxClasses[0]
+		operation = repositories.UpdateOperation
+		err = db.EditTaxClass(taxClass)
+	} else {
+		taxClassID, err = db.InsertTaxClass(taxClass)
+		taxClass.ID = taxClassID.TaxClassID
+	}
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, http.StatusInternalServerError, errors.New("could not save Tax Class")
+	}
+	recordAudit(r, db, logger, repositories.TaxClassEntity, taxClass.ID, operation, before, taxClass)
+
+	response, err := json.Marshal(taxClassID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("could not marshal taxClassID response json")
+	}
+
+	return response, http.StatusOK, nil
+}
+
+func deleteTaxClass(r *http.Request, db datasources.DBClient, logger *log.Logger) (int, error) {
+	params, ok := r.URL.Query()["taxClassID"]
+
+	if !ok || len(params[0]) < 1 {
+		return http.StatusBadRequest, errors.New("mandatory parameter 'taxClassID' not found")
+	}
+
+	taxClassID, err := strconv.Atoi(params[0])
+	if err != nil {
+		return http.StatusBadRequest, errors.New("could not convert parameter 'taxClassID' to integer")
+	}
+
+	taxClasses, err := db.GetTaxClasses(taxClassID)
+	if err != nil || len(taxClasses.TaxClasses) != 1 {
+		return http.StatusNotFound, errors.New("the tax class provided does not exist")
+	}
+	err = db.DeleteTaxClass(taxClassID)
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return http.StatusInternalServerError, errors.New("could not delete Tax Class")
+	}
+	recordAudit(r, db, logger, repositories.TaxClassEntity, taxClassID, repositories.DeleteOperation, taxClasses.TaxClasses[0], nil)
+
+	return http.StatusOK, nil
+}
+
+func assignTaxClass(r *http.Request, db datasources.DBClient, logger *log.Logger) (int, error) {
+	var assignment repositories.TaxClassAssignment
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &assignment)
+	}
+	if err != nil || (assignment.CategoryID > 0) == (assignment.ProductID > 0) || assignment.TaxClassID < 0 {
+		return http.StatusBadRequest, errors.New("tax class assignment sent on request body must have a taxClassID and either a categoryID or a productID")
+	}
+
+	if assignment.TaxClassID > 0 {
+		taxClasses, getErr := db.GetTaxClasses(assignment.TaxClassID)
+		if getErr != nil || len(taxClasses.TaxClasses) != 1 {
+			return http.StatusBadRequest, errors.New("the tax class provided does not exist")
+		}
+	}
+
+	err = db.AssignTaxClass(assignment)
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return http.StatusInternalServerError, errors.New("could not assign Tax Class")
+	}
+
+	entity, entityID := repositories.CategoryEntity, assignment.CategoryID
+	if assignment.ProductID > 0 {
+		entity, entityID = repositories.ProductEntity, assignment.ProductID
+	}
+	recordAudit(r, db, logger, entity, entityID, repositories.UpdateOperation, nil, assignment)
+
+	return http.StatusOK, nil
+}
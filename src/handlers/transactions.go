@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/mariacalinoiu/smartket/src/datasources"
+)
+
+type contextKey string
+
+const (
+	actorKey contextKey = "actor"
+	auditKey contextKey = "audit"
+)
+
+var errRequestFailed = errors.New("the request failed")
+
+// auditState notes whether an audit entry of the request could not be saved,
+// so that its changes are rolled back with it.
+type auditState struct {
+	failed bool
+}
+
+// bufferedResponse holds the response back until the request's transaction
+// is committed.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (response *bufferedResponse) Header() http.Header {
+	return response.header
+}
+
+func (response *bufferedResponse) WriteHeader(status int) {
+	if response.status == 0 {
+		response.status = status
+	}
+}
+
+func (response *bufferedResponse) Write(body []byte) (int, error) {
+	if response.status == 0 {
+		response.status = http.StatusOK
+	}
+
+	return response.body.Write(body)
+}
+
+func (response *bufferedResponse) writeTo(w http.ResponseWriter) {
+	for name, values := range response.header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(response.status)
+	_, _ = w.Write(response.body.Bytes())
+}
+
+// WithActor authenticates the request as actor, who is then recorded in the
+// audit log for the changes it makes.
+func WithActor(r *http.Request, actor string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), actorKey, actor))
+}
+
+// Transactional runs the changes a request makes and their audit entries in
+// a single transaction. Nothing is kept when the handler fails with a server
+// error or an audit entry can not be saved, and the response is only sent
+// once the transaction is committed. GET and HEAD requests run as they are.
+func Transactional(db datasources.DBClient, logger *log.Logger, next func(w http.ResponseWriter, r *http.Request, db datasources.DBClient)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next(w, r, db)
+			return
+		}
+
+		state := &auditState{}
+		r = r.WithContext(context.WithValue(r.Context(), auditKey, state))
+		response := &bufferedResponse{header: make(http.Header)}
+
+		err := db.InTransaction(func(tx datasources.DBClient) error {
+			next(response, r, tx)
+			if response.status >= http.StatusInternalServerError || state.failed {
+				return errRequestFailed
+			}
+
+			return nil
+		})
+		if err != nil && (err != errRequestFailed || state.failed) {
+			status := http.StatusInternalServerError
+			logger.Printf("Internal error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+			http.Error(w, "could not save the changes", status)
+
+			return
+		}
+
+		response.writeTo(w)
+	}
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/mariacalinoiu/smartket/src/datasources"
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+// quantityLine is a line of an order or a cart along with the quantity asked
+// for it.
+type quantityLine struct {
+	productLine
+	quantity float32
+}
+
+func HandleOrderActualQuantities(w http.ResponseWriter, r *http.Request, db datasources.DBClient, logger *log.Logger) {
+	var response []byte
+	var status int
+	var err error
+
+	switch r.Method {
+	case http.MethodPost, http.MethodPut:
+		response, status, err = setActualQuantities(r, db, logger)
+	default:
+		status = http.StatusBadRequest
+		err = errors.New("wrong method type for /orders/weights route")
+	}
+
+	if err != nil {
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	_, err = w.Write(response)
+	if err != nil {
+		status = http.StatusInternalServerError
+		logger.Printf("Error: %s; Status: %d %s", err.Error(), status, http.StatusText(status))
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	status = http.StatusOK
+	logger.Printf("Status: %d %s", status, http.StatusText(status))
+}
+
+func setActualQuantities(r *http.Request, db datasources.DBClient, logger *log.Logger) ([]byte, int, error) {
+	var request repositories.ActualQuantitiesRequest
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &request)
+	}
+	if err != nil || !areActualQuantitiesValid(request) {
+		return nil, http.StatusBadRequest, errors.New("actual quantities sent on request body do not match required format")
+	}
+
+	before := orderSnapshot(db, request.OrderID)
+	active, status, err := orderPromotions(db, before, logger)
+	if err != nil {
+		return nil, status, err
+	}
+	err = db.SetActualQuantities(request.OrderID, request.Lines, active)
+	switch {
+	case err == datasources.ErrOrderNotFound, err == datasources.ErrOrderLineNotFound:
+		return nil, http.StatusNotFound, err
+	case err == datasources.ErrSoldByPiece:
+		return nil, http.StatusBadRequest, err
+	case err == datasources.ErrOrderNotEditable, err == datasources.ErrInvoiceAlreadyIssued:
+		return nil, http.StatusConflict, err
+	case errors.Is(err, datasources.ErrInsufficientStock):
+		return nil, http.StatusConflict, err
+	case err != nil:
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, http.StatusInternalServerError, errors.New("could not save actual quantities")
+	}
+
+	after := orderSnapshot(db, request.OrderID)
+	recordAudit(r, db, logger, repositories.OrderEntity, request.OrderID, repositories.UpdateOperation, before, after)
+
+	response, err := json.Marshal(after)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("could not marshal order response json")
+	}
+
+	return response, http.StatusOK, nil
+}
+
+func areActualQuantitiesValid(request repositories.ActualQuantitiesRequest) bool {
+	if request.OrderID < 1 || len(request.Lines) < 1 {
+		return false
+	}
+
+	for _, line := range request.Lines {
+		if line.ProductID < 1 || line.ActualQuantity <= 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func setProductUnit(r *http.Request, db datasources.DBClient, productID int, logger *log.Logger) (int, error) {
+	var unit repositories.ProductUnitRequest
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &unit)
+	}
+	if err != nil || !isProductUnitValid(unit) {
+		return http.StatusBadRequest, errors.New("product unit sent on request body does not match required format")
+	}
+
+	before, err := getProductByID(db, productID)
+	if err != nil {
+		return http.StatusNotFound, err
+	}
+
+	err = db.SetProductUnit(productID, unit)
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return http.StatusInternalServerError, errors.New("could not save Product unit")
+	}
+	recordAudit(r, db, logger, repositories.ProductEntity, productID, repositories.UpdateOperation, before, productSnapshot(db, productID))
+
+	return http.StatusOK, nil
+}
+
+// isProductUnitValid only lets products sold by weight or volume be ordered
+// in fractions.
+func isProductUnitValid(unit repositories.ProductUnitRequest) bool {
+	if unit.QuantityStep <= 0 || unit.MinQuantity <= 0 {
+		return false
+	}
+
+	switch unit.Unit {
+	case repositories.PieceUnit:
+		return isMultipleOf(unit.QuantityStep, 1) && isMultipleOf(unit.MinQuantity, 1)
+	case repositories.KilogramUnit, repositories.LitreUnit:
+		return true
+	}
+
+	return false
+}
+
+// checkQuantity requires quantities of at least the product's minimum, in
+// steps of its quantity step. A quantity of 0, which removes an order line,
+// is always allowed.
+func checkQuantity(product repositories.Product, quantity float32) error {
+	step, minQuantity := product.QuantityStep, product.MinQuantity
+	if step <= 0 {
+		step = 1
+	}
+	if minQuantity <= 0 {
+		minQuantity = step
+	}
+
+	if quantity == 0 || (quantity >= minQuantity && isMultipleOf(quantity, step)) {
+		return nil
+	}
+
+	return fmt.Errorf(
+		"the product %d is sold in steps of %s, starting from %s",
+		product.ID,
+		quantityWithUnit(step, product.Unit),
+		quantityWithUnit(minQuantity, product.Unit),
+	)
+}
+
+// isMultipleOf tolerates the rounding errors of quantities such as 0.1 kg.
+func isMultipleOf(quantity float32, step float32) bool {
+	steps := float64(quantity) / float64(step)
+
+	return math.Abs(steps-math.Round(steps)) < 1e-4
+}
+
+func quantityWithUnit(quantity float32, unit string) string {
+	if len(unit) == 0 {
+		unit = repositories.PieceUnit
+	}
+
+	return strconv.FormatFloat(float64(quantity), 'f', -1, 32) + " " + unit
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mariacalinoiu/smartket/src/datasources"
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+// productLine identifies a line of an order, a cart or a refund: the same
+// product may appear once per variant.
+type productLine struct {
+	productID int
+	variantID int
+}
+
+func insertVariant(r *http.Request, db datasources.DBClient, productID int, logger *log.Logger, update bool) ([]byte, int, error) {
+	var variant repositories.ProductVariant
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &variant)
+	}
+	if err != nil || !isVariantValid(variant) {
+		return nil, http.StatusBadRequest, errors.New("variant information sent on request body does not match required format")
+	}
+	variant.ProductID = productID
+
+	if _, err = getProductByID(db, productID); err != nil {
+		return nil, http.StatusNotFound, err
+	}
+
+	siblings, err := db.GetProductVariants(productID)
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, http.StatusInternalServerError, errors.New("could not get product variants")
+	}
+
+	var before interface{}
+	for _, sibling := range siblings {
+		if update && sibling.ID == variant.ID {
+			before = sibling
+		}
+	}
+	if update && before == nil {
+		return nil, http.StatusNotFound, errors.New("the variant provided does not exist for this product")
+	}
+
+	err = checkVariantOptions(variant, siblings)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	variantID := repositories.ProductVariantIDResponse{VariantID: variant.ID}
+	operation := repositories.CreateOperation
+	if update {
+		operation = repositories.UpdateOperation
+		err = db.EditProductVariant(variant)
+	} else {
+		variantID, err = db.InsertProductVariant(variant)
+		variant.ID = variantID.VariantID
+	}
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return nil, http.StatusInternalServerError, errors.New("could not save Product variant")
+	}
+	recordAudit(r, db, logger, repositories.ProductVariantEntity, variant.ID, operation, before, variant)
+
+	response, err := json.Marshal(variantID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("could not marshal variantID response json")
+	}
+
+	return response, http.StatusOK, nil
+}
+
+func deleteVariant(r *http.Request, db datasources.DBClient, productID int, logger *log.Logger) (int, error) {
+	params, ok := r.URL.Query()["variantID"]
+
+	if !ok || len(params[0]) < 1 {
+		return http.StatusBadRequest, errors.New("mandatory parameter 'variantID' not found")
+	}
+
+	variantID, err := strconv.Atoi(params[0])
+	if err != nil {
+		return http.StatusBadRequest, errors.New("could not convert parameter 'variantID' to integer")
+	}
+
+	variants, err := db.GetProductVariant(variantID)
+	if err != nil || len(variants) != 1 || variants[0].ProductID != productID {
+		return http.StatusNotFound, errors.New("the variant provided does not exist for this product")
+	}
+
+	err = db.DeleteProductVariant(variantID)
+	if err == datasources.ErrVariantInUse {
+		return http.StatusConflict, err
+	}
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return http.StatusInternalServerError, errors.New("could not delete Product variant")
+	}
+	recordAudit(r, db, logger, repositories.ProductVariantEntity, variantID, repositories.DeleteOperation, variants[0], nil)
+
+	return http.StatusOK, nil
+}
+
+func isVariantValid(variant repositories.ProductVariant) bool {
+	if len(variant.SKU) < 1 || len(variant.SKU) > 255 || len(variant.Barcode) > 255 || variant.Price <= 0 ||
+		variant.Stock < 0 || len(variant.Options) < 1 {
+		return false
+	}
+
+	for name, value := range variant.Options {
+		if len(strings.TrimSpace(name)) < 1 || len(strings.TrimSpace(value)) < 1 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// checkVariantOptions makes sure all the variants of a product differ by the
+// same option dimensions, and never by none of them.
+func checkVariantOptions(variant repositories.ProductVariant, siblings []repositories.ProductVariant) error {
+	for _, sibling := range siblings {
+		if sibling.ID == variant.ID {
+			continue
+		}
+		if optionNames(sibling) != optionNames(variant) {
+			return fmt.Errorf("the variants of this product are defined by the options: %s", optionNames(sibling))
+		}
+		if optionValues(sibling) == optionValues(variant) {
+			return fmt.Errorf("the variant %d already has these options", sibling.ID)
+		}
+	}
+
+	return nil
+}
+
+func optionNames(variant repositories.ProductVariant) string {
+	var names []string
+	for name := range variant.Options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return strings.Join(names, ", ")
+}
+
+func optionValues(variant repositories.ProductVariant) string {
+	var values []string
+	for name, value := range variant.Options {
+		values = append(values, name+"="+value)
+	}
+	sort.Strings(values)
+
+	return strings.Join(values, "\x00")
+}
+
+// checkProductLines requires a variant of its own product on every line of a
+// product that has variants, and none on the lines of products without. The
+// quantities must also be ones the products are sold in.
+func checkProductLines(db datasources.DBClient, lines []quantityLine, logger *log.Logger) (int, error) {
+	var productIDs []int
+	for _, line := range lines {
+		productIDs = append(productIDs, line.productID)
+	}
+
+	products, err := db.GetProductsByIDs(productIDs...)
+	if err != nil {
+		logger.Printf("Internal error: %s", err.Error())
+		return http.StatusInternalServerError, errors.New("could not get ordered products")
+	}
+
+	byID := make(map[int]repositories.Product)
+	for _, product := range products.Products {
+		byID[product.ID] = product
+	}
+
+	for _, line := range lines {
+		product, ok := byID[line.productID]
+		if !ok {
+			return http.StatusBadRequest, fmt.Errorf("the product %d does not exist", line.productID)
+		}
+
+		if len(product.Variants) == 0 {
+			if line.variantID != 0 {
+				return http.StatusBadRequest, fmt.Errorf("the product %d has no variants", line.productID)
+			}
+		} else {
+			found := false
+			for _, variant := range product.Variants {
+				found = found || variant.ID == line.variantID
+			}
+			if !found {
+				return http.StatusBadRequest, fmt.Errorf("the product %d must be ordered as one of its variants", line.productID)
+			}
+		}
+
+		err = checkQuantity(product, line.quantity)
+		if err != nil {
+			return http.StatusBadRequest, err
+		}
+	}
+
+	return http.StatusOK, nil
+}
+
+func orderedLines(products []repositories.OrderedProduct) []quantityLine {
+	var lines []quantityLine
+	for _, product := range products {
+		lines = append(lines, quantityLine{
+			productLine: productLine{productID: product.ProductID, variantID: product.VariantID},
+			quantity:    product.Quantity,
+		})
+	}
+
+	return lines
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+func etagFor(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+func versionFromIfMatch(r *http.Request) (int, error) {
+	ifMatch := strings.TrimSpace(r.Header.Get("If-Match"))
+	if len(ifMatch) == 0 {
+		return 0, errors.New("mandatory header 'If-Match' not found")
+	}
+
+	version, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(ifMatch, "W/"), `"`))
+	if err != nil {
+		return 0, errors.New("could not convert header 'If-Match' to a version")
+	}
+
+	return version, nil
+}
+
+func writePreconditionFailed(w http.ResponseWriter, current []byte) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusPreconditionFailed)
+	_, err := w.Write(current)
+
+	return err
+}
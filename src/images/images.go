@@ -0,0 +1,159 @@
+package images
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+const (
+	DefaultMaxSize = 5 << 20
+	URLPrefix      = "/images/"
+
+	// maxPixels keeps a small file that decodes to a huge picture from
+	// exhausting memory.
+	maxPixels   = 40000000
+	jpegQuality = 85
+)
+
+var (
+	ErrUnsupportedType = errors.New("the image must be a JPEG, PNG or GIF file")
+	ErrTooLarge        = errors.New("the image is too large")
+)
+
+// Thumbnail is a standard size uploads are scaled down to, so that they fit
+// in a square of Side pixels.
+type Thumbnail struct {
+	Name string
+	Side int
+}
+
+var Thumbnails = []Thumbnail{
+	{"small", 160},
+	{"medium", 480},
+	{"large", 1024},
+}
+
+var (
+	extensions = map[string]string{
+		"image/jpeg": "jpg",
+		"image/png":  "png",
+		"image/gif":  "gif",
+	}
+	contentTypes = map[string]string{
+		"jpg": "image/jpeg",
+		"png": "image/png",
+		"gif": "image/gif",
+	}
+	validName = regexp.MustCompile(`^[0-9a-f]{32}(-[a-z]+)?\.(jpg|png|gif)$`)
+)
+
+// Store validates uploads and keeps them, with their thumbnails, under names
+// derived from their content: a name always refers to the same bytes, which
+// lets clients cache them for good.
+type Store struct {
+	storage Storage
+	maxSize int
+}
+
+func NewStore(storage Storage, maxSize int) *Store {
+	return &Store{storage: storage, maxSize: maxSize}
+}
+
+func (store *Store) MaxSize() int {
+	return store.maxSize
+}
+
+func (store *Store) Upload(content []byte) (repositories.UploadedImage, error) {
+	if len(content) > store.maxSize {
+		return repositories.UploadedImage{}, fmt.Errorf("%w: the limit is %d bytes", ErrTooLarge, store.maxSize)
+	}
+
+	contentType := http.DetectContentType(content)
+	extension, ok := extensions[contentType]
+	if !ok {
+		return repositories.UploadedImage{}, ErrUnsupportedType
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return repositories.UploadedImage{}, ErrUnsupportedType
+	}
+	if config.Width*config.Height > maxPixels {
+		return repositories.UploadedImage{}, fmt.Errorf("%w: the limit is %d pixels", ErrTooLarge, maxPixels)
+	}
+
+	picture, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return repositories.UploadedImage{}, ErrUnsupportedType
+	}
+
+	sum := sha256.Sum256(content)
+	base := hex.EncodeToString(sum[:16])
+
+	uploaded := repositories.UploadedImage{
+		URL:         URLPrefix + base + "." + extension,
+		ContentType: contentType,
+		Size:        len(content),
+		Width:       config.Width,
+		Height:      config.Height,
+		Thumbnails:  make(map[string]string),
+	}
+
+	err = store.storage.Save(base+"."+extension, content)
+	if err != nil {
+		return uploaded, err
+	}
+
+	// Thumbnails of GIFs are stills, so they are kept as PNGs.
+	thumbnailExtension := extension
+	if extension == "gif" {
+		thumbnailExtension = "png"
+	}
+	for _, thumbnail := range Thumbnails {
+		var encoded bytes.Buffer
+		scaled := fit(picture, thumbnail.Side)
+		if thumbnailExtension == "jpg" {
+			err = jpeg.Encode(&encoded, scaled, &jpeg.Options{Quality: jpegQuality})
+		} else {
+			err = png.Encode(&encoded, scaled)
+		}
+		if err != nil {
+			return uploaded, err
+		}
+
+		name := base + "-" + thumbnail.Name + "." + thumbnailExtension
+		err = store.storage.Save(name, encoded.Bytes())
+		if err != nil {
+			return uploaded, err
+		}
+		uploaded.Thumbnails[thumbnail.Name] = URLPrefix + name
+	}
+
+	return uploaded, nil
+}
+
+// Open returns a stored image and its content type.
+func (store *Store) Open(name string) ([]byte, string, error) {
+	if !validName.MatchString(name) {
+		return nil, "", ErrNotFound
+	}
+
+	content, err := store.storage.Load(name)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return content, contentTypes[name[strings.LastIndex(name, ".")+1:]], nil
+}
@@ -0,0 +1,72 @@
+package images
+
+import (
+	"image"
+	"image/color"
+)
+
+// fit scales picture down, keeping its proportions, until it fits in a square
+// of side pixels; smaller pictures are returned as they are.
+func fit(picture image.Image, side int) image.Image {
+	bounds := picture.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= side && height <= side {
+		return picture
+	}
+
+	scaledWidth, scaledHeight := side, side
+	if width > height {
+		scaledHeight = max(1, height*side/width)
+	} else {
+		scaledWidth = max(1, width*side/height)
+	}
+
+	return scale(picture, scaledWidth, scaledHeight)
+}
+
+// scale averages the source pixels each target pixel covers, which keeps
+// downscaled pictures smooth without depending on an imaging library.
+func scale(picture image.Image, width int, height int) *image.NRGBA {
+	bounds := picture.Bounds()
+	scaled := image.NewNRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		top := bounds.Min.Y + y*bounds.Dy()/height
+		bottom := bounds.Min.Y + max(y*bounds.Dy()/height+1, (y+1)*bounds.Dy()/height)
+		for x := 0; x < width; x++ {
+			left := bounds.Min.X + x*bounds.Dx()/width
+			right := bounds.Min.X + max(x*bounds.Dx()/width+1, (x+1)*bounds.Dx()/width)
+
+			var r, g, b, a, count uint64
+			for sy := top; sy < bottom; sy++ {
+				for sx := left; sx < right; sx++ {
+					pr, pg, pb, pa := picture.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					count++
+				}
+			}
+
+			// The sums are alpha premultiplied; NRGBA wants them divided back out.
+			pixel := color.NRGBA{}
+			if a > 0 {
+				pixel = color.NRGBA{
+					R: uint8(r * 0xff / a),
+					G: uint8(g * 0xff / a),
+					B: uint8(b * 0xff / a),
+					A: uint8(a / count >> 8),
+				}
+			}
+			scaled.SetNRGBA(x, y, pixel)
+		}
+	}
+
+	return scaled
+}
+
+func max(a int, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
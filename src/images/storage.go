@@ -0,0 +1,63 @@
+package images
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+var ErrNotFound = errors.New("the image requested does not exist")
+
+// Storage keeps image files by name. The names are generated by the Store and
+// never contain path separators.
+type Storage interface {
+	Save(name string, content []byte) error
+	Load(name string) ([]byte, error)
+}
+
+type LocalStorage struct {
+	dir string
+}
+
+func NewLocalStorage(dir string) (LocalStorage, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return LocalStorage{}, err
+	}
+
+	return LocalStorage{dir: dir}, nil
+}
+
+// Save writes to a temporary file first, so that a file is never served
+// half written.
+func (storage LocalStorage) Save(name string, content []byte) error {
+	file, err := ioutil.TempFile(storage.dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.Write(content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	err = os.Chmod(file.Name(), 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), filepath.Join(storage.dir, name))
+}
+
+func (storage LocalStorage) Load(name string) ([]byte, error) {
+	content, err := ioutil.ReadFile(filepath.Join(storage.dir, name))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+
+	return content, err
+}
@@ -0,0 +1,172 @@
+package invoices
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sort"
+
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+type Config struct {
+	Issuer           repositories.Party `json:"issuer"`
+	InvoiceSeries    string             `json:"invoiceSeries"`
+	CreditNoteSeries string             `json:"creditNoteSeries"`
+	Currency         string             `json:"currency"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Issuer:           repositories.Party{Name: "Smartket"},
+		InvoiceSeries:    "SMK",
+		CreditNoteSeries: "SMKC",
+		Currency:         "RON",
+	}
+}
+
+// LoadConfig overrides the default invoicing settings with the ones in the JSON
+// file at path; settings missing from the file keep their defaults.
+func LoadConfig(path string) (Config, error) {
+	config := DefaultConfig()
+	if len(path) == 0 {
+		return config, nil
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	err = json.Unmarshal(content, &config)
+	if err != nil {
+		return Config{}, err
+	}
+	if len(config.InvoiceSeries) == 0 || len(config.CreditNoteSeries) == 0 || config.InvoiceSeries == config.CreditNoteSeries {
+		return Config{}, fmt.Errorf("invoices and credit notes need two different, non-empty series")
+	}
+
+	return config, nil
+}
+
+// NewInvoice bills the order lines at their discounted, VAT inclusive prices,
+// with the promotions spread over the units of their lines, plus shipping at
+// the VAT rate saved with the order. The series number is set when issuing.
+func NewInvoice(order repositories.Order, config Config) repositories.Invoice {
+	var lines []repositories.InvoiceLine
+	for _, product := range order.ProductsOrdered {
+		unitPrice := product.Product.Price
+		if product.Quantity > 0 {
+			unitPrice -= product.PromotionDiscount / product.Quantity
+		}
+		unitPrice = unitPrice * 100 / (100 + float32(order.DiscountPercentage))
+		line := newLine(product.Product.Name, product.Quantity, unitPrice, product.Product.VATRate)
+		line.Unit = product.Product.Unit
+		lines = append(lines, line)
+	}
+	if order.ShippingCost > 0 {
+		lines = append(lines, newLine("Transport", 1, order.ShippingCost, order.ShippingVATRate))
+	}
+
+	return summarize(repositories.Invoice{
+		Kind:     repositories.InvoiceDocument,
+		Series:   config.InvoiceSeries,
+		OrderID:  order.ID,
+		Issuer:   config.Issuer,
+		Buyer:    buyerOf(order),
+		Currency: config.Currency,
+		Lines:    lines,
+	})
+}
+
+// NewCreditNote reverses the refunded lines of invoice; whatever the refund
+// covers beyond them is spread over the invoice's VAT rates.
+func NewCreditNote(order repositories.Order, refund repositories.Refund, invoice repositories.Invoice, config Config) repositories.Invoice {
+	type line struct{ productID, variantID int }
+	ordered := make(map[line]repositories.OrderedProduct)
+	for _, product := range order.ProductsOrdered {
+		ordered[line{product.ProductID, product.VariantID}] = product
+	}
+
+	var lines []repositories.InvoiceLine
+	remaining := refund.Amount
+	for _, refunded := range refund.ProductsRefunded {
+		product := ordered[line{refunded.ProductID, refunded.VariantID}]
+		unitPrice := refunded.Amount / float32(refunded.Quantity)
+		creditLine := newLine(product.Product.Name, -refunded.Quantity, unitPrice, product.Product.VATRate)
+		creditLine.Unit = product.Product.Unit
+		lines = append(lines, creditLine)
+		remaining -= refunded.Amount
+	}
+
+	if remaining >= 0.005 && invoice.Total > 0 {
+		description := fmt.Sprintf("Refund: %s", refund.Reason)
+		for _, vatLine := range invoice.VATBreakdown {
+			lines = append(lines, newLine(description, -1, remaining*vatLine.Gross/invoice.Total, vatLine.Rate))
+		}
+	}
+
+	return summarize(repositories.Invoice{
+		Kind:          repositories.CreditNoteDocument,
+		Series:        config.CreditNoteSeries,
+		OrderID:       order.ID,
+		RefundID:      refund.ID,
+		InvoiceNumber: invoice.FullNumber,
+		Issuer:        invoice.Issuer,
+		Buyer:         invoice.Buyer,
+		Currency:      invoice.Currency,
+		Lines:         lines,
+	})
+}
+
+func newLine(description string, quantity float32, unitPrice float32, vatRate float32) repositories.InvoiceLine {
+	total := roundToCents(unitPrice * float32(quantity))
+	vat := roundToCents(total * vatRate / (100 + vatRate))
+
+	return repositories.InvoiceLine{
+		Description: description,
+		Quantity:    quantity,
+		UnitPrice:   roundToCents(unitPrice),
+		VATRate:     vatRate,
+		Net:         roundToCents(total - vat),
+		VAT:         vat,
+		Total:       total,
+	}
+}
+
+func summarize(invoice repositories.Invoice) repositories.Invoice {
+	byRate := make(map[float32]repositories.VATLine)
+	for _, line := range invoice.Lines {
+		vatLine := byRate[line.VATRate]
+		vatLine.Rate = line.VATRate
+		vatLine.Net = roundToCents(vatLine.Net + line.Net)
+		vatLine.VAT = roundToCents(vatLine.VAT + line.VAT)
+		vatLine.Gross = roundToCents(vatLine.Gross + line.Total)
+		byRate[line.VATRate] = vatLine
+
+		invoice.VATTotal = roundToCents(invoice.VATTotal + line.VAT)
+		invoice.Total = roundToCents(invoice.Total + line.Total)
+	}
+
+	invoice.VATBreakdown = nil
+	for _, vatLine := range byRate {
+		invoice.VATBreakdown = append(invoice.VATBreakdown, vatLine)
+	}
+	sort.Slice(invoice.VATBreakdown, func(i, j int) bool { return invoice.VATBreakdown[i].Rate > invoice.VATBreakdown[j].Rate })
+
+	return invoice
+}
+
+func buyerOf(order repositories.Order) repositories.Party {
+	return repositories.Party{
+		Name:        fmt.Sprintf("%s %s", order.FirstName, order.LastName),
+		Address:     fmt.Sprintf("%s, %s", order.Address, order.City),
+		Email:       order.Email,
+		PhoneNumber: order.PhoneNumber,
+	}
+}
+
+func roundToCents(value float32) float32 {
+	return float32(math.Round(float64(value)*100) / 100)
+}
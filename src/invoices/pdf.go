@@ -0,0 +1,187 @@
+package invoices
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+const (
+	pageWidth    = 595
+	pageHeight   = 842
+	margin       = 50
+	fontSize     = 9
+	leading      = 12
+	linesPerPage = (pageHeight - 2*margin) / leading
+)
+
+// diacritics outside WinAnsi, which is all the standard PDF fonts can encode.
+var diacritics = strings.NewReplacer("ă", "a", "Ă", "A", "ș", "s", "Ș", "S", "ş", "s", "Ş", "S", "ț", "t", "Ț", "T", "ţ", "t", "Ţ", "T")
+
+// RenderPDF lays the invoice out as plain monospaced text, which keeps the
+// columns aligned without embedding fonts.
+func RenderPDF(invoice repositories.Invoice) []byte {
+	return renderPages(paginate(textOf(invoice)))
+}
+
+func textOf(invoice repositories.Invoice) []string {
+	title := "INVOICE"
+	if invoice.Kind == repositories.CreditNoteDocument {
+		title = "CREDIT NOTE"
+	}
+
+	text := []string{
+		fmt.Sprintf("%s %s", title, invoice.FullNumber),
+		fmt.Sprintf("Date: %s", invoice.IssuedDate),
+		fmt.Sprintf("Order: %d", invoice.OrderID),
+	}
+	if len(invoice.InvoiceNumber) > 0 {
+		text = append(text, fmt.Sprintf("Corrects invoice: %s", invoice.InvoiceNumber))
+	}
+	text = append(text, "")
+	text = append(text, partyText("Issuer", invoice.Issuer)...)
+	text = append(text, "")
+	text = append(text, partyText("Buyer", invoice.Buyer)...)
+	text = append(text, "", fmt.Sprintf("%-40s %8s %10s %6s %10s %10s", "Description", "Qty", "Unit", "VAT %", "VAT", "Total"))
+	text = append(text, strings.Repeat("-", 89))
+
+	for _, line := range invoice.Lines {
+		text = append(text, fmt.Sprintf("%-40.40s %8s %10.2f %6.2f %10.2f %10.2f",
+			line.Description, quantityText(line), line.UnitPrice, line.VATRate, line.VAT, line.Total))
+	}
+
+	text = append(text, strings.Repeat("-", 89), "", fmt.Sprintf("%-20s %12s %12s %12s", "VAT rate", "Net", "VAT", "Gross"))
+	for _, vatLine := range invoice.VATBreakdown {
+		text = append(text, fmt.Sprintf("%-20s %12.2f %12.2f %12.2f", fmt.Sprintf("%.2f%%", vatLine.Rate), vatLine.Net, vatLine.VAT, vatLine.Gross))
+	}
+	text = append(text,
+		"",
+		fmt.Sprintf("Total VAT: %.2f %s", invoice.VATTotal, invoice.Currency),
+		fmt.Sprintf("Total:     %.2f %s", invoice.Total, invoice.Currency),
+	)
+
+	return text
+}
+
+func partyText(label string, party repositories.Party) []string {
+	text := []string{fmt.Sprintf("%s: %s", label, party.Name)}
+	details := []struct{ name, value string }{
+		{"Tax ID", party.TaxID},
+		{"Reg. no.", party.RegistrationNumber},
+		{"Address", party.Address},
+		{"Email", party.Email},
+		{"Phone", party.PhoneNumber},
+		{"IBAN", party.IBAN},
+	}
+	for _, detail := range details {
+		if len(detail.value) > 0 {
+			text = append(text, fmt.Sprintf("  %s: %s", detail.name, detail.value))
+		}
+	}
+
+	return text
+}
+
+func paginate(text []string) [][]string {
+	var pages [][]string
+	for len(text) > linesPerPage {
+		pages = append(pages, text[:linesPerPage])
+		text = text[linesPerPage:]
+	}
+
+	return append(pages, text)
+}
+
+func renderPages(pages [][]string) []byte {
+	var out bytes.Buffer
+	var offsets []int
+
+	startObject := func() int {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n", len(offsets))
+
+		return len(offsets)
+	}
+
+	out.WriteString("%PDF-1.4\n")
+
+	startObject()
+	out.WriteString("<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+
+	// page i uses objects 4+2i (page) and 5+2i (content stream)
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+	startObject()
+	fmt.Fprintf(&out, "<< /Type /Pages /Kids [%s] /Count %d >>\nendobj\n", strings.Join(kids, " "), len(pages))
+
+	startObject()
+	out.WriteString("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>\nendobj\n")
+
+	for _, page := range pages {
+		content := pageContent(page)
+
+		pageObject := startObject()
+		fmt.Fprintf(&out, "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>\nendobj\n",
+			pageWidth, pageHeight, pageObject+1)
+
+		startObject()
+		fmt.Fprintf(&out, "<< /Length %d >>\nstream\n%s\nendstream\nendobj\n", len(content), content)
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return out.Bytes()
+}
+
+func pageContent(lines []string) []byte {
+	var content bytes.Buffer
+
+	fmt.Fprintf(&content, "BT\n/F1 %d Tf\n%d TL\n%d %d Td\n", fontSize, leading, margin, pageHeight-margin)
+	for _, line := range lines {
+		content.WriteByte('(')
+		content.Write(encodeText(line))
+		content.WriteString(") Tj T*\n")
+	}
+	content.WriteString("ET")
+
+	return content.Bytes()
+}
+
+// encodeText converts to Latin-1 (which matches WinAnsi for letters) and
+// escapes the characters PDF strings reserve.
+func encodeText(line string) []byte {
+	var encoded []byte
+	for _, r := range diacritics.Replace(line) {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			encoded = append(encoded, '\\', byte(r))
+		case r < 256:
+			encoded = append(encoded, byte(r))
+		default:
+			encoded = append(encoded, '?')
+		}
+	}
+
+	return encoded
+}
+
+// quantityText shows the quantity of a line along with its unit, unless it
+// is sold by the piece.
+func quantityText(line repositories.InvoiceLine) string {
+	quantity := strconv.FormatFloat(float64(line.Quantity), 'f', -1, 32)
+	if len(line.Unit) == 0 || line.Unit == repositories.PieceUnit {
+		return quantity
+	}
+
+	return quantity + " " + line.Unit
+}
@@ -0,0 +1,46 @@
+package notifiers
+
+import (
+	"log"
+	"os"
+)
+
+type (
+	Notification struct {
+		Email   string
+		Subject string
+		Body    string
+	}
+
+	Notifier interface {
+		Notify(notification Notification) error
+	}
+
+	LogNotifier struct {
+		logger *log.Logger
+	}
+)
+
+func NewLogNotifier(logger *log.Logger) LogNotifier {
+	return LogNotifier{logger: logger}
+}
+
+func NewFileNotifier(path string) (LogNotifier, *os.File, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return LogNotifier{}, nil, err
+	}
+
+	return LogNotifier{logger: log.New(file, "", log.LstdFlags)}, file, nil
+}
+
+func (notifier LogNotifier) Notify(notification Notification) error {
+	notifier.logger.Printf(
+		"To: %s; Subject: %s; Body: %s",
+		notification.Email,
+		notification.Subject,
+		notification.Body,
+	)
+
+	return nil
+}
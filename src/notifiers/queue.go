@@ -0,0 +1,53 @@
+package notifiers
+
+import (
+	"log"
+)
+
+type Queue struct {
+	notifier      Notifier
+	notifications chan queued
+	logger        *log.Logger
+}
+
+type queued struct {
+	notification Notification
+	sent         func()
+}
+
+func NewQueue(notifier Notifier, size int, logger *log.Logger) *Queue {
+	return &Queue{
+		notifier:      notifier,
+		notifications: make(chan queued, size),
+		logger:        logger,
+	}
+}
+
+// Enqueue queues the notification unless the queue is full; sent, when not
+// nil, is called once the notification actually went out.
+func (queue *Queue) Enqueue(notification Notification, sent func()) bool {
+	select {
+	case queue.notifications <- queued{notification: notification, sent: sent}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (queue *Queue) Run(stop <-chan struct{}) {
+	for {
+		select {
+		case next := <-queue.notifications:
+			err := queue.notifier.Notify(next.notification)
+			if err != nil {
+				queue.logger.Printf("Notification error: %s; Email: %s", err.Error(), next.notification.Email)
+				continue
+			}
+			if next.sent != nil {
+				next.sent()
+			}
+		case <-stop:
+			return
+		}
+	}
+}
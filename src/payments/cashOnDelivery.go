@@ -0,0 +1,41 @@
+package payments
+
+import (
+	"errors"
+	"fmt"
+)
+
+type CashOnDeliveryProvider struct{}
+
+func NewCashOnDeliveryProvider() CashOnDeliveryProvider {
+	return CashOnDeliveryProvider{}
+}
+
+func (provider CashOnDeliveryProvider) Authorize(reference string, amount float32) (Result, error) {
+	if amount <= 0 {
+		return Result{}, errors.New("the amount to authorize must be positive")
+	}
+
+	return Result{TransactionID: fmt.Sprintf("cod-%s", reference), Status: StatusAuthorized}, nil
+}
+
+func (provider CashOnDeliveryProvider) Capture(transaction Transaction, amount float32) (Result, error) {
+	return Result{TransactionID: transaction.ID, Status: StatusCaptured}, nil
+}
+
+// Refund only hands back what the courier collected.
+func (provider CashOnDeliveryProvider) Refund(transaction Transaction, amount float32) (Result, error) {
+	err := expectStatus(transaction, StatusCaptured)
+	if err != nil {
+		return Result{}, err
+	}
+	if transaction.Refunded+amount > transaction.Captured {
+		return Result{}, errors.New("cannot refund more than the collected amount")
+	}
+
+	return Result{TransactionID: transaction.ID, Status: StatusRefunded}, nil
+}
+
+func (provider CashOnDeliveryProvider) Void(transaction Transaction) (Result, error) {
+	return Result{TransactionID: transaction.ID, Status: StatusVoided}, nil
+}
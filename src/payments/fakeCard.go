@@ -0,0 +1,65 @@
+package payments
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+type FakeCardProvider struct{}
+
+// NewFakeCardProvider returns a card gateway that never leaves the process.
+// It keeps no state of its own: the transactions are checked against the
+// payments recorded for the order, so they survive restarts.
+// Amounts ending in .51 are declined, so tests can exercise the failure path.
+func NewFakeCardProvider() FakeCardProvider {
+	return FakeCardProvider{}
+}
+
+func (provider FakeCardProvider) Authorize(reference string, amount float32) (Result, error) {
+	if amount <= 0 {
+		return Result{}, errors.New("the amount to authorize must be positive")
+	}
+
+	transactionID := fmt.Sprintf("fake-%s-%d", reference, time.Now().UnixNano())
+
+	if int(math.Round(float64(amount)*100))%100 == 51 {
+		return Result{TransactionID: transactionID, Status: StatusDeclined}, ErrDeclined
+	}
+
+	return Result{TransactionID: transactionID, Status: StatusAuthorized}, nil
+}
+
+func (provider FakeCardProvider) Capture(transaction Transaction, amount float32) (Result, error) {
+	err := expectStatus(transaction, StatusAuthorized)
+	if err != nil {
+		return Result{}, err
+	}
+	if amount > transaction.Authorized {
+		return Result{}, errors.New("cannot capture more than the authorized amount")
+	}
+
+	return Result{TransactionID: transaction.ID, Status: StatusCaptured}, nil
+}
+
+func (provider FakeCardProvider) Refund(transaction Transaction, amount float32) (Result, error) {
+	err := expectStatus(transaction, StatusCaptured)
+	if err != nil {
+		return Result{}, err
+	}
+	if transaction.Refunded+amount > transaction.Captured {
+		return Result{}, errors.New("cannot refund more than the captured amount")
+	}
+
+	return Result{TransactionID: transaction.ID, Status: StatusRefunded}, nil
+}
+
+func (provider FakeCardProvider) Void(transaction Transaction) (Result, error) {
+	err := expectStatus(transaction, StatusAuthorized)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{TransactionID: transaction.ID, Status: StatusVoided}, nil
+}
@@ -0,0 +1,76 @@
+package payments
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	StatusAuthorized = "authorized"
+	StatusCaptured   = "captured"
+	StatusRefunded   = "refunded"
+	StatusVoided     = "voided"
+	StatusDeclined   = "declined"
+)
+
+const (
+	OperationAuthorize = "authorize"
+	OperationCapture   = "capture"
+	OperationRefund    = "refund"
+	OperationVoid      = "void"
+)
+
+var ErrDeclined = errors.New("the payment was declined by the provider")
+
+type (
+	Result struct {
+		TransactionID string
+		Status        string
+	}
+
+	// Transaction is the state of an authorization, as recorded in the
+	// payments of its order.
+	Transaction struct {
+		ID         string
+		Status     string
+		Authorized float32
+		Captured   float32
+		Refunded   float32
+	}
+
+	Provider interface {
+		Authorize(reference string, amount float32) (Result, error)
+		Capture(transaction Transaction, amount float32) (Result, error)
+		Refund(transaction Transaction, amount float32) (Result, error)
+		Void(transaction Transaction) (Result, error)
+	}
+
+	Registry map[string]Provider
+)
+
+func NewRegistry() Registry {
+	return Registry{
+		"card": NewFakeCardProvider(),
+		"cash": NewCashOnDeliveryProvider(),
+	}
+}
+
+func (registry Registry) Get(paymentMethod string) (Provider, error) {
+	provider, ok := registry[paymentMethod]
+	if !ok {
+		return nil, fmt.Errorf("no payment provider for payment method '%s'", paymentMethod)
+	}
+
+	return provider, nil
+}
+
+func expectStatus(transaction Transaction, status string) error {
+	if len(transaction.ID) == 0 {
+		return errors.New("unknown transaction")
+	}
+	if transaction.Status != status {
+		return fmt.Errorf("transaction '%s' is %s, expected %s", transaction.ID, transaction.Status, status)
+	}
+
+	return nil
+}
@@ -0,0 +1,252 @@
+package promotions
+
+import (
+	"math"
+	"sort"
+
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+// Line is an order line as the promotions see it: CategoryIDs holds the
+// product's category along with all the categories above it.
+type Line struct {
+	ProductID   int
+	CategoryIDs []int
+	UnitPrice   float32
+	Quantity    float32
+}
+
+// Discount is what the promotions took off a line, in total and by promotion.
+type Discount struct {
+	Total   float32
+	Applied []repositories.AppliedPromotion
+}
+
+type lineState struct {
+	remaining float32
+	promoted  bool
+	exclusive bool
+}
+
+// Apply evaluates the promotions against the lines, by descending priority.
+// Each promotion works on what is left of the lines after the ones before it,
+// so a discount never takes a line below zero.
+func Apply(lines []Line, promotions []repositories.Promotion) []Discount {
+	discounts := make([]Discount, len(lines))
+	states := make([]lineState, len(lines))
+	for i, line := range lines {
+		states[i].remaining = line.UnitPrice * line.Quantity
+	}
+
+	sorted := append([]repositories.Promotion{}, promotions...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Priority != sorted[j].Priority {
+			return sorted[i].Priority > sorted[j].Priority
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+
+	for _, promotion := range sorted {
+		var eligible []int
+		for i, line := range lines {
+			if states[i].exclusive || (states[i].promoted && !promotion.Stackable) || states[i].remaining <= 0 {
+				continue
+			}
+			if matches(promotion, line) {
+				eligible = append(eligible, i)
+			}
+		}
+		if len(eligible) == 0 {
+			continue
+		}
+
+		var amounts []float32
+		switch promotion.Type {
+		case repositories.BuyXGetYPromotion:
+			amounts = buyXGetY(promotion, lines, eligible)
+		case repositories.CategoryPercentagePromotion:
+			amounts = make([]float32, len(lines))
+			for _, i := range eligible {
+				amounts[i] = states[i].remaining * promotion.Percentage / 100
+			}
+		case repositories.ThresholdAmountPromotion:
+			amounts = thresholdAmount(promotion, states, eligible, len(lines))
+		case repositories.BundlePromotion:
+			amounts = bundle(promotion, lines, eligible)
+		default:
+			continue
+		}
+
+		for i, amount := range amounts {
+			amount = roundToCents(float32(math.Min(float64(amount), float64(states[i].remaining))))
+			if amount <= 0 {
+				continue
+			}
+
+			states[i].remaining -= amount
+			states[i].promoted = true
+			states[i].exclusive = states[i].exclusive || !promotion.Stackable
+			discounts[i].Total = roundToCents(discounts[i].Total + amount)
+			discounts[i].Applied = append(discounts[i].Applied, repositories.AppliedPromotion{
+				PromotionID: promotion.ID,
+				Name:        promotion.Name,
+				Discount:    amount,
+			})
+		}
+	}
+
+	return discounts
+}
+
+func matches(promotion repositories.Promotion, line Line) bool {
+	switch promotion.Type {
+	case repositories.BuyXGetYPromotion, repositories.BundlePromotion:
+		return containsInt(promotion.ProductIDs, line.ProductID)
+	case repositories.CategoryPercentagePromotion:
+		return containsInt(line.CategoryIDs, promotion.CategoryID)
+	case repositories.ThresholdAmountPromotion:
+		return true
+	}
+
+	return false
+}
+
+// buyXGetY pools the whole units of the eligible lines, so that mixing the
+// products of the promotion counts too, and gives the cheapest units free.
+func buyXGetY(promotion repositories.Promotion, lines []Line, eligible []int) []float32 {
+	amounts := make([]float32, len(lines))
+
+	units := 0
+	for _, i := range eligible {
+		units += wholeUnits(lines[i].Quantity)
+	}
+	free := units / (promotion.BuyQuantity + promotion.FreeQuantity) * promotion.FreeQuantity
+
+	byPrice := append([]int{}, eligible...)
+	sort.SliceStable(byPrice, func(a, b int) bool { return lines[byPrice[a]].UnitPrice < lines[byPrice[b]].UnitPrice })
+	for _, i := range byPrice {
+		if free == 0 {
+			break
+		}
+		taken := wholeUnits(lines[i].Quantity)
+		if taken > free {
+			taken = free
+		}
+		amounts[i] = float32(taken) * lines[i].UnitPrice
+		free -= taken
+	}
+
+	return amounts
+}
+
+// thresholdAmount spreads the amount over the eligible lines, in proportion
+// to what is left of them.
+func thresholdAmount(promotion repositories.Promotion, states []lineState, eligible []int, count int) []float32 {
+	amounts := make([]float32, count)
+
+	shares := make(map[int]float32)
+	total := float32(0)
+	for _, i := range eligible {
+		shares[i] = states[i].remaining
+		total += states[i].remaining
+	}
+	if total < promotion.Threshold {
+		return amounts
+	}
+
+	return spread(amounts, eligible, shares, float32(math.Min(float64(promotion.Amount), float64(total))))
+}
+
+// bundle forms as many bundles as there are units of every product in it and
+// spreads what they save over their lines, in proportion to their prices.
+func bundle(promotion repositories.Promotion, lines []Line, eligible []int) []float32 {
+	amounts := make([]float32, len(lines))
+
+	count := -1
+	for _, productID := range promotion.ProductIDs {
+		units := 0
+		for _, i := range eligible {
+			if lines[i].ProductID == productID {
+				units += wholeUnits(lines[i].Quantity)
+			}
+		}
+		if count < 0 || units < count {
+			count = units
+		}
+	}
+	if count <= 0 {
+		return amounts
+	}
+
+	shares := make(map[int]float32)
+	var bundled []int
+	regular := float32(0)
+	for _, productID := range promotion.ProductIDs {
+		needed := count
+		for _, i := range eligible {
+			if lines[i].ProductID != productID || needed == 0 {
+				continue
+			}
+			taken := wholeUnits(lines[i].Quantity)
+			if taken > needed {
+				taken = needed
+			}
+			if _, ok := shares[i]; !ok {
+				bundled = append(bundled, i)
+			}
+			shares[i] += float32(taken) * lines[i].UnitPrice
+			regular += float32(taken) * lines[i].UnitPrice
+			needed -= taken
+		}
+	}
+
+	saved := regular - float32(count)*promotion.BundlePrice
+	if saved <= 0 {
+		return amounts
+	}
+
+	return spread(amounts, bundled, shares, saved)
+}
+
+// spread splits total over the lines in proportion to their shares; the last
+// line takes the rounding difference.
+func spread(amounts []float32, lines []int, shares map[int]float32, total float32) []float32 {
+	sum := float32(0)
+	for _, i := range lines {
+		sum += shares[i]
+	}
+	if sum <= 0 {
+		return amounts
+	}
+
+	allocated := float32(0)
+	for position, i := range lines {
+		amounts[i] = roundToCents(total * shares[i] / sum)
+		if position == len(lines)-1 {
+			amounts[i] = roundToCents(total - allocated)
+		}
+		allocated += amounts[i]
+	}
+
+	return amounts
+}
+
+// wholeUnits only counts whole units, leaving out the fractions of products
+// sold by weight.
+func wholeUnits(quantity float32) int {
+	return int(math.Floor(float64(quantity) + 1e-4))
+}
+
+func containsInt(values []int, value int) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func roundToCents(value float32) float32 {
+	return float32(math.Round(float64(value)*100) / 100)
+}
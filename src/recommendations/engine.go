@@ -0,0 +1,147 @@
+package recommendations
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/mariacalinoiu/smartket/src/datasources"
+)
+
+type scoredProduct struct {
+	productID int
+	score     int
+}
+
+// snapshot is rebuilt from scratch on every refresh and swapped in whole, so
+// readers never see a half computed state.
+type snapshot struct {
+	related     map[int][]scoredProduct
+	bestSellers map[int][]int
+	categoryOf  map[int]int
+}
+
+type Engine struct {
+	db      datasources.DBClient
+	mutex   sync.RWMutex
+	current snapshot
+}
+
+func NewEngine(db datasources.DBClient) *Engine {
+	return &Engine{
+		db: db,
+		current: snapshot{
+			related:     map[int][]scoredProduct{},
+			bestSellers: map[int][]int{},
+			categoryOf:  map[int]int{},
+		},
+	}
+}
+
+func (engine *Engine) Refresh() error {
+	coPurchases, err := engine.db.GetCoPurchases()
+	if err != nil {
+		return err
+	}
+
+	sales, err := engine.db.GetProductSales()
+	if err != nil {
+		return err
+	}
+
+	next := snapshot{
+		related:     map[int][]scoredProduct{},
+		bestSellers: map[int][]int{},
+		categoryOf:  map[int]int{},
+	}
+	for _, coPurchase := range coPurchases {
+		next.related[coPurchase.ProductID] = append(
+			next.related[coPurchase.ProductID],
+			scoredProduct{productID: coPurchase.RelatedID, score: coPurchase.Orders},
+		)
+	}
+	for _, related := range next.related {
+		sortByScore(related)
+	}
+	for _, product := range sales {
+		next.bestSellers[product.CategoryID] = append(next.bestSellers[product.CategoryID], product.ProductID)
+		next.categoryOf[product.ProductID] = product.CategoryID
+	}
+
+	engine.mutex.Lock()
+	engine.current = next
+	engine.mutex.Unlock()
+
+	return nil
+}
+
+// Related returns the products most often bought together with the given
+// one, topped up with the best sellers of its category.
+func (engine *Engine) Related(productID int, limit int) []int {
+	return engine.ForBasket([]int{productID}, limit)
+}
+
+// ForBasket ranks products by how many orders they share with the products
+// in the basket, leaving out the basket itself, and tops the list up with the
+// best sellers in the basket's categories.
+func (engine *Engine) ForBasket(productIDs []int, limit int) []int {
+	engine.mutex.RLock()
+	current := engine.current
+	engine.mutex.RUnlock()
+
+	excluded := map[int]bool{}
+	for _, productID := range productIDs {
+		excluded[productID] = true
+	}
+
+	scores := map[int]int{}
+	for _, productID := range productIDs {
+		for _, related := range current.related[productID] {
+			if !excluded[related.productID] {
+				scores[related.productID] += related.score
+			}
+		}
+	}
+
+	ranked := make([]scoredProduct, 0, len(scores))
+	for productID, score := range scores {
+		ranked = append(ranked, scoredProduct{productID: productID, score: score})
+	}
+	sortByScore(ranked)
+
+	var suggestions []int
+	for _, product := range ranked {
+		if len(suggestions) == limit {
+			return suggestions
+		}
+		suggestions = append(suggestions, product.productID)
+		excluded[product.productID] = true
+	}
+
+	for _, productID := range productIDs {
+		category, ok := current.categoryOf[productID]
+		if !ok {
+			continue
+		}
+
+		for _, bestSeller := range current.bestSellers[category] {
+			if len(suggestions) == limit {
+				return suggestions
+			}
+			if !excluded[bestSeller] {
+				suggestions = append(suggestions, bestSeller)
+				excluded[bestSeller] = true
+			}
+		}
+	}
+
+	return suggestions
+}
+
+func sortByScore(products []scoredProduct) {
+	sort.Slice(products, func(i, j int) bool {
+		if products[i].score != products[j].score {
+			return products[i].score > products[j].score
+		}
+		return products[i].productID < products[j].productID
+	})
+}
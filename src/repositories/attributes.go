@@ -0,0 +1,44 @@
+package repositories
+
+const (
+	TextAttribute    = "text"
+	NumberAttribute  = "number"
+	BooleanAttribute = "boolean"
+	ListAttribute    = "list"
+)
+
+type (
+	// ProductAttribute holds a value of its type: a string, a number, a
+	// boolean or a list of strings.
+	ProductAttribute struct {
+		Name  string      `json:"name"`
+		Type  string      `json:"type"`
+		Value interface{} `json:"value"`
+		Unit  string      `json:"unit,omitempty"`
+	}
+
+	ProductAttributesRequest struct {
+		Attributes []ProductAttribute `json:"attributes"`
+	}
+
+	ProductImage struct {
+		URL      string `json:"url"`
+		AltText  string `json:"altText,omitempty"`
+		Position int    `json:"position"`
+	}
+
+	ProductImagesRequest struct {
+		Images []ProductImage `json:"images"`
+	}
+
+	// UploadedImage describes a stored upload; Thumbnails maps each standard
+	// size to the URL of the image scaled down to it.
+	UploadedImage struct {
+		URL         string            `json:"url"`
+		ContentType string            `json:"contentType"`
+		Size        int               `json:"size"`
+		Width       int               `json:"width"`
+		Height      int               `json:"height"`
+		Thumbnails  map[string]string `json:"thumbnails"`
+	}
+)
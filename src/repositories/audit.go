@@ -0,0 +1,63 @@
+package repositories
+
+const (
+	OrderEntity          = "order"
+	ProductEntity        = "product"
+	CategoryEntity       = "category"
+	DepartmentEntity     = "department"
+	PaymentEntity        = "payment"
+	RefundEntity         = "refund"
+	CartEntity           = "cart"
+	AddressEntity        = "address"
+	DeliveryZoneEntity   = "deliveryZone"
+	DeliverySlotEntity   = "deliverySlot"
+	PickupLocationEntity = "pickupLocation"
+	TaxClassEntity       = "taxClass"
+	InvoiceEntity        = "invoice"
+	ProductVariantEntity = "productVariant"
+	ScheduledPriceEntity = "scheduledPrice"
+	PromotionEntity      = "promotion"
+)
+
+// SystemActor is who the changes made by the background workers are audited
+// under.
+const SystemActor = "system"
+
+const (
+	CreateOperation  = "create"
+	UpdateOperation  = "update"
+	DeleteOperation  = "delete"
+	RestoreOperation = "restore"
+)
+
+type (
+	AuditEntriesJSON struct {
+		AuditEntries []AuditEntry `json:"auditEntries"`
+	}
+
+	AuditEntry struct {
+		ID        int           `json:"ID"`
+		Actor     string        `json:"actor"`
+		Entity    string        `json:"entity"`
+		EntityID  int           `json:"entityID"`
+		Operation string        `json:"operation"`
+		Changes   []FieldChange `json:"changes"`
+		Timestamp int           `json:"timestamp"`
+		Date      string        `json:"date"`
+	}
+
+	FieldChange struct {
+		Field  string      `json:"field"`
+		Before interface{} `json:"before"`
+		After  interface{} `json:"after"`
+	}
+
+	AuditFilter struct {
+		Actor     string
+		Entity    string
+		EntityID  int
+		Operation string
+		From      int
+		To        int
+	}
+)
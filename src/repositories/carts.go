@@ -0,0 +1,45 @@
+package repositories
+
+type (
+	CartIDResponse struct {
+		CartID int `json:"cartID"`
+	}
+
+	CartsJSON struct {
+		Carts []Cart `json:"carts"`
+	}
+
+	Cart struct {
+		ID             int           `json:"ID"`
+		Email          string        `json:"email"`
+		Timestamp      int           `json:"timestamp"`
+		Date           string        `json:"date"`
+		ProductsInCart []CartProduct `json:"products"`
+	}
+
+	CartProduct struct {
+		ProductID int             `json:"ID"`
+		VariantID int             `json:"variantID,omitempty"`
+		CartID    int             `json:"cartID"`
+		Quantity  float32         `json:"quantity"`
+		Product   Product         `json:"productDetails"`
+		Variant   *ProductVariant `json:"variantDetails,omitempty"`
+	}
+
+	AbandonedCartEvent struct {
+		ID        int    `json:"ID"`
+		CartID    int    `json:"cartID"`
+		Email     string `json:"email"`
+		Notified  bool   `json:"notified"`
+		Timestamp int    `json:"timestamp"`
+		Date      string `json:"date"`
+	}
+
+	// NotificationPreference is changed by its admins or by the customer,
+	// with the token sent along with their reminders.
+	NotificationPreference struct {
+		Email  string `json:"email"`
+		OptOut bool   `json:"optOut"`
+		Token  string `json:"token,omitempty"`
+	}
+)
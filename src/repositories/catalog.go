@@ -0,0 +1,42 @@
+package repositories
+
+// CategoryPathSeparator splits an imported category into its levels, as in
+// "Fructe > Citrice".
+const CategoryPathSeparator = ">"
+
+type (
+	// CatalogRow is one product of an imported catalog file, along with the
+	// department and category it belongs to, which are matched by name.
+	CatalogRow struct {
+		Row         int      `json:"-"`
+		SKU         string   `json:"sku"`
+		Department  string   `json:"department"`
+		Category    string   `json:"category"`
+		Name        string   `json:"name"`
+		Description *string  `json:"description,omitempty"`
+		Price       float32  `json:"price"`
+		ImageURL    *string  `json:"imageURL,omitempty"`
+		Stock       *float32 `json:"stock,omitempty"`
+	}
+
+	ImportReport struct {
+		DryRun  bool           `json:"dryRun"`
+		Rows    int            `json:"rows"`
+		Errors  []ImportError  `json:"errors"`
+		Changes []ImportChange `json:"changes"`
+	}
+
+	ImportError struct {
+		Row     int    `json:"row"`
+		Field   string `json:"field,omitempty"`
+		Message string `json:"message"`
+	}
+
+	ImportChange struct {
+		Row       int    `json:"row"`
+		Entity    string `json:"entity"`
+		EntityID  int    `json:"entityID,omitempty"`
+		Operation string `json:"operation"`
+		Key       string `json:"key"`
+	}
+)
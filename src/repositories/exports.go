@@ -0,0 +1,33 @@
+package repositories
+
+type (
+	ExportFilter struct {
+		From   int
+		To     int
+		Status string
+	}
+
+	// ExportLine is one ordered product along with the order it belongs to.
+	ExportLine struct {
+		OrderID            int
+		Timestamp          int
+		Status             string
+		Email              string
+		FirstName          string
+		LastName           string
+		City               string
+		FulfilmentType     string
+		PaymentMethod      string
+		VoucherCode        string
+		DiscountPercentage int
+		ProductID          int
+		SKU                string
+		ProductName        string
+		Quantity           float32
+		UnitPrice          float32
+		PromotionDiscount  float32
+		VATRate            float32
+		Total              float32
+		VAT                float32
+	}
+)
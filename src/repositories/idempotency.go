@@ -0,0 +1,11 @@
+package repositories
+
+type IdempotentResponse struct {
+	Key         string
+	RequestHash string
+	Completed   bool
+	Status      int
+	Body        []byte
+	ETag        string
+	Timestamp   int
+}
@@ -0,0 +1,55 @@
+package repositories
+
+const (
+	InvoiceDocument    = "invoice"
+	CreditNoteDocument = "creditNote"
+)
+
+type (
+	InvoicesJSON struct {
+		Invoices []Invoice `json:"invoices"`
+	}
+
+	// Invoice is either an invoice or a credit note; once issued, it is stored
+	// as is and never recomputed from the order.
+	Invoice struct {
+		ID              int           `json:"ID"`
+		Kind            string        `json:"kind"`
+		Series          string        `json:"series"`
+		Number          int           `json:"number"`
+		FullNumber      string        `json:"fullNumber"`
+		OrderID         int           `json:"orderID"`
+		RefundID        int           `json:"refundID,omitempty"`
+		InvoiceNumber   string        `json:"invoiceNumber,omitempty"`
+		Issuer          Party         `json:"issuer"`
+		Buyer           Party         `json:"buyer"`
+		Currency        string        `json:"currency"`
+		Lines           []InvoiceLine `json:"lines"`
+		VATBreakdown    []VATLine     `json:"vatBreakdown"`
+		VATTotal        float32       `json:"vatTotal"`
+		Total           float32       `json:"total"`
+		IssuedTimestamp int           `json:"issuedTimestamp"`
+		IssuedDate      string        `json:"issuedDate"`
+	}
+
+	Party struct {
+		Name               string `json:"name"`
+		TaxID              string `json:"taxID,omitempty"`
+		RegistrationNumber string `json:"registrationNumber,omitempty"`
+		Address            string `json:"address"`
+		Email              string `json:"email,omitempty"`
+		PhoneNumber        string `json:"phoneNumber,omitempty"`
+		IBAN               string `json:"iban,omitempty"`
+	}
+
+	InvoiceLine struct {
+		Description string  `json:"description"`
+		Quantity    float32 `json:"quantity"`
+		Unit        string  `json:"unit,omitempty"`
+		UnitPrice   float32 `json:"unitPrice"`
+		VATRate     float32 `json:"vatRate"`
+		Net         float32 `json:"net"`
+		VAT         float32 `json:"vat"`
+		Total       float32 `json:"total"`
+	}
+)
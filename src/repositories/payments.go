@@ -0,0 +1,25 @@
+package repositories
+
+type (
+	PaymentsJSON struct {
+		Payments []Payment `json:"payments"`
+	}
+
+	Payment struct {
+		ID            int     `json:"ID"`
+		OrderID       int     `json:"orderID"`
+		Provider      string  `json:"provider"`
+		Operation     string  `json:"operation"`
+		TransactionID string  `json:"transactionID"`
+		Status        string  `json:"status"`
+		Amount        float32 `json:"amount"`
+		Timestamp     int     `json:"timestamp"`
+		Date          string  `json:"date"`
+	}
+
+	PaymentRequest struct {
+		OrderID   int     `json:"orderID"`
+		Operation string  `json:"operation"`
+		Amount    float32 `json:"amount"`
+	}
+)
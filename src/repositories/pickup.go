@@ -0,0 +1,33 @@
+package repositories
+
+const (
+	DeliveryFulfilment = "delivery"
+	PickupFulfilment   = "pickup"
+)
+
+type (
+	PickupLocationIDResponse struct {
+		PickupLocationID int `json:"pickupLocationID"`
+	}
+
+	PickupLocationsJSON struct {
+		PickupLocations []PickupLocation `json:"pickupLocations"`
+	}
+
+	PickupLocation struct {
+		ID           int            `json:"ID"`
+		Name         string         `json:"name"`
+		Street       string         `json:"street"`
+		Number       string         `json:"number"`
+		PostalCode   string         `json:"postalCode"`
+		City         string         `json:"city"`
+		County       string         `json:"county"`
+		OpeningHours []OpeningHours `json:"openingHours"`
+	}
+
+	OpeningHours struct {
+		Weekday int    `json:"weekday"`
+		Opens   string `json:"opens"`
+		Closes  string `json:"closes"`
+	}
+)
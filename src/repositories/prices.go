@@ -0,0 +1,58 @@
+package repositories
+
+const (
+	ImportPriceSource    = "import"
+	ManualPriceSource    = "manual"
+	ScheduledPriceSource = "schedule"
+)
+
+// A scheduled price change is pending until it starts. Changes with an end
+// are active while they last and end by restoring the previous price; the
+// ones without an end are applied for good.
+const (
+	PendingPriceChange   = "pending"
+	ActivePriceChange    = "active"
+	AppliedPriceChange   = "applied"
+	EndedPriceChange     = "ended"
+	CancelledPriceChange = "cancelled"
+	SkippedPriceChange   = "skipped"
+)
+
+type (
+	PriceHistoryJSON struct {
+		Prices []PriceChange `json:"prices"`
+	}
+
+	PriceChange struct {
+		ID               int     `json:"ID"`
+		ProductID        int     `json:"productID"`
+		VariantID        int     `json:"variantID,omitempty"`
+		PreviousPrice    float32 `json:"previousPrice"`
+		Price            float32 `json:"price"`
+		Source           string  `json:"source"`
+		ScheduledPriceID int     `json:"scheduledPriceID,omitempty"`
+		Timestamp        int     `json:"timestamp"`
+		Date             string  `json:"date"`
+	}
+
+	ScheduledPricesJSON struct {
+		ScheduledPrices []ScheduledPrice `json:"scheduledPrices"`
+	}
+
+	ScheduledPrice struct {
+		ID             int     `json:"ID"`
+		ProductID      int     `json:"productID"`
+		VariantID      int     `json:"variantID,omitempty"`
+		Price          float32 `json:"price"`
+		PreviousPrice  float32 `json:"previousPrice,omitempty"`
+		StartTimestamp int     `json:"startTimestamp"`
+		EndTimestamp   int     `json:"endTimestamp,omitempty"`
+		Status         string  `json:"status"`
+		StartDate      string  `json:"startDate"`
+		EndDate        string  `json:"endDate,omitempty"`
+	}
+
+	ScheduledPriceIDResponse struct {
+		ScheduledPriceID int `json:"scheduledPriceID"`
+	}
+)
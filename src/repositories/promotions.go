@@ -0,0 +1,54 @@
+package repositories
+
+const (
+	BuyXGetYPromotion           = "buyXGetY"
+	CategoryPercentagePromotion = "categoryPercentage"
+	ThresholdAmountPromotion    = "thresholdAmount"
+	BundlePromotion             = "bundle"
+)
+
+type (
+	PromotionsJSON struct {
+		Promotions []Promotion `json:"promotions"`
+	}
+
+	// Promotion is applied automatically to the orders it matches, higher
+	// Priority first. A promotion that is not Stackable only applies to lines
+	// no other promotion applied to, and keeps the others off its lines.
+	//
+	// Only the fields of its Type are used: buyXGetY gives FreeQuantity of
+	// ProductIDs for every BuyQuantity bought, categoryPercentage takes
+	// Percentage off the products of CategoryID and the categories under it,
+	// thresholdAmount takes Amount off orders of at least Threshold and bundle
+	// sells one of each of ProductIDs for BundlePrice.
+	Promotion struct {
+		ID             int     `json:"ID"`
+		Name           string  `json:"name"`
+		Type           string  `json:"type"`
+		Priority       int     `json:"priority"`
+		Stackable      bool    `json:"stackable"`
+		Active         bool    `json:"active"`
+		StartTimestamp int     `json:"startTimestamp,omitempty"`
+		EndTimestamp   int     `json:"endTimestamp,omitempty"`
+		ProductIDs     []int   `json:"productIDs,omitempty"`
+		BuyQuantity    int     `json:"buyQuantity,omitempty"`
+		FreeQuantity   int     `json:"freeQuantity,omitempty"`
+		CategoryID     int     `json:"categoryID,omitempty"`
+		Percentage     float32 `json:"percentage,omitempty"`
+		Threshold      float32 `json:"threshold,omitempty"`
+		Amount         float32 `json:"amount,omitempty"`
+		BundlePrice    float32 `json:"bundlePrice,omitempty"`
+	}
+
+	PromotionIDResponse struct {
+		PromotionID int `json:"promotionID"`
+	}
+
+	// AppliedPromotion is the share of a promotion's discount that went to an
+	// order line.
+	AppliedPromotion struct {
+		PromotionID int     `json:"promotionID"`
+		Name        string  `json:"name"`
+		Discount    float32 `json:"discount"`
+	}
+)
@@ -0,0 +1,15 @@
+package repositories
+
+type (
+	CoPurchase struct {
+		ProductID int
+		RelatedID int
+		Orders    int
+	}
+
+	ProductSales struct {
+		ProductID  int
+		CategoryID int
+		Quantity   float32
+	}
+)
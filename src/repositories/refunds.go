@@ -0,0 +1,37 @@
+package repositories
+
+const (
+	FullRefund   = "full"
+	LinesRefund  = "lines"
+	AmountRefund = "amount"
+)
+
+type (
+	RefundIDResponse struct {
+		RefundID int `json:"refundID"`
+	}
+
+	RefundsJSON struct {
+		Refunds []Refund `json:"refunds"`
+	}
+
+	Refund struct {
+		ID               int               `json:"ID"`
+		OrderID          int               `json:"orderID"`
+		Type             string            `json:"type"`
+		Amount           float32           `json:"amount"`
+		Reason           string            `json:"reason"`
+		Operator         string            `json:"operator"`
+		Restock          bool              `json:"restock"`
+		ProductsRefunded []RefundedProduct `json:"products"`
+		Timestamp        int               `json:"timestamp"`
+		Date             string            `json:"date"`
+	}
+
+	RefundedProduct struct {
+		ProductID int     `json:"ID"`
+		VariantID int     `json:"variantID,omitempty"`
+		Quantity  float32 `json:"quantity"`
+		Amount    float32 `json:"amount"`
+	}
+)
@@ -0,0 +1,37 @@
+package repositories
+
+const (
+	DayReport           = "day"
+	WeekReport          = "week"
+	MonthReport         = "month"
+	DepartmentReport    = "department"
+	CategoryReport      = "category"
+	ProductReport       = "product"
+	CityReport          = "city"
+	PaymentMethodReport = "paymentMethod"
+	VoucherReport       = "voucher"
+)
+
+type (
+	SalesReport struct {
+		GroupBy string     `json:"groupBy"`
+		From    string     `json:"from"`
+		To      string     `json:"to"`
+		Rows    []SalesRow `json:"rows"`
+		Totals  SalesRow   `json:"totals"`
+	}
+
+	// SalesRow sums the ordered products of a group at their discounted prices,
+	// so Revenue leaves out shipping; Discount is what the vouchers cost.
+	SalesRow struct {
+		Key           string  `json:"key"`
+		Label         string  `json:"label"`
+		Orders        int     `json:"orders"`
+		Quantity      float32 `json:"quantity"`
+		Revenue       float32 `json:"revenue"`
+		Discount      float32 `json:"discount"`
+		Refunded      float32 `json:"refunded"`
+		NetRevenue    float32 `json:"netRevenue"`
+		AverageBasket float32 `json:"averageBasket"`
+	}
+)
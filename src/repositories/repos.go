@@ -1,6 +1,20 @@
 package repositories
 
-const DefaultOrderStatus = "in asteptare"
+const (
+	DefaultOrderStatus   = "in asteptare"
+	PaidOrderStatus      = "platita"
+	RefundedOrderStatus  = "rambursata"
+	CancelledOrderStatus = "anulata"
+)
+
+// The fulfilment status of an order is kept apart from its status, which
+// follows its payment.
+const ReadyForPickupStatus = "gata de ridicare"
+
+const (
+	DepartmentBreadcrumb = "department"
+	CategoryBreadcrumb   = "category"
+)
 
 type (
 	DepartmentsJSON struct {
@@ -8,8 +22,9 @@ type (
 	}
 
 	Department struct {
-		ID   int    `json:"ID"`
-		Name string `json:"name"`
+		ID      int    `json:"ID"`
+		Name    string `json:"name"`
+		Version int    `json:"version,omitempty"`
 	}
 
 	CategoriesJSON struct {
@@ -17,15 +32,48 @@ type (
 	}
 
 	Category struct {
-		ID           int    `json:"ID"`
-		Name         string `json:"name"`
-		DepartmentId int    `json:"departmentID"`
+		ID                  int    `json:"ID"`
+		Name                string `json:"name"`
+		DepartmentId        int    `json:"departmentID"`
+		ParentID            int    `json:"parentID,omitempty"`
+		TaxClassID          int    `json:"taxClassID,omitempty"`
+		EffectiveTaxClassID int    `json:"effectiveTaxClassID,omitempty"`
+		Version             int    `json:"version,omitempty"`
+	}
+
+	CategoryIDResponse struct {
+		CategoryID int `json:"categoryID"`
+	}
+
+	CatalogTreeJSON struct {
+		Departments []DepartmentNode `json:"departments"`
+	}
+
+	DepartmentNode struct {
+		Department
+		Categories []CategoryNode `json:"categories"`
+	}
+
+	CategoryNode struct {
+		Category
+		Children []CategoryNode `json:"children"`
+	}
+
+	Breadcrumb struct {
+		ID   int    `json:"ID"`
+		Name string `json:"name"`
+		Kind string `json:"kind"`
 	}
 
 	OrderIDResponse struct {
 		OrderID int `json:"orderID"`
 	}
 
+	OrderLinesRequest struct {
+		OrderID int              `json:"orderID"`
+		Lines   []OrderedProduct `json:"products"`
+	}
+
 	OrdersJSON struct {
 		Orders []Order `json:"orders"`
 	}
@@ -38,33 +86,78 @@ type (
 		PhoneNumber        string           `json:"phoneNumber"`
 		City               string           `json:"city"`
 		Address            string           `json:"address"`
+		FulfilmentType     string           `json:"fulfilmentType"`
+		PickupLocationID   int              `json:"pickupLocationID,omitempty"`
+		PickupAddress      string           `json:"pickupAddress,omitempty"`
+		FulfilmentStatus   string           `json:"fulfilmentStatus,omitempty"`
+		AddressID          int              `json:"addressID,omitempty"`
+		ShippingAddress    *Address         `json:"shippingAddress,omitempty"`
+		DeliveryZoneID     int              `json:"deliveryZoneID,omitempty"`
+		SlotReservationID  int              `json:"slotReservationID,omitempty"`
+		DeliverySlot       *BookedSlot      `json:"deliverySlot,omitempty"`
 		VoucherCode        string           `json:"voucherCode"`
 		DiscountPercentage int              `json:"discountPercentage"`
+		PromotionDiscount  float32          `json:"promotionDiscount,omitempty"`
 		PaymentMethod      string           `json:"paymentMethod"`
 		Status             string           `json:"status"`
 		Timestamp          int              `json:"timestamp"`
 		Date               string           `json:"date"`
 		Value              float32          `json:"value"`
+		ShippingCost       float32          `json:"shippingCost"`
+		ShippingVATRate    float32          `json:"shippingVATRate,omitempty"`
+		Total              float32          `json:"total"`
+		VATTotal           float32          `json:"vatTotal"`
+		VATBreakdown       []VATLine        `json:"vatBreakdown"`
+		RefundedValue      float32          `json:"refundedValue"`
 		ProductsOrdered    []OrderedProduct `json:"products"`
+		Payments           []Payment        `json:"payments"`
+		Refunds            []Refund         `json:"refunds"`
+		ArchivedBy         string           `json:"archivedBy,omitempty"`
+		ArchivedTimestamp  int              `json:"archivedTimestamp,omitempty"`
+		Version            int              `json:"version"`
 	}
 
+	// OrderedProduct is billed by Quantity, which becomes the actual quantity
+	// once the line was weighed; OrderedQuantity then keeps the one ordered.
+	// PromotionDiscount is taken off the line before the voucher applies.
 	OrderedProduct struct {
-		ProductID int     `json:"ID"`
-		OrderID   int     `json:"orderID"`
-		Quantity  int     `json:"quantity"`
-		Product   Product `json:"productDetails"`
+		ProductID         int                `json:"ID"`
+		VariantID         int                `json:"variantID,omitempty"`
+		OrderID           int                `json:"orderID"`
+		Quantity          float32            `json:"quantity"`
+		OrderedQuantity   *float32           `json:"orderedQuantity,omitempty"`
+		PromotionDiscount float32            `json:"promotionDiscount,omitempty"`
+		Promotions        []AppliedPromotion `json:"promotions,omitempty"`
+		Product           Product            `json:"productDetails"`
+		Variant           *ProductVariant    `json:"variantDetails,omitempty"`
 	}
 
 	ProductsJSON struct {
 		Products []Product `json:"products"`
 	}
 
+	// Product is priced and stocked per Unit: per piece, kilogram or litre.
+	// During a promotion, WasPrice holds the price from before it.
 	Product struct {
-		ID          int     `json:"ID"`
-		Name        string  `json:"name"`
-		ImageURL    string  `json:"imageURL"`
-		Description string  `json:"description"`
-		Price       float32 `json:"price"`
-		CategoryID  int     `json:"categoryID"`
+		ID           int                `json:"ID"`
+		Name         string             `json:"name"`
+		ImageURL     string             `json:"imageURL"`
+		Description  string             `json:"description"`
+		Price        float32            `json:"price"`
+		WasPrice     float32            `json:"wasPrice,omitempty"`
+		PromotionEnd int                `json:"promotionEndTimestamp,omitempty"`
+		Stock        float32            `json:"stock"`
+		Unit         string             `json:"unit,omitempty"`
+		QuantityStep float32            `json:"quantityStep,omitempty"`
+		MinQuantity  float32            `json:"minQuantity,omitempty"`
+		CategoryID   int                `json:"categoryID"`
+		TaxClassID   int                `json:"taxClassID,omitempty"`
+		VATRate      float32            `json:"vatRate"`
+		Breadcrumbs  []Breadcrumb       `json:"breadcrumbs,omitempty"`
+		Attributes   []ProductAttribute `json:"attributes,omitempty"`
+		Images       []ProductImage     `json:"images,omitempty"`
+		Options      []ProductOption    `json:"options,omitempty"`
+		Variants     []ProductVariant   `json:"variants,omitempty"`
+		Version      int                `json:"version,omitempty"`
 	}
 )
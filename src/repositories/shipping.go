@@ -0,0 +1,40 @@
+package repositories
+
+type (
+	AddressIDResponse struct {
+		AddressID int `json:"addressID"`
+	}
+
+	AddressesJSON struct {
+		Addresses []Address `json:"addresses"`
+	}
+
+	Address struct {
+		ID         int    `json:"ID"`
+		Email      string `json:"email"`
+		Street     string `json:"street"`
+		Number     string `json:"number"`
+		Details    string `json:"details"`
+		PostalCode string `json:"postalCode"`
+		City       string `json:"city"`
+		County     string `json:"county"`
+		Country    string `json:"country"`
+	}
+
+	DeliveryZoneIDResponse struct {
+		DeliveryZoneID int `json:"deliveryZoneID"`
+	}
+
+	DeliveryZonesJSON struct {
+		DeliveryZones []DeliveryZone `json:"deliveryZones"`
+	}
+
+	DeliveryZone struct {
+		ID                    int      `json:"ID"`
+		Name                  string   `json:"name"`
+		Counties              []string `json:"counties"`
+		PostalCodePrefixes    []string `json:"postalCodePrefixes"`
+		ShippingFee           float32  `json:"shippingFee"`
+		FreeShippingThreshold float32  `json:"freeShippingThreshold"`
+	}
+)
@@ -0,0 +1,55 @@
+package repositories
+
+const DeliveryDateLayout = "2006-01-02"
+
+type (
+	DeliverySlotIDResponse struct {
+		DeliverySlotID int `json:"deliverySlotID"`
+	}
+
+	DeliverySlotsJSON struct {
+		DeliverySlots []DeliverySlot `json:"deliverySlots"`
+	}
+
+	DeliverySlot struct {
+		ID               int    `json:"ID"`
+		DeliveryZoneID   int    `json:"deliveryZoneID,omitempty"`
+		PickupLocationID int    `json:"pickupLocationID,omitempty"`
+		Weekday          int    `json:"weekday"`
+		StartTime        string `json:"startTime"`
+		EndTime          string `json:"endTime"`
+		Capacity         int    `json:"capacity"`
+	}
+
+	AvailableSlotsJSON struct {
+		AvailableSlots []AvailableSlot `json:"availableSlots"`
+	}
+
+	AvailableSlot struct {
+		SlotID           int    `json:"slotID"`
+		DeliveryZoneID   int    `json:"deliveryZoneID,omitempty"`
+		PickupLocationID int    `json:"pickupLocationID,omitempty"`
+		Date             string `json:"date"`
+		StartTime        string `json:"startTime"`
+		EndTime          string `json:"endTime"`
+		Capacity         int    `json:"capacity"`
+		Available        int    `json:"available"`
+	}
+
+	SlotReservation struct {
+		ID               int    `json:"ID"`
+		SlotID           int    `json:"slotID"`
+		Date             string `json:"date"`
+		Email            string `json:"email"`
+		ExpiresTimestamp int    `json:"expiresTimestamp"`
+		ExpiresDate      string `json:"expiresDate"`
+		OrderID          int    `json:"orderID,omitempty"`
+	}
+
+	BookedSlot struct {
+		SlotID    int    `json:"slotID"`
+		Date      string `json:"date"`
+		StartTime string `json:"startTime"`
+		EndTime   string `json:"endTime"`
+	}
+)
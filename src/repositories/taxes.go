@@ -0,0 +1,33 @@
+package repositories
+
+type (
+	TaxClassIDResponse struct {
+		TaxClassID int `json:"taxClassID"`
+	}
+
+	TaxClassesJSON struct {
+		TaxClasses []TaxClass `json:"taxClasses"`
+	}
+
+	TaxClass struct {
+		ID        int     `json:"ID"`
+		Name      string  `json:"name"`
+		Rate      float32 `json:"rate"`
+		IsDefault bool    `json:"isDefault"`
+	}
+
+	// TaxClassAssignment links a tax class to either a category or a product;
+	// a TaxClassID of 0 removes the link.
+	TaxClassAssignment struct {
+		CategoryID int `json:"categoryID,omitempty"`
+		ProductID  int `json:"productID,omitempty"`
+		TaxClassID int `json:"taxClassID"`
+	}
+
+	VATLine struct {
+		Rate  float32 `json:"rate"`
+		Net   float32 `json:"net"`
+		VAT   float32 `json:"vat"`
+		Gross float32 `json:"gross"`
+	}
+)
@@ -0,0 +1,31 @@
+package repositories
+
+const (
+	PieceUnit    = "piece"
+	KilogramUnit = "kg"
+	LitreUnit    = "l"
+)
+
+type (
+	// ProductUnitRequest sets the unit a product is sold and priced by, and
+	// the quantities it can be ordered in: multiples of QuantityStep, starting
+	// from MinQuantity.
+	ProductUnitRequest struct {
+		Unit         string  `json:"unit"`
+		QuantityStep float32 `json:"quantityStep"`
+		MinQuantity  float32 `json:"minQuantity"`
+	}
+
+	// ActualQuantity is the quantity of an order line measured when picking
+	// it, such as the weight of the cheese actually cut.
+	ActualQuantity struct {
+		ProductID      int     `json:"ID"`
+		VariantID      int     `json:"variantID,omitempty"`
+		ActualQuantity float32 `json:"actualQuantity"`
+	}
+
+	ActualQuantitiesRequest struct {
+		OrderID int              `json:"orderID"`
+		Lines   []ActualQuantity `json:"products"`
+	}
+)
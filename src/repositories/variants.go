@@ -0,0 +1,26 @@
+package repositories
+
+type (
+	// ProductOption is one dimension the variants of a product differ by,
+	// such as size or pack, along with the values its variants take.
+	ProductOption struct {
+		Name   string   `json:"name"`
+		Values []string `json:"values"`
+	}
+
+	ProductVariant struct {
+		ID           int               `json:"ID"`
+		ProductID    int               `json:"productID"`
+		SKU          string            `json:"sku"`
+		Barcode      string            `json:"barcode,omitempty"`
+		Options      map[string]string `json:"options"`
+		Price        float32           `json:"price"`
+		WasPrice     float32           `json:"wasPrice,omitempty"`
+		PromotionEnd int               `json:"promotionEndTimestamp,omitempty"`
+		Stock        float32           `json:"stock"`
+	}
+
+	ProductVariantIDResponse struct {
+		VariantID int `json:"variantID"`
+	}
+)
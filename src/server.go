@@ -1,100 +1,545 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 
+	"github.com/mariacalinoiu/smartket/src/catalog"
 	"github.com/mariacalinoiu/smartket/src/datasources"
 	"github.com/mariacalinoiu/smartket/src/handlers"
+	"github.com/mariacalinoiu/smartket/src/images"
+	"github.com/mariacalinoiu/smartket/src/invoices"
+	"github.com/mariacalinoiu/smartket/src/notifiers"
+	"github.com/mariacalinoiu/smartket/src/payments"
+	"github.com/mariacalinoiu/smartket/src/recommendations"
+	"github.com/mariacalinoiu/smartket/src/validation"
+	"github.com/mariacalinoiu/smartket/src/workers"
 )
 
 type server struct {
-	mux    *http.ServeMux
-	logger *log.Logger
+	mux               *http.ServeMux
+	timeout           http.Handler
+	logger            *log.Logger
+	payments          payments.Registry
+	admins            map[string]string
+	idempotencyWindow time.Duration
+	validator         validation.Validator
+	slotReservation   time.Duration
+	invoicing         invoices.Config
+	recommender       *recommendations.Engine
+	imageStore        *images.Store
 }
 
 type option func(*server)
 
+// defaultAdmin is the name the -admin-token admin is audited under.
+const defaultAdmin = "admin"
+
+// writeTimeout bounds how long a response may take, except on the streaming
+// routes, whose length grows with the data they send.
+const writeTimeout = 10 * time.Second
+
+var streamingRoutes = map[string]bool{
+	"/orders/export": true,
+}
+
 func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	s.log("Method: %s, Path: %s", r.Method, r.URL.Path)
-	s.mux.ServeHTTP(w, r)
+	if admin, ok := s.adminOf(r); ok {
+		r = handlers.WithActor(r, admin)
+	}
+	if streamingRoutes[r.URL.Path] {
+		s.mux.ServeHTTP(w, r)
+		return
+	}
+	s.timeout.ServeHTTP(w, r)
 }
 
 func (s *server) log(format string, v ...interface{}) {
 	s.logger.Printf(format+"\n", v...)
 }
 
+// adminOf is the name of the admin whose token the request carries.
+func (s *server) adminOf(r *http.Request) (string, bool) {
+	token := r.Header.Get("X-Admin-Token")
+	if len(token) == 0 {
+		return "", false
+	}
+	admin, ok := s.admins[token]
+
+	return admin, ok
+}
+
+func (s *server) admin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := s.adminOf(r); !ok {
+			status := http.StatusForbidden
+			s.log("Error: admin token missing or invalid; Status: %d %s", status, http.StatusText(status))
+			http.Error(w, "this route is restricted to admins", status)
+
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func (s *server) adminWrites(next http.HandlerFunc) http.HandlerFunc {
+	restricted := s.admin(next)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next(w, r)
+			return
+		}
+
+		restricted(w, r)
+	}
+}
+
 func logWith(logger *log.Logger) option {
 	return func(s *server) {
 		s.logger = logger
 	}
 }
 
-func setup(logger *log.Logger, db datasources.DBClient) *http.Server {
-	server := newServer(db, logWith(logger))
+func paymentsWith(registry payments.Registry) option {
+	return func(s *server) {
+		s.payments = registry
+	}
+}
+
+func adminTokenWith(token string) option {
+	return func(s *server) {
+		if len(token) > 0 {
+			s.admins[token] = defaultAdmin
+		}
+	}
+}
+
+// adminsWith lets each admin in on admin routes with their own token, so the
+// audit log records who made a change.
+func adminsWith(tokens map[string]string) option {
+	return func(s *server) {
+		for token, admin := range tokens {
+			s.admins[token] = admin
+		}
+	}
+}
+
+func idempotencyWindowWith(window time.Duration) option {
+	return func(s *server) {
+		s.idempotencyWindow = window
+	}
+}
+
+func validatorWith(validator validation.Validator) option {
+	return func(s *server) {
+		s.validator = validator
+	}
+}
+
+func slotReservationWith(ttl time.Duration) option {
+	return func(s *server) {
+		s.slotReservation = ttl
+	}
+}
+
+func invoicingWith(config invoices.Config) option {
+	return func(s *server) {
+		s.invoicing = config
+	}
+}
+
+func recommenderWith(engine *recommendations.Engine) option {
+	return func(s *server) {
+		s.recommender = engine
+	}
+}
+
+func imageStoreWith(store *images.Store) option {
+	return func(s *server) {
+		s.imageStore = store
+	}
+}
+
+func setup(logger *log.Logger, db datasources.DBClient, adminToken string, admins map[string]string, idempotencyWindow time.Duration, validator validation.Validator, slotReservation time.Duration, invoicing invoices.Config, recommender *recommendations.Engine, imageStore *images.Store) *http.Server {
+	server := newServer(
+		db,
+		logWith(logger),
+		paymentsWith(payments.NewRegistry()),
+		adminTokenWith(adminToken),
+		adminsWith(admins),
+		idempotencyWindowWith(idempotencyWindow),
+		validatorWith(validator),
+		slotReservationWith(slotReservation),
+		invoicingWith(invoicing),
+		recommenderWith(recommender),
+		imageStoreWith(imageStore),
+	)
+	// there is no WriteTimeout, as exports would be cut off by it: the server
+	// bounds the other routes itself, see writeTimeout
 	return &http.Server{
-		Addr:         ":8081",
-		Handler:      server,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
-		IdleTimeout:  600 * time.Second,
+		Addr:        ":8081",
+		Handler:     server,
+		ReadTimeout: 5 * time.Second,
+		IdleTimeout: 600 * time.Second,
 	}
 }
 
 func newServer(db datasources.DBClient, options ...option) *server {
-	s := &server{logger: log.New(ioutil.Discard, "", 0)}
+	s := &server{
+		logger:            log.New(ioutil.Discard, "", 0),
+		payments:          payments.NewRegistry(),
+		admins:            make(map[string]string),
+		idempotencyWindow: 24 * time.Hour,
+		validator:         validation.DefaultValidator(),
+		slotReservation:   15 * time.Minute,
+		invoicing:         invoices.DefaultConfig(),
+		recommender:       recommendations.NewEngine(db),
+	}
 
 	for _, o := range options {
 		o(s)
 	}
 
 	s.mux = http.NewServeMux()
+	s.timeout = http.TimeoutHandler(s.mux, writeTimeout, "the request took too long")
 
 	s.mux.HandleFunc("/departments",
-		func(w http.ResponseWriter, r *http.Request) {
+		handlers.Transactional(db, s.logger, func(w http.ResponseWriter, r *http.Request, db datasources.DBClient) {
 			handlers.HandleDepartments(w, r, db, s.logger)
-		},
+		}),
 	)
 	s.mux.HandleFunc("/categories",
-		func(w http.ResponseWriter, r *http.Request) {
+		s.adminWrites(handlers.Transactional(db, s.logger, func(w http.ResponseWriter, r *http.Request, db datasources.DBClient) {
 			handlers.HandleCategories(w, r, db, s.logger)
+		})),
+	)
+	s.mux.HandleFunc("/catalog/tree",
+		func(w http.ResponseWriter, r *http.Request) {
+			handlers.HandleCatalogTree(w, r, db, s.logger)
 		},
 	)
 	s.mux.HandleFunc("/products",
-		func(w http.ResponseWriter, r *http.Request) {
+		handlers.Transactional(db, s.logger, func(w http.ResponseWriter, r *http.Request, db datasources.DBClient) {
 			handlers.HandleProducts(w, r, db, s.logger)
-		},
+		}),
+	)
+	s.mux.HandleFunc("/products/",
+		s.adminWrites(handlers.Transactional(db, s.logger, func(w http.ResponseWriter, r *http.Request, db datasources.DBClient) {
+			handlers.HandleProductPaths(w, r, db, s.recommender, s.logger)
+		})),
 	)
 	s.mux.HandleFunc("/orders",
+		handlers.Idempotent(db, s.idempotencyWindow, s.logger, handlers.Transactional(db, s.logger, func(w http.ResponseWriter, r *http.Request, db datasources.DBClient) {
+			handlers.HandleOrdersAdd(w, r, db, s.validator, s.logger)
+		})),
+	)
+	s.mux.HandleFunc("/orders/delete",
+		handlers.Transactional(db, s.logger, func(w http.ResponseWriter, r *http.Request, db datasources.DBClient) {
+			handlers.HandleOrdersDelete(w, r, db, s.logger)
+		}),
+	)
+	s.mux.HandleFunc("/orders/update",
+		handlers.Idempotent(db, s.idempotencyWindow, s.logger, handlers.Transactional(db, s.logger, func(w http.ResponseWriter, r *http.Request, db datasources.DBClient) {
+			handlers.HandleOrdersUpdate(w, r, db, s.validator, s.logger)
+		})),
+	)
+	s.mux.HandleFunc("/orders/lines",
+		handlers.Idempotent(db, s.idempotencyWindow, s.logger, handlers.Transactional(db, s.logger, func(w http.ResponseWriter, r *http.Request, db datasources.DBClient) {
+			handlers.HandleOrderLines(w, r, db, s.logger)
+		})),
+	)
+	s.mux.HandleFunc("/orders/weights",
+		s.admin(handlers.Transactional(db, s.logger, func(w http.ResponseWriter, r *http.Request, db datasources.DBClient) {
+			handlers.HandleOrderActualQuantities(w, r, db, s.logger)
+		})),
+	)
+	s.mux.HandleFunc("/orders/archived",
+		s.admin(handlers.Transactional(db, s.logger, func(w http.ResponseWriter, r *http.Request, db datasources.DBClient) {
+			handlers.HandleOrdersArchived(w, r, db, s.logger)
+		})),
+	)
+	s.mux.HandleFunc("/orders/restore",
+		s.admin(handlers.Transactional(db, s.logger, func(w http.ResponseWriter, r *http.Request, db datasources.DBClient) {
+			handlers.HandleOrdersRestore(w, r, db, s.logger)
+		})),
+	)
+	s.mux.HandleFunc("/orders/ready-for-pickup",
+		s.admin(handlers.Transactional(db, s.logger, func(w http.ResponseWriter, r *http.Request, db datasources.DBClient) {
+			handlers.HandleOrdersReadyForPickup(w, r, db, s.logger)
+		})),
+	)
+	s.mux.HandleFunc("/orders/uninvoiced",
+		s.admin(func(w http.ResponseWriter, r *http.Request) {
+			handlers.HandleOrdersUninvoiced(w, r, db, s.logger)
+		}),
+	)
+	s.mux.HandleFunc("/orders/export",
+		s.admin(func(w http.ResponseWriter, r *http.Request) {
+			handlers.HandleOrdersExport(w, r, db, s.logger)
+		}),
+	)
+	s.mux.HandleFunc("/orders/",
 		func(w http.ResponseWriter, r *http.Request) {
-			handlers.HandleOrdersAdd(w, r, db, s.logger)
+			handlers.HandleOrderDocuments(w, r, db, s.logger)
 		},
 	)
-	s.mux.HandleFunc("/orders/delete",
+	s.mux.HandleFunc("/images",
+		s.admin(handlers.Transactional(db, s.logger, func(w http.ResponseWriter, r *http.Request, db datasources.DBClient) {
+			handlers.HandleImages(w, r, db, s.imageStore, s.logger)
+		})),
+	)
+	s.mux.HandleFunc(images.URLPrefix,
 		func(w http.ResponseWriter, r *http.Request) {
-			handlers.HandleOrdersDelete(w, r, db, s.logger)
+			handlers.HandleImageFiles(w, r, s.imageStore, s.logger)
 		},
 	)
-	s.mux.HandleFunc("/orders/update",
+	s.mux.HandleFunc("/prices/history",
+		s.admin(func(w http.ResponseWriter, r *http.Request) {
+			handlers.HandlePriceHistory(w, r, db, s.logger)
+		}),
+	)
+	s.mux.HandleFunc("/prices/scheduled",
+		s.admin(handlers.Transactional(db, s.logger, func(w http.ResponseWriter, r *http.Request, db datasources.DBClient) {
+			handlers.HandleScheduledPrices(w, r, db, s.logger)
+		})),
+	)
+	s.mux.HandleFunc("/promotions",
+		s.admin(handlers.Transactional(db, s.logger, func(w http.ResponseWriter, r *http.Request, db datasources.DBClient) {
+			handlers.HandlePromotions(w, r, db, s.logger)
+		})),
+	)
+	s.mux.HandleFunc("/reports/sales",
+		s.admin(func(w http.ResponseWriter, r *http.Request) {
+			handlers.HandleSalesReports(w, r, db, s.logger)
+		}),
+	)
+	s.mux.HandleFunc("/reports/vouchers",
+		s.admin(func(w http.ResponseWriter, r *http.Request) {
+			handlers.HandleVoucherReports(w, r, db, s.logger)
+		}),
+	)
+	s.mux.HandleFunc("/audit",
+		s.admin(func(w http.ResponseWriter, r *http.Request) {
+			handlers.HandleAudit(w, r, db, s.logger)
+		}),
+	)
+	s.mux.HandleFunc("/payments",
+		s.admin(handlers.Transactional(db, s.logger, func(w http.ResponseWriter, r *http.Request, db datasources.DBClient) {
+			handlers.HandlePayments(w, r, db, s.payments, s.invoicing, s.logger)
+		})),
+	)
+	s.mux.HandleFunc("/refunds",
+		s.admin(handlers.Transactional(db, s.logger, func(w http.ResponseWriter, r *http.Request, db datasources.DBClient) {
+			handlers.HandleRefunds(w, r, db, s.payments, s.invoicing, s.logger)
+		})),
+	)
+	s.mux.HandleFunc("/addresses",
+		handlers.Transactional(db, s.logger, func(w http.ResponseWriter, r *http.Request, db datasources.DBClient) {
+			handlers.HandleAddresses(w, r, db, s.logger)
+		}),
+	)
+	s.mux.HandleFunc("/delivery-zones",
+		s.adminWrites(handlers.Transactional(db, s.logger, func(w http.ResponseWriter, r *http.Request, db datasources.DBClient) {
+			handlers.HandleDeliveryZones(w, r, db, s.logger)
+		})),
+	)
+	s.mux.HandleFunc("/delivery-slots",
+		s.adminWrites(handlers.Transactional(db, s.logger, func(w http.ResponseWriter, r *http.Request, db datasources.DBClient) {
+			handlers.HandleDeliverySlots(w, r, db, s.logger)
+		})),
+	)
+	s.mux.HandleFunc("/delivery-slots/available",
+		func(w http.ResponseWriter, r *http.Request) {
+			handlers.HandleAvailableDeliverySlots(w, r, db, s.logger)
+		},
+	)
+	s.mux.HandleFunc("/delivery-slots/reservations",
+		handlers.Transactional(db, s.logger, func(w http.ResponseWriter, r *http.Request, db datasources.DBClient) {
+			handlers.HandleSlotReservations(w, r, db, s.slotReservation, s.logger)
+		}),
+	)
+	s.mux.HandleFunc("/pickup-locations",
+		s.adminWrites(handlers.Transactional(db, s.logger, func(w http.ResponseWriter, r *http.Request, db datasources.DBClient) {
+			handlers.HandlePickupLocations(w, r, db, s.logger)
+		})),
+	)
+	s.mux.HandleFunc("/tax-classes",
+		s.adminWrites(handlers.Transactional(db, s.logger, func(w http.ResponseWriter, r *http.Request, db datasources.DBClient) {
+			handlers.HandleTaxClasses(w, r, db, s.logger)
+		})),
+	)
+	s.mux.HandleFunc("/tax-classes/assignments",
+		s.admin(handlers.Transactional(db, s.logger, func(w http.ResponseWriter, r *http.Request, db datasources.DBClient) {
+			handlers.HandleTaxClassAssignments(w, r, db, s.logger)
+		})),
+	)
+	s.mux.HandleFunc("/catalog/import",
+		s.admin(handlers.Transactional(db, s.logger, func(w http.ResponseWriter, r *http.Request, db datasources.DBClient) {
+			handlers.HandleCatalogImport(w, r, db, s.logger)
+		})),
+	)
+	s.mux.HandleFunc("/carts",
+		handlers.Transactional(db, s.logger, func(w http.ResponseWriter, r *http.Request, db datasources.DBClient) {
+			handlers.HandleCarts(w, r, db, s.logger)
+		}),
+	)
+	s.mux.HandleFunc("/carts/suggestions",
 		func(w http.ResponseWriter, r *http.Request) {
-			handlers.HandleOrdersUpdate(w, r, db, s.logger)
+			handlers.HandleCartSuggestions(w, r, db, s.recommender, s.logger)
 		},
 	)
+	s.mux.HandleFunc("/notifications/preferences",
+		handlers.Transactional(db, s.logger, func(w http.ResponseWriter, r *http.Request, db datasources.DBClient) {
+			handlers.HandleNotificationPreferences(w, r, db, s.logger)
+		}),
+	)
 
 	return s
 }
 
+// parseAdminTokens reads the name:token pairs of the -admin-tokens flag.
+func parseAdminTokens(value string) (map[string]string, error) {
+	admins := make(map[string]string)
+	if len(value) == 0 {
+		return admins, nil
+	}
+
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), ":", 2)
+		if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+			return nil, fmt.Errorf("admin token %q is not a name:token pair", pair)
+		}
+		admins[parts[1]] = parts[0]
+	}
+
+	return admins, nil
+}
+
+// importCatalog runs `server import-catalog -file <path>` and prints the
+// import report; it exits with 1 when the catalog was rejected.
+func importCatalog(args []string, logger *log.Logger, db datasources.DBClient) int {
+	flags := flag.NewFlagSet("import-catalog", flag.ExitOnError)
+	file := flags.String("file", "", "CSV or JSON catalog file to import")
+	format := flags.String("format", "", "catalog format, csv or json (guessed from the file extension by default)")
+	dryRun := flags.Bool("dry-run", false, "validate the catalog and report the changes without applying them")
+	operator := flags.String("operator", "cli", "operator recorded in the audit log")
+	_ = flags.Parse(args)
+
+	if len(*format) == 0 {
+		*format = catalog.FormatOf(*file)
+	}
+	content, err := os.Open(*file)
+	if err != nil {
+		logger.Println(err)
+		return 1
+	}
+	defer content.Close()
+
+	rows, parseErrs, err := catalog.Parse(content, *format)
+	if err != nil {
+		logger.Println(err)
+		return 1
+	}
+	report, err := catalog.Import(db, rows, parseErrs, *dryRun, *operator, logger)
+	if err != nil {
+		logger.Println(err)
+		return 1
+	}
+
+	output, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		logger.Println(err)
+		return 1
+	}
+	logger.Println(string(output))
+	if len(report.Errors) > 0 {
+		return 1
+	}
+
+	return 0
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "import-catalog" {
+		logger := log.New(os.Stdout, "", 0)
+		db := datasources.GetClient("user", "password", "onlinestore")
+		os.Exit(importCatalog(os.Args[2:], logger, db))
+	}
+
+	cartIdle := flag.Duration("cart-idle", 24*time.Hour, "how long a cart must be idle before it is considered abandoned")
+	cartScanInterval := flag.Duration("cart-scan-interval", 15*time.Minute, "how often idle carts are scanned")
+	notificationsFile := flag.String("notifications-file", "", "file reminder notifications are written to (defaults to stdout)")
+	archiveRetention := flag.Duration("archive-retention", 90*24*time.Hour, "how long archived orders are kept before being purged")
+	archivePurgeInterval := flag.Duration("archive-purge-interval", time.Hour, "how often archived orders past retention are purged")
+	adminToken := flag.String("admin-token", "", "token expected in the X-Admin-Token header on admin routes, audited as \"admin\" (admin routes are disabled when no token is set)")
+	adminTokens := flag.String("admin-tokens", "", "comma separated name:token pairs of the admins allowed on admin routes, audited under their name")
+	idempotencyWindow := flag.Duration("idempotency-window", 24*time.Hour, "how long responses to requests with an Idempotency-Key are replayed")
+	defaultCountry := flag.String("default-country", "RO", "country whose calling code is assumed for national phone numbers")
+	validationRules := flag.String("validation-rules", "", "JSON file with per-field validation rules overriding the defaults")
+	slotReservation := flag.Duration("slot-reservation", 15*time.Minute, "how long a delivery slot stays reserved while the order is not placed")
+	invoicingConfig := flag.String("invoicing-config", "", "JSON file with the invoice issuer details, series and currency")
+	imagesDir := flag.String("images-dir", "uploads", "directory uploaded product images and their thumbnails are stored in")
+	imageMaxSize := flag.Int("image-max-size", images.DefaultMaxSize, "largest image upload accepted, in bytes")
+	recommendationsInterval := flag.Duration("recommendations-interval", time.Hour, "how often product recommendations are recomputed from past orders")
+	invoiceRetryInterval := flag.Duration("invoice-retry-interval", 5*time.Minute, "how often invoices and credit notes that could not be issued are issued again")
+	priceScheduleInterval := flag.Duration("price-schedule-interval", time.Minute, "how often scheduled price changes are checked and applied")
+	flag.Parse()
+
 	logger := log.New(os.Stdout, "", 0)
 	db := datasources.GetClient("user", "password", "onlinestore")
-	hs := setup(logger, db)
+	validator, err := validation.LoadValidator(*validationRules, *defaultCountry)
+	if err != nil {
+		logger.Fatalln(err)
+	}
+	invoicing, err := invoices.LoadConfig(*invoicingConfig)
+	if err != nil {
+		logger.Fatalln(err)
+	}
+	recommender := recommendations.NewEngine(db)
+	imageStorage, err := images.NewLocalStorage(*imagesDir)
+	if err != nil {
+		logger.Fatalln(err)
+	}
+	imageStore := images.NewStore(imageStorage, *imageMaxSize)
+	admins, err := parseAdminTokens(*adminTokens)
+	if err != nil {
+		logger.Fatalln(err)
+	}
+	hs := setup(logger, db, *adminToken, admins, *idempotencyWindow, validator, *slotReservation, invoicing, recommender, imageStore)
+
+	var notifier notifiers.Notifier = notifiers.NewLogNotifier(logger)
+	var notificationsOutput *os.File
+	if len(*notificationsFile) > 0 {
+		fileNotifier, file, err := notifiers.NewFileNotifier(*notificationsFile)
+		if err != nil {
+			logger.Fatalln(err)
+		}
+		notificationsOutput = file
+		notifier = fileNotifier
+	}
+
+	stop := make(chan struct{})
+	queue := notifiers.NewQueue(notifier, 100, logger)
+	go queue.Run(stop)
+	go workers.NewAbandonedCartsWorker(db, queue, *cartIdle, *cartScanInterval, logger).Run(stop)
+	go workers.NewArchivedOrdersWorker(db, *archiveRetention, *archivePurgeInterval, logger).Run(stop)
+	go workers.NewRecommendationsWorker(recommender, *recommendationsInterval, logger).Run(stop)
+	go workers.NewPriceScheduleWorker(db, *priceScheduleInterval, logger).Run(stop)
+	go workers.NewInvoicesWorker(db, invoicing, *invoiceRetryInterval, logger).Run(stop)
 
 	logger.Printf("Listening on http://localhost%s\n", hs.Addr)
 	go func() {
@@ -109,5 +554,13 @@ func main() {
 	<-signals
 
 	logger.Println("Shutting down webserver.")
+	close(stop)
+	// os.Exit skips deferred calls, so the notifications file is closed here.
+	if notificationsOutput != nil {
+		err = notificationsOutput.Close()
+		if err != nil {
+			logger.Println(err)
+		}
+	}
 	os.Exit(0)
 }
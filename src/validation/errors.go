@@ -0,0 +1,23 @@
+package validation
+
+import (
+	"strings"
+)
+
+type (
+	FieldError struct {
+		Field   string `json:"field"`
+		Message string `json:"message"`
+	}
+
+	Errors []FieldError
+)
+
+func (errs Errors) Error() string {
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Field+": "+err.Message)
+	}
+
+	return strings.Join(messages, "; ")
+}
@@ -0,0 +1,59 @@
+package validation
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+var countryCallingCodes = map[string]string{
+	"RO": "40",
+	"MD": "373",
+	"HU": "36",
+	"BG": "359",
+	"DE": "49",
+	"IT": "39",
+	"ES": "34",
+	"FR": "33",
+	"GB": "44",
+	"US": "1",
+}
+
+// NormalizePhone parses an international (+40..., 0040...) or national
+// (07...) number into E.164, using defaultCountry for national numbers.
+func NormalizePhone(number string, defaultCountry string) (string, error) {
+	var digits strings.Builder
+
+	number = strings.TrimSpace(number)
+	for i, r := range number {
+		switch {
+		case unicode.IsDigit(r):
+			digits.WriteRune(r)
+		case r == '+' && i == 0:
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+		default:
+			return "", errors.New("must contain only digits, spaces, dashes, dots, parentheses and a leading +")
+		}
+	}
+
+	national := digits.String()
+	switch {
+	case strings.HasPrefix(number, "+"):
+	case strings.HasPrefix(national, "00"):
+		national = national[2:]
+	case strings.HasPrefix(national, "0"):
+		callingCode, ok := countryCallingCodes[strings.ToUpper(defaultCountry)]
+		if !ok {
+			return "", errors.New("must be in international format")
+		}
+		national = callingCode + national[1:]
+	default:
+		return "", errors.New("must be in international format or start with the national trunk prefix 0")
+	}
+
+	if len(national) < 8 || len(national) > 15 || national[0] == '0' {
+		return "", errors.New("is not a valid phone number")
+	}
+
+	return "+" + national, nil
+}
@@ -0,0 +1,161 @@
+package validation
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"unicode/utf8"
+)
+
+const (
+	NameKind  = "name"
+	EmailKind = "email"
+	PhoneKind = "phone"
+)
+
+var (
+	namePattern  = regexp.MustCompile(`^\p{L}[\p{L}\p{M}]*(?:(?:[ '’\-]|\. ?)\p{L}[\p{L}\p{M}]*)*\.?$`)
+	emailPattern = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
+)
+
+type (
+	FieldRules struct {
+		Required  bool   `json:"required"`
+		MinLength int    `json:"minLength"`
+		MaxLength int    `json:"maxLength"`
+		Kind      string `json:"kind"`
+		Pattern   string `json:"pattern"`
+	}
+
+	Validator struct {
+		rules          map[string]FieldRules
+		patterns       map[string]*regexp.Regexp
+		defaultCountry string
+	}
+)
+
+func DefaultOrderRules() map[string]FieldRules {
+	return map[string]FieldRules{
+		"firstName":     {Required: true, MaxLength: 50, Kind: NameKind},
+		"lastName":      {Required: true, MaxLength: 50, Kind: NameKind},
+		"email":         {Required: true, MaxLength: 254, Kind: EmailKind},
+		"phoneNumber":   {Required: true, Kind: PhoneKind},
+		"city":          {Required: true, MaxLength: 100, Kind: NameKind},
+		"address":       {Required: true, MaxLength: 255},
+		"paymentMethod": {Required: true},
+	}
+}
+
+func DefaultValidator() Validator {
+	return Validator{
+		rules:          DefaultOrderRules(),
+		patterns:       make(map[string]*regexp.Regexp),
+		defaultCountry: "RO",
+	}
+}
+
+func NewValidator(rules map[string]FieldRules, defaultCountry string) (Validator, error) {
+	patterns := make(map[string]*regexp.Regexp)
+	for field, fieldRules := range rules {
+		if len(fieldRules.Pattern) == 0 {
+			continue
+		}
+
+		pattern, err := regexp.Compile(fieldRules.Pattern)
+		if err != nil {
+			return Validator{}, fmt.Errorf("invalid pattern for field '%s': %s", field, err.Error())
+		}
+		patterns[field] = pattern
+	}
+
+	return Validator{rules: rules, patterns: patterns, defaultCountry: defaultCountry}, nil
+}
+
+// LoadValidator overrides the default order rules with the per-field rules in
+// the JSON file at path; fields missing from the file keep their defaults.
+func LoadValidator(path string, defaultCountry string) (Validator, error) {
+	rules := DefaultOrderRules()
+	if len(path) == 0 {
+		return NewValidator(rules, defaultCountry)
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Validator{}, err
+	}
+
+	var overrides map[string]FieldRules
+	err = json.Unmarshal(content, &overrides)
+	if err != nil {
+		return Validator{}, err
+	}
+	for field, fieldRules := range overrides {
+		rules[field] = fieldRules
+	}
+
+	return NewValidator(rules, defaultCountry)
+}
+
+func (validator Validator) Validate(fields map[string]string) (map[string]string, Errors) {
+	var errs Errors
+	normalized := make(map[string]string)
+
+	names := make([]string, 0, len(validator.rules))
+	for field := range validator.rules {
+		names = append(names, field)
+	}
+	sort.Strings(names)
+
+	for _, field := range names {
+		value, message := validator.validateField(field, fields[field])
+		if len(message) > 0 {
+			errs = append(errs, FieldError{Field: field, Message: message})
+			continue
+		}
+		normalized[field] = value
+	}
+
+	return normalized, errs
+}
+
+func (validator Validator) validateField(field string, value string) (string, string) {
+	rules := validator.rules[field]
+	length := utf8.RuneCountInString(value)
+
+	if length == 0 {
+		if rules.Required {
+			return value, "is required"
+		}
+		return value, ""
+	}
+	if rules.MinLength > 0 && length < rules.MinLength {
+		return value, fmt.Sprintf("must have at least %d characters", rules.MinLength)
+	}
+	if rules.MaxLength > 0 && length > rules.MaxLength {
+		return value, fmt.Sprintf("must have at most %d characters", rules.MaxLength)
+	}
+	if pattern, ok := validator.patterns[field]; ok && !pattern.MatchString(value) {
+		return value, "does not match the required format"
+	}
+
+	switch rules.Kind {
+	case NameKind:
+		if !namePattern.MatchString(value) {
+			return value, "must contain only letters, spaces, hyphens, apostrophes and dots"
+		}
+	case EmailKind:
+		if !emailPattern.MatchString(value) {
+			return value, "is not a valid email address"
+		}
+	case PhoneKind:
+		phone, err := NormalizePhone(value, validator.defaultCountry)
+		if err != nil {
+			return value, err.Error()
+		}
+		return phone, ""
+	}
+
+	return value, ""
+}
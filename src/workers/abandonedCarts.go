@@ -0,0 +1,109 @@
+package workers
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/mariacalinoiu/smartket/src/datasources"
+	"github.com/mariacalinoiu/smartket/src/notifiers"
+	"github.com/mariacalinoiu/smartket/src/repositories"
+)
+
+type AbandonedCartsWorker struct {
+	db       datasources.DBClient
+	queue    *notifiers.Queue
+	idleFor  time.Duration
+	interval time.Duration
+	logger   *log.Logger
+}
+
+func NewAbandonedCartsWorker(db datasources.DBClient, queue *notifiers.Queue, idleFor time.Duration, interval time.Duration, logger *log.Logger) AbandonedCartsWorker {
+	return AbandonedCartsWorker{
+		db:       db,
+		queue:    queue,
+		idleFor:  idleFor,
+		interval: interval,
+		logger:   logger,
+	}
+}
+
+func (worker AbandonedCartsWorker) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(worker.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			worker.scan()
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (worker AbandonedCartsWorker) scan() {
+	idleSince := int(time.Now().Add(-worker.idleFor).UnixNano() / 1000000000)
+
+	carts, err := worker.db.GetIdleCarts(idleSince)
+	if err != nil {
+		worker.logger.Printf("Abandoned carts error: %s", err.Error())
+		return
+	}
+
+	for _, cart := range carts.Carts {
+		if len(cart.ProductsInCart) == 0 {
+			continue
+		}
+
+		preference, err := worker.db.GetNotificationPreference(cart.Email)
+		if err != nil {
+			worker.logger.Printf("Abandoned carts error: %s; CartID: %d", err.Error(), cart.ID)
+			continue
+		}
+
+		if preference.OptOut {
+			worker.recordEvent(cart, false)
+			continue
+		}
+
+		token, err := worker.db.NotificationToken(cart.Email)
+		if err != nil {
+			worker.logger.Printf("Abandoned carts error: %s; CartID: %d", err.Error(), cart.ID)
+			continue
+		}
+
+		// A cart is only marked once its reminder was sent, so that a full
+		// queue or a failed send leaves it for the next scan.
+		cart := cart
+		if !worker.queue.Enqueue(reminderFor(cart, token), func() { worker.recordEvent(cart, true) }) {
+			worker.logger.Printf("Abandoned carts error: notification queue full; CartID: %d", cart.ID)
+		}
+	}
+}
+
+func (worker AbandonedCartsWorker) recordEvent(cart repositories.Cart, notified bool) {
+	err := worker.db.InsertAbandonedCartEvent(repositories.AbandonedCartEvent{
+		CartID:   cart.ID,
+		Email:    cart.Email,
+		Notified: notified,
+	})
+	if err != nil {
+		worker.logger.Printf("Abandoned carts error: %s; CartID: %d", err.Error(), cart.ID)
+	}
+}
+
+func reminderFor(cart repositories.Cart, token string) notifiers.Notification {
+	body := "You left the following products in your cart:"
+	for _, product := range cart.ProductsInCart {
+		body += fmt.Sprintf(" %sx %s;", strconv.FormatFloat(float64(product.Quantity), 'f', -1, 32), product.Product.Name)
+	}
+	body += fmt.Sprintf(" To stop these reminders, opt out with the token %s.", token)
+
+	return notifiers.Notification{
+		Email:   cart.Email,
+		Subject: "Your cart is waiting for you",
+		Body:    body,
+	}
+}
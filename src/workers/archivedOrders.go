@@ -0,0 +1,52 @@
+package workers
+
+import (
+	"log"
+	"time"
+
+	"github.com/mariacalinoiu/smartket/src/datasources"
+)
+
+type ArchivedOrdersWorker struct {
+	db        datasources.DBClient
+	retention time.Duration
+	interval  time.Duration
+	logger    *log.Logger
+}
+
+func NewArchivedOrdersWorker(db datasources.DBClient, retention time.Duration, interval time.Duration, logger *log.Logger) ArchivedOrdersWorker {
+	return ArchivedOrdersWorker{
+		db:        db,
+		retention: retention,
+		interval:  interval,
+		logger:    logger,
+	}
+}
+
+func (worker ArchivedOrdersWorker) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(worker.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			worker.purge()
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (worker ArchivedOrdersWorker) purge() {
+	archivedBefore := int(time.Now().Add(-worker.retention).UnixNano() / 1000000000)
+
+	purged, err := worker.db.PurgeArchivedOrders(archivedBefore)
+	if err != nil {
+		worker.logger.Printf("Archived orders error: %s; Purged: %d", err.Error(), purged)
+		return
+	}
+
+	if purged > 0 {
+		worker.logger.Printf("Purged %d archived orders", purged)
+	}
+}
@@ -0,0 +1,103 @@
+package workers
+
+import (
+	"log"
+	"time"
+
+	"github.com/mariacalinoiu/smartket/src/datasources"
+	"github.com/mariacalinoiu/smartket/src/invoices"
+)
+
+// InvoicesWorker issues again the invoices of orders with a captured payment
+// and the credit notes of refunds that could not be issued when the payment
+// was captured or refunded.
+type InvoicesWorker struct {
+	db       datasources.DBClient
+	config   invoices.Config
+	interval time.Duration
+	logger   *log.Logger
+}
+
+func NewInvoicesWorker(db datasources.DBClient, config invoices.Config, interval time.Duration, logger *log.Logger) InvoicesWorker {
+	return InvoicesWorker{
+		db:       db,
+		config:   config,
+		interval: interval,
+		logger:   logger,
+	}
+}
+
+func (worker InvoicesWorker) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(worker.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			worker.issueInvoices()
+			worker.issueCreditNotes()
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (worker InvoicesWorker) issueInvoices() {
+	orders, err := worker.db.GetUninvoicedOrders()
+	if err != nil {
+		worker.logger.Printf("Invoicing error: %s", err.Error())
+		return
+	}
+
+	issued := 0
+	for _, order := range orders.Orders {
+		_, err = worker.db.IssueInvoice(invoices.NewInvoice(order, worker.config))
+		if err != nil && err != datasources.ErrInvoiceAlreadyIssued {
+			worker.logger.Printf("Invoicing error: %s; OrderID: %d", err.Error(), order.ID)
+			continue
+		}
+		issued++
+	}
+
+	if issued > 0 {
+		worker.logger.Printf("Issued %d pending invoices", issued)
+	}
+}
+
+func (worker InvoicesWorker) issueCreditNotes() {
+	orderIDs, err := worker.db.GetUncreditedRefundOrders()
+	if err != nil {
+		worker.logger.Printf("Invoicing error: %s", err.Error())
+		return
+	}
+
+	issued := 0
+	for _, orderID := range orderIDs {
+		orders, err := worker.db.GetOrders(orderID)
+		if err != nil || len(orders.Orders) != 1 {
+			worker.logger.Printf("Invoicing error: could not get order %d", orderID)
+			continue
+		}
+		invoice, err := worker.db.GetInvoice(orderID)
+		if err != nil {
+			worker.logger.Printf("Invoicing error: %s; OrderID: %d", err.Error(), orderID)
+			continue
+		}
+
+		for _, refund := range orders.Orders[0].Refunds {
+			_, err = worker.db.IssueInvoice(invoices.NewCreditNote(orders.Orders[0], refund, invoice, worker.config))
+			if err == datasources.ErrInvoiceAlreadyIssued {
+				continue
+			}
+			if err != nil {
+				worker.logger.Printf("Invoicing error: %s; OrderID: %d, RefundID: %d", err.Error(), orderID, refund.ID)
+				continue
+			}
+			issued++
+		}
+	}
+
+	if issued > 0 {
+		worker.logger.Printf("Issued %d pending credit notes", issued)
+	}
+}
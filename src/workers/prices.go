@@ -0,0 +1,51 @@
+package workers
+
+import (
+	"log"
+	"time"
+
+	"github.com/mariacalinoiu/smartket/src/datasources"
+)
+
+type PriceScheduleWorker struct {
+	db       datasources.DBClient
+	interval time.Duration
+	logger   *log.Logger
+}
+
+func NewPriceScheduleWorker(db datasources.DBClient, interval time.Duration, logger *log.Logger) PriceScheduleWorker {
+	return PriceScheduleWorker{
+		db:       db,
+		interval: interval,
+		logger:   logger,
+	}
+}
+
+// Run applies the changes that came due while the server was down right away,
+// then checks again on every tick.
+func (worker PriceScheduleWorker) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(worker.interval)
+	defer ticker.Stop()
+
+	worker.apply()
+	for {
+		select {
+		case <-ticker.C:
+			worker.apply()
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (worker PriceScheduleWorker) apply() {
+	applied, err := worker.db.ApplyScheduledPrices(int(time.Now().UnixNano() / 1000000000))
+	if err != nil {
+		worker.logger.Printf("Price schedule error: %s", err.Error())
+		return
+	}
+
+	if applied > 0 {
+		worker.logger.Printf("Applied %d scheduled price changes", applied)
+	}
+}
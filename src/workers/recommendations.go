@@ -0,0 +1,44 @@
+package workers
+
+import (
+	"log"
+	"time"
+
+	"github.com/mariacalinoiu/smartket/src/recommendations"
+)
+
+type RecommendationsWorker struct {
+	engine   *recommendations.Engine
+	interval time.Duration
+	logger   *log.Logger
+}
+
+func NewRecommendationsWorker(engine *recommendations.Engine, interval time.Duration, logger *log.Logger) RecommendationsWorker {
+	return RecommendationsWorker{
+		engine:   engine,
+		interval: interval,
+		logger:   logger,
+	}
+}
+
+func (worker RecommendationsWorker) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(worker.interval)
+	defer ticker.Stop()
+
+	worker.refresh()
+	for {
+		select {
+		case <-ticker.C:
+			worker.refresh()
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (worker RecommendationsWorker) refresh() {
+	err := worker.engine.Refresh()
+	if err != nil {
+		worker.logger.Printf("Recommendations error: %s", err.Error())
+	}
+}